@@ -0,0 +1,81 @@
+package sonar
+
+import (
+	"fmt"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+// WatchBlocks delivers the header of every block on the specified chain to
+// the handler, in order and including blocks without logs, e.g. to drive
+// per-block snapshots or liveness checks. Blocks follow the same cursor,
+// confirmation, finality and reorg rules as polled logs: a block the handler
+// fails on is retried and delivered again after a restart, and blocks
+// orphaned by a reorganization are delivered again with Removed set, newest
+// first. Headers are polled with eth_getBlockByNumber; unless the configured
+// WatchMode is ModePoll, a newHeads subscription also wakes the watch as soon
+// as a block is produced, where the chain supports it; the watch then
+// reports ModeHeads.
+//
+// The chain must implement chain.HeaderReader. The default cursor key is
+// "<chain>:blocks". Middleware, deduplication and dead-lettering apply to
+// logs only.
+func (s *Sonar) WatchBlocks(chainID string, handler func(event.Block) error, opts ...WatchOption) (*Handle, error) {
+	o := s.watchOptions(chainID, opts)
+
+	c, ok := s.registry.Get(chainID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
+	}
+	if _, ok := c.(chain.HeaderReader); !ok {
+		return nil, fmt.Errorf("sonar: %s: %w", chainID, watcher.ErrHeadersUnsupported)
+	}
+	if o.CursorKey == "" {
+		o.CursorKey = chainID + ":blocks"
+	}
+	if err := s.loadCoverage(o.CursorKey); err != nil {
+		return nil, err
+	}
+
+	id, seq := s.reserveID(chainID, o)
+	logger := s.logger.With("chain", chainID, "watch", id)
+
+	cfg := watcher.BlockConfig{
+		PollerConfig: s.pollerConfig(chainID, o),
+		Subscribe:    s.config.Mode != ModePoll,
+	}
+	cfg.Logger = logger
+	mode := ModePoll
+	if cfg.Subscribe {
+		mode = ModeHeads
+	}
+
+	w := watcher.NewBlockWatcher(c, s.cursor, cfg)
+	w.OnBlock(handler)
+	if o.OnCaughtUp != nil {
+		w.OnCaughtUp(o.OnCaughtUp)
+	}
+
+	h := &Handle{
+		id:    id,
+		seq:   seq,
+		chain: chainID,
+		mode:  mode,
+		named: o.ID != "",
+		key:   o.CursorKey,
+		w:     w,
+		s:     s,
+		done:  make(chan struct{}),
+	}
+	w.OnError(func(err error) {
+		s.reportError(chainID, h.id, err)
+	})
+	if err := s.register(h); err != nil {
+		return nil, err
+	}
+	s.trackCoverage(h)
+	s.start(h, logger)
+	return h, nil
+}
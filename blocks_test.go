@@ -0,0 +1,46 @@
+package sonar
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+)
+
+// headerChain is a logChain that also looks up headers.
+type headerChain struct {
+	logChain
+}
+
+func (c *headerChain) HeaderByNumber(ctx context.Context, n uint64) (*chain.Header, error) {
+	return &chain.Header{Number: n}, nil
+}
+
+func TestWatchBlocksMode(t *testing.T) {
+	tests := []struct {
+		mode WatchMode
+		want WatchMode
+	}{
+		{mode: ModePoll, want: ModePoll},
+		{mode: ModeStream, want: ModeHeads},
+		{mode: ModeHybrid, want: ModeHeads},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			s := newTestSonar(WithWatchMode(tt.mode))
+			if err := s.AddChain(&headerChain{}); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Shutdown(context.Background())
+			if _, err := s.WatchBlocks("test", func(event.Block) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+
+			watches := s.Watches()
+			if len(watches) != 1 || watches[0].Mode != tt.want {
+				t.Errorf("watches %v, want one in mode %v", watches, tt.want)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@
 package arbitrum
 
 import (
+	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/chain/ethereum"
 )
 
-// New creates an Arbitrum chain client.
-func New(rpcURL string) *ethereum.Client {
-	return ethereum.NewWithID("arbitrum", rpcURL)
+// New creates an Arbitrum chain client. Watchers that configure neither a
+// finality mode nor confirmations default to the "safe" block: blocks whose
+// batch has been posted to L1, which lags the head by many minutes.
+func New(rpcURL string, opts ...ethereum.Option) *ethereum.Client {
+	return ethereum.NewWithID("arbitrum", rpcURL, append([]ethereum.Option{ethereum.WithDefaultFinality(chain.TagSafe)}, opts...)...)
 }
@@ -3,10 +3,13 @@
 package bsc
 
 import (
+	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/chain/ethereum"
 )
 
-// New creates a BSC chain client.
-func New(rpcURL string) *ethereum.Client {
-	return ethereum.NewWithID("bsc", rpcURL)
+// New creates a BSC chain client. Watchers that configure neither a finality
+// mode nor confirmations default to the "finalized" block, which fast
+// finality keeps a few blocks behind the head.
+func New(rpcURL string, opts ...ethereum.Option) *ethereum.Client {
+	return ethereum.NewWithID("bsc", rpcURL, append([]ethereum.Option{ethereum.WithDefaultFinality(chain.TagFinalized)}, opts...)...)
 }
@@ -3,6 +3,9 @@ package chain
 
 import (
 	"context"
+	"log/slog"
+	"math/big"
+	"time"
 
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
@@ -37,3 +40,101 @@ type Subscription interface {
 	// Unsubscribe terminates the subscription and closes all channels.
 	Unsubscribe()
 }
+
+// Header holds the block header fields needed to follow the canonical chain.
+type Header struct {
+	// Number is the block height.
+	Number uint64
+
+	// Hash is the block hash.
+	Hash event.Hash
+
+	// ParentHash is the hash of the preceding block.
+	ParentHash event.Hash
+
+	// Timestamp is the block timestamp.
+	Timestamp time.Time
+
+	// BaseFee is the EIP-1559 base fee per gas in wei. Nil for blocks
+	// before London and chains without a base fee.
+	BaseFee *big.Int
+}
+
+// HeaderReader is implemented by chains that can look up block headers.
+// Watchers use it to detect chain reorganizations; chains that do not
+// implement it are polled without reorg detection.
+type HeaderReader interface {
+	// HeaderByNumber returns the canonical header at the given height.
+	HeaderByNumber(ctx context.Context, number uint64) (*Header, error)
+}
+
+// HeaderRangeReader is implemented by chains that can look up the headers of
+// consecutive blocks in one round trip, e.g. with a JSON-RPC batch. Block
+// watchers use it to fetch the headers of a cycle at once.
+type HeaderRangeReader interface {
+	// HeadersByRange returns the canonical headers of the blocks from
+	// through to, in block order.
+	HeadersByRange(ctx context.Context, from, to uint64) ([]*Header, error)
+}
+
+// HeadSubscriber is implemented by chains that can push new block headers
+// as they are produced, e.g. through eth_subscribe newHeads.
+type HeadSubscriber interface {
+	// SubscribeHeads establishes a real-time subscription for new headers.
+	// Returns an error if the transport does not support subscriptions.
+	SubscribeHeads(ctx context.Context) (HeadSubscription, error)
+}
+
+// HeadSubscription represents an active new-header subscription.
+type HeadSubscription interface {
+	// Heads returns a channel that receives new headers.
+	Heads() <-chan Header
+
+	// Err returns a channel that receives subscription errors.
+	// The channel is closed when the subscription ends.
+	Err() <-chan error
+
+	// Unsubscribe terminates the subscription and closes all channels.
+	Unsubscribe()
+}
+
+// BlockTag names a block by its finality rather than its height.
+type BlockTag string
+
+// Block tags understood by EVM nodes.
+const (
+	// TagLatest is the most recent block. It may still be reorganized.
+	TagLatest BlockTag = "latest"
+
+	// TagSafe is the most recent block that is unlikely to be reorganized,
+	// e.g. justified by the beacon chain or posted to L1 by a rollup.
+	TagSafe BlockTag = "safe"
+
+	// TagFinalized is the most recent block that cannot be reorganized
+	// without slashing or an L1 reorganization.
+	TagFinalized BlockTag = "finalized"
+)
+
+// TagReader is implemented by chains that can resolve block tags. Nodes that
+// do not know a tag return an error wrapping ErrTagUnsupported.
+type TagReader interface {
+	// HeaderByTag returns the header of the block the tag currently refers to.
+	HeaderByTag(ctx context.Context, tag BlockTag) (*Header, error)
+}
+
+// FinalityDefaulter is implemented by chains that recommend a finality mode
+// for watchers that do not configure one.
+type FinalityDefaulter interface {
+	// DefaultFinality returns the recommended block tag. TagLatest means the
+	// latest block minus the configured confirmations.
+	DefaultFinality() BlockTag
+}
+
+// Logged is implemented by chains that log their RPC traffic. Sonar passes
+// its logger to every chain added with AddChain that has none.
+type Logged interface {
+	// Logger returns the logger set on the chain, or nil if none is set.
+	Logger() *slog.Logger
+
+	SetLogger(l *slog.Logger)
+}
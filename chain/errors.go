@@ -0,0 +1,12 @@
+package chain
+
+import "errors"
+
+// ErrRangeTooLarge indicates that the provider rejected a log query because
+// its block range or result set was too large. The same query over a smaller
+// block range may succeed.
+var ErrRangeTooLarge = errors.New("chain: log query range too large")
+
+// ErrTagUnsupported indicates that the node does not support a block tag,
+// e.g. "safe" or "finalized" on a chain or client version without them.
+var ErrTagUnsupported = errors.New("chain: block tag unsupported")
@@ -5,47 +5,113 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/internal/lru"
+	"github.com/hedeqiang/sonar/retry"
 	"github.com/hedeqiang/sonar/transport"
 )
 
 // Client is an Ethereum chain implementation.
 type Client struct {
-	id        string
-	transport transport.Transport
+	id         string
+	transport  transport.Transport
+	timestamps *lru.Cache[event.Hash, time.Time] // nil unless WithBlockTimestamps is set
+	txMetadata *lru.Cache[txKey, event.Metadata] // nil unless WithTxMetadata is set
+	finality   chain.BlockTag
+	logger     *slog.Logger      // as passed to SetLogger
+	rpcLog     *transport.Logger // nil until a logger is set
 }
 
-// New creates an Ethereum client with the given RPC endpoint.
-func New(rpcURL string) *Client {
-	return NewWithID("ethereum", rpcURL)
+// Option configures a Client.
+type Option func(*Client)
+
+// WithCircuitBreaker routes every RPC call through the given circuit breaker.
+// While the circuit is open, calls fail fast with an error wrapping
+// retry.ErrCircuitOpen.
+func WithCircuitBreaker(cb *retry.CircuitBreaker) Option {
+	return func(c *Client) {
+		c.transport = transport.NewBreaker(c.transport, cb)
+	}
+}
+
+// WithLogger logs every RPC call: successes at debug level and failures at
+// warn, with the chain ID, method and duration. Chains added to Sonar without
+// a logger are given Sonar's.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) {
+		c.SetLogger(l)
+	}
+}
+
+// WithDefaultFinality sets the finality mode recommended to watchers that
+// configure neither a finality mode nor confirmations: chain.TagLatest
+// (latest minus confirmations), chain.TagSafe or chain.TagFinalized. It
+// overrides the default of the chain's constructor.
+func WithDefaultFinality(tag chain.BlockTag) Option {
+	return func(c *Client) {
+		c.finality = tag
+	}
+}
+
+// New creates an Ethereum client with the given RPC endpoint. Watchers that
+// configure neither a finality mode nor confirmations default to the
+// "finalized" block, about two epochs (~13 minutes) behind the head.
+func New(rpcURL string, opts ...Option) *Client {
+	return NewWithID("ethereum", rpcURL, append([]Option{WithDefaultFinality(chain.TagFinalized)}, opts...)...)
 }
 
 // NewWithID creates an Ethereum-compatible client with a custom chain ID.
-// This allows reuse for EVM-compatible chains (BSC, Polygon, etc.).
-func NewWithID(id, rpcURL string) *Client {
+// This allows reuse for EVM-compatible chains (BSC, Polygon, etc.). As the
+// chain is unknown, watchers default to the latest block minus
+// confirmations; see WithDefaultFinality.
+func NewWithID(id, rpcURL string, opts ...Option) *Client {
 	var t transport.Transport
 	if strings.HasPrefix(rpcURL, "ws://") || strings.HasPrefix(rpcURL, "wss://") {
 		t = transport.NewWebSocket(rpcURL)
 	} else {
 		t = transport.NewHTTP(rpcURL)
 	}
-	return &Client{
-		id:        id,
-		transport: t,
-	}
+	return NewWithTransport(id, t, opts...)
 }
 
 // NewWithTransport creates an Ethereum client with a custom transport.
-func NewWithTransport(id string, t transport.Transport) *Client {
-	return &Client{
+func NewWithTransport(id string, t transport.Transport, opts ...Option) *Client {
+	c := &Client{
 		id:        id,
 		transport: t,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetLogger sets the logger RPC calls are logged to, as WithLogger does.
+// Must be called before the client is used.
+func (c *Client) SetLogger(l *slog.Logger) {
+	c.logger = l
+	if l != nil {
+		l = l.With("chain", c.id)
+	}
+	if c.rpcLog != nil {
+		c.rpcLog.SetLogger(l)
+		return
+	}
+	c.rpcLog = transport.NewLogger(c.transport, l)
+	c.transport = c.rpcLog
+}
+
+// Logger returns the logger set with WithLogger or SetLogger, or nil if none
+// is set.
+func (c *Client) Logger() *slog.Logger {
+	return c.logger
 }
 
 // ID returns the chain identifier.
@@ -74,6 +140,9 @@ func (c *Client) FetchLogs(ctx context.Context, query filter.Query) ([]event.Log
 
 	result, err := c.transport.Call(ctx, "eth_getLogs", params)
 	if err != nil {
+		if isRangeTooLarge(err) {
+			return nil, fmt.Errorf("ethereum: eth_getLogs: %w: %w", chain.ErrRangeTooLarge, err)
+		}
 		return nil, fmt.Errorf("ethereum: eth_getLogs: %w", err)
 	}
 
@@ -91,6 +160,9 @@ func (c *Client) FetchLogs(ctx context.Context, query filter.Query) ([]event.Log
 		logs[i] = l
 	}
 
+	if err := c.enrich(ctx, logs); err != nil {
+		return nil, err
+	}
 	return logs, nil
 }
 
@@ -103,10 +175,37 @@ func (c *Client) Subscribe(ctx context.Context, query filter.Query) (chain.Subsc
 		return nil, fmt.Errorf("ethereum: subscribe: %w", err)
 	}
 
-	sub := newSubscription(c.id, ch, unsub)
+	var enrich func(context.Context, []event.Log)
+	if c.timestamps != nil || c.txMetadata != nil {
+		enrich = func(ctx context.Context, logs []event.Log) {
+			// The logs are delivered either way; the stream goes on.
+			if err := c.enrich(ctx, logs); err != nil && ctx.Err() == nil {
+				c.warn("streamed logs delivered without enrichment", "block", logs[0].BlockNumber, "error", err)
+			}
+		}
+	}
+	sub := newSubscription(c.id, ch, unsub, enrich)
 	return sub, nil
 }
 
+// enrich adds the block timestamps and transaction metadata enabled by the
+// client options to logs. A log whose block or transaction the node does not
+// return is left without the data and logged; enrich only fails if a whole
+// batch of lookups fails, e.g. on a network error, as a retry may succeed.
+func (c *Client) enrich(ctx context.Context, logs []event.Log) error {
+	if err := c.fillTimestamps(ctx, logs); err != nil {
+		return err
+	}
+	return c.fillMetadata(ctx, logs)
+}
+
+// warn logs msg at warn level if the client has a logger.
+func (c *Client) warn(msg string, args ...any) {
+	if c.logger != nil {
+		c.logger.Warn(msg, append([]any{"chain", c.id}, args...)...)
+	}
+}
+
 // buildFilterParams converts a Query into the JSON-RPC filter object.
 func buildFilterParams(query filter.Query) map[string]interface{} {
 	params := make(map[string]interface{})
@@ -151,6 +250,45 @@ func buildFilterParams(query filter.Query) map[string]interface{} {
 	return params
 }
 
+// rangeTooLargeCodes are the JSON-RPC error codes providers reject an
+// oversized eth_getLogs query with.
+var rangeTooLargeCodes = map[int]bool{
+	-32000: true, // server error: Geth, Erigon
+	-32005: true, // limit exceeded (EIP-1474): Infura, Geth
+	-32600: true, // invalid request: Ankr
+	-32602: true, // invalid params: Alchemy, QuickNode, BSC
+}
+
+// rangeTooLargeMessages are the phrases providers use in those rejections,
+// lowercased.
+var rangeTooLargeMessages = []string{
+	"query returned more than",   // Geth, Infura: "query returned more than 10000 results"
+	"eth_getlogs is limited to",  // QuickNode: "eth_getLogs is limited to a 10,000 range"
+	"block range is too wide",    // Ankr
+	"exceed maximum block range", // BSC: "exceed maximum block range: 5000"
+	"limit the query to at most", // Erigon
+	"block range too large",      // various
+	"too many results",           // various: "too many results, try a smaller range"
+	"response size",              // Alchemy: "Log response size exceeded", and others
+}
+
+// isRangeTooLarge reports whether err is a provider rejection of an
+// oversized log query: a JSON-RPC error response with one of the codes and
+// phrases above.
+func isRangeTooLarge(err error) bool {
+	code, ok := transport.ErrorCode(err)
+	if !ok || !rangeTooLargeCodes[code] {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, phrase := range rangeTooLargeMessages {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseHexUint64 parses a "0x"-prefixed hex string to uint64.
 func parseHexUint64(s string) (uint64, error) {
 	s = strings.TrimPrefix(s, "0x")
@@ -0,0 +1,65 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+func TestFetchLogsRangeTooLarge(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int // HTTP status; the body is a JSON-RPC error if 200
+		code    int
+		message string
+		want    bool
+	}{
+		{name: "geth", status: http.StatusOK, code: -32005, message: "query returned more than 10000 results", want: true},
+		{name: "alchemy", status: http.StatusOK, code: -32602, message: "Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range", want: true},
+		{name: "quicknode", status: http.StatusOK, code: -32602, message: "eth_getLogs is limited to a 10,000 range", want: true},
+		{name: "ankr", status: http.StatusOK, code: -32600, message: "block range is too wide", want: true},
+		{name: "bsc", status: http.StatusOK, code: -32000, message: "exceed maximum block range: 5000", want: true},
+		{name: "erigon", status: http.StatusOK, code: -32000, message: "query exceeds limit; limit the query to at most 1000 blocks", want: true},
+		{name: "block range too large", status: http.StatusOK, code: -32000, message: "block range too large", want: true},
+		{name: "too many results", status: http.StatusOK, code: -32005, message: "too many results, try a smaller range", want: true},
+		{name: "response size", status: http.StatusOK, code: -32602, message: "response size should not greater than 10000000 bytes", want: true},
+		{name: "response size code mismatch", status: http.StatusOK, code: -32603, message: "response size should not greater than 10000000 bytes", want: false},
+		{name: "unrelated block range error", status: http.StatusOK, code: -32000, message: "invalid block range params", want: false},
+		{name: "unrelated limit", status: http.StatusOK, code: -32000, message: "batch size is limited to 100", want: false},
+		{name: "rate limit code", status: http.StatusOK, code: -32005, message: "daily request count exceeded, request rate limited", want: false},
+		{name: "unexpected code", status: http.StatusOK, code: -32601, message: "block range is too wide", want: false},
+		{name: "HTTP error body", status: http.StatusBadGateway, message: "block range is too wide", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					ID uint64 `json:"id"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				if tt.status != http.StatusOK {
+					http.Error(w, tt.message, tt.status)
+					return
+				}
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"error":{"code":%d,"message":%q}}`, req.ID, tt.code, tt.message)
+			}))
+			defer srv.Close()
+
+			from, to := uint64(1), uint64(100000)
+			_, err := New(srv.URL).FetchLogs(context.Background(), filter.Query{FromBlock: &from, ToBlock: &to})
+			if err == nil {
+				t.Fatal("FetchLogs succeeded, want an error")
+			}
+			if got := errors.Is(err, chain.ErrRangeTooLarge); got != tt.want {
+				t.Errorf("errors.Is(%v, chain.ErrRangeTooLarge) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
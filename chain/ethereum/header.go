@@ -0,0 +1,183 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/transport"
+)
+
+// HeaderByNumber returns the canonical block header at the given height.
+func (c *Client) HeaderByNumber(ctx context.Context, number uint64) (*chain.Header, error) {
+	return c.fetchHeader(ctx, fmt.Sprintf("0x%x", number))
+}
+
+// HeadersByRange returns the canonical headers of the blocks from through
+// to, fetched in batched eth_getBlockByNumber calls.
+func (c *Client) HeadersByRange(ctx context.Context, from, to uint64) ([]*chain.Header, error) {
+	if from > to {
+		return nil, nil
+	}
+	headers := make([]*chain.Header, 0, to-from+1)
+	for start := from; start <= to; start += maxBatchCalls {
+		end := min(start+maxBatchCalls-1, to)
+
+		reqs := make([]transport.BatchRequest, 0, end-start+1)
+		for n := start; n <= end; n++ {
+			reqs = append(reqs, transport.BatchRequest{
+				Method: "eth_getBlockByNumber",
+				Params: []interface{}{fmt.Sprintf("0x%x", n), false},
+			})
+		}
+		resps, err := transport.Batch(ctx, c.transport, reqs)
+		if err != nil {
+			return nil, fmt.Errorf("ethereum: fetch block headers [%d, %d]: %w", start, end, err)
+		}
+		for i, resp := range resps {
+			block := fmt.Sprintf("0x%x", start+uint64(i))
+			if resp.Err != nil {
+				return nil, fmt.Errorf("ethereum: eth_getBlockByNumber %s: %w", block, resp.Err)
+			}
+			h, err := parseHeader(resp.Result, block)
+			if err != nil {
+				return nil, err
+			}
+			headers = append(headers, h)
+		}
+	}
+	return headers, nil
+}
+
+// HeaderByTag returns the header of the block the tag refers to. Nodes that
+// reject the method or the tag parameter yield an error wrapping
+// chain.ErrTagUnsupported. A node that knows no block for the tag yet, e.g.
+// "finalized block not found" or a null result while it syncs, yields an
+// ordinary error, as it may know one later.
+func (c *Client) HeaderByTag(ctx context.Context, tag chain.BlockTag) (*chain.Header, error) {
+	result, err := c.transport.Call(ctx, "eth_getBlockByNumber", string(tag), false)
+	if err != nil {
+		if isTagUnsupported(err) {
+			return nil, fmt.Errorf("ethereum: eth_getBlockByNumber %s: %w: %w", tag, chain.ErrTagUnsupported, err)
+		}
+		return nil, fmt.Errorf("ethereum: eth_getBlockByNumber %s: %w", tag, err)
+	}
+	if string(result) == "null" {
+		return nil, fmt.Errorf("ethereum: eth_getBlockByNumber %s: no block for the tag yet", tag)
+	}
+	return parseHeader(result, string(tag))
+}
+
+// DefaultFinality returns the finality mode recommended for the chain, set
+// by the chain constructor or WithDefaultFinality.
+func (c *Client) DefaultFinality() chain.BlockTag {
+	if c.finality == "" {
+		return chain.TagLatest
+	}
+	return c.finality
+}
+
+// tagUnsupportedMessages are the phrases nodes reject a block tag with,
+// lowercased. Errors saying no block is known for the tag are not among
+// them: those are transient.
+var tagUnsupportedMessages = []string{
+	"tag not supported",  // Geth: "'safe' tag not supported on pre-merge network"
+	"invalid argument 0", // Geth-based nodes failing to decode the tag parameter
+	"unknown variant",    // Rust nodes: "unknown variant `safe`"
+}
+
+// isTagUnsupported reports whether err is a definite node rejection of
+// eth_getBlockByNumber with a block tag: a JSON-RPC error response for an
+// unknown method or invalid params, or with one of the phrases above.
+func isTagUnsupported(err error) bool {
+	code, ok := transport.ErrorCode(err)
+	if !ok {
+		return false
+	}
+	if code == -32601 || code == -32602 { // method not found, invalid params
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, phrase := range tagUnsupportedMessages {
+		if strings.Contains(msg, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchHeader calls eth_getBlockByNumber without transaction bodies.
+func (c *Client) fetchHeader(ctx context.Context, block string) (*chain.Header, error) {
+	result, err := c.transport.Call(ctx, "eth_getBlockByNumber", block, false)
+	if err != nil {
+		return nil, fmt.Errorf("ethereum: eth_getBlockByNumber: %w", err)
+	}
+
+	return parseHeader(result, block)
+}
+
+// parseHeader parses an eth_getBlockBy* result. block names the requested
+// block in errors.
+func parseHeader(result []byte, block string) (*chain.Header, error) {
+	var rh *rpcHeader
+	if err := json.Unmarshal(result, &rh); err != nil {
+		return nil, fmt.Errorf("ethereum: parse block: %w", err)
+	}
+	if rh == nil {
+		return nil, fmt.Errorf("ethereum: block %s not found", block)
+	}
+
+	h, err := rh.toHeader()
+	if err != nil {
+		return nil, fmt.Errorf("ethereum: convert block %s: %w", block, err)
+	}
+	return h, nil
+}
+
+// rpcHeader is the JSON-RPC representation of an Ethereum block header.
+type rpcHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+	BaseFee    string `json:"baseFeePerGas"`
+}
+
+func (rh *rpcHeader) toHeader() (*chain.Header, error) {
+	var h chain.Header
+
+	number, err := parseHexUint64(rh.Number)
+	if err != nil {
+		return nil, fmt.Errorf("parse number: %w", err)
+	}
+	h.Number = number
+
+	b, err := decodeHex(rh.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("parse hash: %w", err)
+	}
+	copy(h.Hash[:], padLeft(b, 32))
+
+	b, err = decodeHex(rh.ParentHash)
+	if err != nil {
+		return nil, fmt.Errorf("parse parentHash: %w", err)
+	}
+	copy(h.ParentHash[:], padLeft(b, 32))
+
+	ts, err := parseHexUint64(rh.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("parse timestamp: %w", err)
+	}
+	h.Timestamp = time.Unix(int64(ts), 0).UTC()
+
+	if rh.BaseFee != "" {
+		if h.BaseFee, err = parseHexBig(rh.BaseFee); err != nil {
+			return nil, fmt.Errorf("parse baseFeePerGas: %w", err)
+		}
+	}
+
+	return &h, nil
+}
@@ -0,0 +1,132 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+)
+
+func TestHeaderByTag(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int    // HTTP status; the body is a JSON-RPC response if 200
+		result          string // raw result, used if message is empty
+		code            int
+		message         string
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{name: "header", status: http.StatusOK, result: `{"number":"0x10","hash":"0x01","parentHash":"0x02","timestamp":"0x5"}`},
+		{name: "null result", status: http.StatusOK, result: `null`, wantErr: true},
+		{name: "no finalized block yet", status: http.StatusOK, code: -32000, message: "finalized block not found", wantErr: true},
+		{name: "safe block not found", status: http.StatusOK, code: -32000, message: "safe block not found", wantErr: true},
+		{name: "pre-merge geth", status: http.StatusOK, code: -32000, message: "'safe' tag not supported on pre-merge network", wantErr: true, wantUnsupported: true},
+		{name: "invalid params", status: http.StatusOK, code: -32602, message: "invalid argument 0: hex string without 0x prefix", wantErr: true, wantUnsupported: true},
+		{name: "method not found", status: http.StatusOK, code: -32601, message: "the method eth_getBlockByNumber does not exist", wantErr: true, wantUnsupported: true},
+		{name: "rust node", status: http.StatusOK, code: -32000, message: "unknown variant `finalized`", wantErr: true, wantUnsupported: true},
+		{name: "unrelated error", status: http.StatusOK, code: -32000, message: "header not found", wantErr: true},
+		{name: "HTTP error body", status: http.StatusBadGateway, message: "tag not supported", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					ID uint64 `json:"id"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				switch {
+				case tt.status != http.StatusOK:
+					http.Error(w, tt.message, tt.status)
+				case tt.message != "":
+					fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"error":{"code":%d,"message":%q}}`, req.ID, tt.code, tt.message)
+				default:
+					fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, tt.result)
+				}
+			}))
+			defer srv.Close()
+
+			hdr, err := New(srv.URL).HeaderByTag(context.Background(), chain.TagFinalized)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HeaderByTag error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, chain.ErrTagUnsupported); got != tt.wantUnsupported {
+				t.Errorf("errors.Is(%v, chain.ErrTagUnsupported) = %v, want %v", err, got, tt.wantUnsupported)
+			}
+			if !tt.wantErr && hdr.Number != 0x10 {
+				t.Errorf("header number = %d, want 16", hdr.Number)
+			}
+		})
+	}
+}
+
+func TestDefaultFinality(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *Client
+		want chain.BlockTag
+	}{
+		{name: "ethereum", c: New("http://localhost"), want: chain.TagFinalized},
+		{name: "unknown chain", c: NewWithID("devnet", "http://localhost"), want: chain.TagLatest},
+		{name: "override", c: New("http://localhost", WithDefaultFinality(chain.TagSafe)), want: chain.TagSafe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.DefaultFinality(); got != tt.want {
+				t.Errorf("DefaultFinality() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadersByRange(t *testing.T) {
+	var batches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []struct {
+			ID     uint64        `json:"id"`
+			Params []interface{} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			t.Errorf("request is not a batch: %v", err)
+			return
+		}
+		batches++
+		resps := make([]json.RawMessage, len(reqs))
+		for i, req := range reqs {
+			block := req.Params[0].(string)
+			if block == "0x7" {
+				resps[i] = json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":null}`, req.ID))
+				continue
+			}
+			resps[i] = json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":{"number":%q,"hash":"0x01","parentHash":"0x02","timestamp":"0x5"}}`, req.ID, block))
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	headers, err := c.HeadersByRange(context.Background(), 10, 10+maxBatchCalls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 2 {
+		t.Errorf("sent %d batches, want 2", batches)
+	}
+	if len(headers) != maxBatchCalls+1 {
+		t.Fatalf("got %d headers, want %d", len(headers), maxBatchCalls+1)
+	}
+	for i, h := range headers {
+		if h.Number != uint64(10+i) {
+			t.Fatalf("header %d is block %d, want %d", i, h.Number, 10+i)
+		}
+	}
+
+	if _, err := c.HeadersByRange(context.Background(), 5, 8); err == nil {
+		t.Error("HeadersByRange succeeded with a missing block, want an error")
+	}
+}
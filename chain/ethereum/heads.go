@@ -0,0 +1,108 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hedeqiang/sonar/chain"
+)
+
+// SubscribeHeads creates a real-time new-header subscription via WebSocket.
+func (c *Client) SubscribeHeads(ctx context.Context) (chain.HeadSubscription, error) {
+	ch, unsub, err := c.transport.Subscribe(ctx, "eth_subscribe", "newHeads")
+	if err != nil {
+		return nil, fmt.Errorf("ethereum: subscribe heads: %w", err)
+	}
+	return newHeadSubscription(ch, unsub), nil
+}
+
+// HeadSubscription wraps a WebSocket subscription for new block headers.
+type HeadSubscription struct {
+	heads chan chain.Header
+	errs  chan error
+	unsub func()
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newHeadSubscription(raw <-chan []byte, unsub func()) *HeadSubscription {
+	s := &HeadSubscription{
+		heads: make(chan chain.Header, 16),
+		errs:  make(chan error, 1),
+		unsub: unsub,
+		done:  make(chan struct{}),
+	}
+	go s.consume(raw)
+	return s
+}
+
+// Heads returns the channel of new headers.
+func (s *HeadSubscription) Heads() <-chan chain.Header {
+	return s.heads
+}
+
+// Err returns the error channel.
+func (s *HeadSubscription) Err() <-chan error {
+	return s.errs
+}
+
+// Unsubscribe terminates the subscription.
+func (s *HeadSubscription) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.done)
+		if s.unsub != nil {
+			s.unsub()
+		}
+	})
+}
+
+func (s *HeadSubscription) consume(raw <-chan []byte) {
+	defer close(s.heads)
+	defer close(s.errs)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg, ok := <-raw:
+			if !ok {
+				return
+			}
+
+			var notification struct {
+				Result *rpcHeader `json:"result"`
+			}
+			if err := json.Unmarshal(msg, &notification); err != nil || notification.Result == nil {
+				// Try direct header format
+				var rh rpcHeader
+				if err := json.Unmarshal(msg, &rh); err != nil {
+					s.report(err)
+					continue
+				}
+				notification.Result = &rh
+			}
+
+			h, err := notification.Result.toHeader()
+			if err != nil {
+				s.report(fmt.Errorf("ethereum: convert head: %w", err))
+				continue
+			}
+
+			select {
+			case s.heads <- *h:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// report passes err to the error channel unless an error is pending.
+func (s *HeadSubscription) report(err error) {
+	select {
+	case s.errs <- err:
+	default:
+	}
+}
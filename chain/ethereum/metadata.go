@@ -0,0 +1,216 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/internal/lru"
+	"github.com/hedeqiang/sonar/transport"
+)
+
+// txKey identifies a transaction within a block, so that a transaction
+// re-included in another block after a reorg is fetched again.
+type txKey struct {
+	block event.Hash
+	tx    event.Hash
+}
+
+// WithTxMetadata sets Metadata on the logs returned by FetchLogs and delivered
+// by Subscribe. The transaction and receipt of every distinct transaction in
+// each result are fetched in batched eth_getTransactionByHash and
+// eth_getTransactionReceipt calls and cached; the cache holds the metadata of
+// up to cacheSize transactions. Logs of a transaction or receipt the node
+// does not return, e.g. after pruning it, are left without metadata, and the
+// failure is logged.
+func WithTxMetadata(cacheSize int) Option {
+	return func(c *Client) {
+		c.txMetadata = lru.New[txKey, event.Metadata](cacheSize)
+	}
+}
+
+// fillMetadata sets the transaction metadata of every log, fetching the
+// transactions and receipts that are not cached. Logs of transactions the
+// node does not return keep nil metadata. It is a no-op unless WithTxMetadata
+// is set.
+func (c *Client) fillMetadata(ctx context.Context, logs []event.Log) error {
+	if c.txMetadata == nil || len(logs) == 0 {
+		return nil
+	}
+
+	found := make(map[txKey]event.Metadata)
+	var missing []txKey
+	for _, log := range logs {
+		key := txKey{block: log.BlockHash, tx: log.TxHash}
+		if _, ok := found[key]; ok {
+			continue
+		}
+		if md, ok := c.txMetadata.Get(key); ok {
+			found[key] = md
+			continue
+		}
+		found[key] = event.Metadata{}
+		missing = append(missing, key)
+	}
+
+	// Each transaction takes two calls.
+	for start := 0; start < len(missing); start += maxBatchCalls / 2 {
+		end := min(start+maxBatchCalls/2, len(missing))
+		chunk := missing[start:end]
+
+		reqs := make([]transport.BatchRequest, 0, 2*len(chunk))
+		for _, key := range chunk {
+			reqs = append(reqs,
+				transport.BatchRequest{Method: "eth_getTransactionByHash", Params: []interface{}{key.tx.Hex()}},
+				transport.BatchRequest{Method: "eth_getTransactionReceipt", Params: []interface{}{key.tx.Hex()}},
+			)
+		}
+		resps, err := transport.Batch(ctx, c.transport, reqs)
+		if err != nil {
+			return fmt.Errorf("ethereum: fetch transactions: %w", err)
+		}
+		for i, key := range chunk {
+			md, err := parseMetadata(resps[2*i], resps[2*i+1], key.tx.Hex())
+			if err != nil {
+				c.warn("transaction metadata unavailable", "tx_hash", key.tx.Hex(), "error", err)
+				delete(found, key)
+				continue
+			}
+			md.ChainID = c.id
+			found[key] = md
+			c.txMetadata.Add(key, md)
+		}
+	}
+
+	for i := range logs {
+		md, ok := found[txKey{block: logs[i].BlockHash, tx: logs[i].TxHash}]
+		if !ok {
+			continue
+		}
+		md.BlockTime = logs[i].Timestamp
+		if md.GasPrice != nil {
+			md.GasPrice = new(big.Int).Set(md.GasPrice)
+		}
+		logs[i].Metadata = &md
+	}
+	return nil
+}
+
+// parseMetadata builds the metadata of transaction hash from the responses to
+// eth_getTransactionByHash and eth_getTransactionReceipt.
+func parseMetadata(txResp, receiptResp transport.BatchResponse, hash string) (event.Metadata, error) {
+	if txResp.Err != nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: eth_getTransactionByHash %s: %w", hash, txResp.Err)
+	}
+	if receiptResp.Err != nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: eth_getTransactionReceipt %s: %w", hash, receiptResp.Err)
+	}
+
+	var tx *rpcTransaction
+	if err := json.Unmarshal(txResp.Result, &tx); err != nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: parse transaction: %w", err)
+	}
+	if tx == nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: transaction %s not found", hash)
+	}
+	var receipt *rpcReceipt
+	if err := json.Unmarshal(receiptResp.Result, &receipt); err != nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: parse receipt: %w", err)
+	}
+	if receipt == nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: receipt of %s not found", hash)
+	}
+
+	md, err := toMetadata(tx, receipt)
+	if err != nil {
+		return event.Metadata{}, fmt.Errorf("ethereum: convert transaction %s: %w", hash, err)
+	}
+	return md, nil
+}
+
+// rpcTransaction is the JSON-RPC representation of the transaction fields
+// used for metadata.
+type rpcTransaction struct {
+	From     string  `json:"from"`
+	To       *string `json:"to"`
+	Input    string  `json:"input"`
+	GasPrice string  `json:"gasPrice"`
+}
+
+// rpcReceipt is the JSON-RPC representation of the receipt fields used for
+// metadata.
+type rpcReceipt struct {
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	Status            string `json:"status"`
+}
+
+func toMetadata(tx *rpcTransaction, receipt *rpcReceipt) (event.Metadata, error) {
+	var md event.Metadata
+
+	b, err := decodeHex(tx.From)
+	if err != nil {
+		return md, fmt.Errorf("parse from: %w", err)
+	}
+	copy(md.From[:], padLeft(b, 20))
+
+	if tx.To != nil {
+		b, err := decodeHex(*tx.To)
+		if err != nil {
+			return md, fmt.Errorf("parse to: %w", err)
+		}
+		var to event.Address
+		copy(to[:], padLeft(b, 20))
+		md.To = &to
+	}
+
+	if tx.To != nil && len(tx.Input) >= 10 {
+		b, err := decodeHex(tx.Input[:10])
+		if err != nil {
+			return md, fmt.Errorf("parse input: %w", err)
+		}
+		copy(md.Selector[:], b)
+	}
+
+	md.GasUsed, err = parseHexUint64(receipt.GasUsed)
+	if err != nil {
+		return md, fmt.Errorf("parse gasUsed: %w", err)
+	}
+
+	// Receipts from before the London fork carry no effective gas price; the
+	// transaction's gas price is what was paid.
+	price := receipt.EffectiveGasPrice
+	if price == "" {
+		price = tx.GasPrice
+	}
+	md.GasPrice, err = parseHexBig(price)
+	if err != nil {
+		return md, fmt.Errorf("parse gas price: %w", err)
+	}
+
+	// Receipts from before the Byzantium fork carry no status; a transaction
+	// that emitted a log did not revert.
+	md.Status = 1
+	if receipt.Status != "" {
+		md.Status, err = parseHexUint64(receipt.Status)
+		if err != nil {
+			return md, fmt.Errorf("parse status: %w", err)
+		}
+	}
+
+	return md, nil
+}
+
+// parseHexBig parses a "0x"-prefixed hex string to a big.Int.
+func parseHexBig(s string) (*big.Int, error) {
+	s = strings.TrimPrefix(s, "0x")
+	s = strings.TrimPrefix(s, "0X")
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex number %q", s)
+	}
+	return n, nil
+}
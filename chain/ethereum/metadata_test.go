@@ -0,0 +1,110 @@
+package ethereum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// rpcRequest is a JSON-RPC request as received by a test server.
+type rpcRequest struct {
+	ID     uint64            `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// enrichServer serves eth_getLogs with a log in each of transactions 0x1 and
+// 0x2, both in block 0xa, and the block and transactions they refer to. The
+// receipt of transaction 0x2 is missing, as after pruning; a batch fails as a
+// whole if failBatches is set.
+func enrichServer(t *testing.T, failBatches bool) *httptest.Server {
+	t.Helper()
+	result := func(req rpcRequest) string {
+		var param string
+		if len(req.Params) > 0 {
+			json.Unmarshal(req.Params[0], &param)
+		}
+		switch req.Method {
+		case "eth_getLogs":
+			return `[` + testLog("0x1", 0) + `,` + testLog("0x2", 1) + `]`
+		case "eth_getBlockByHash":
+			return `{"number":"0xa","hash":"0x0a","parentHash":"0x09","timestamp":"0x64"}`
+		case "eth_getTransactionByHash":
+			return `{"from":"0x01","to":"0x02","input":"0xa9059cbb","gasPrice":"0x1"}`
+		case "eth_getTransactionReceipt":
+			if param == "0x"+fmt.Sprintf("%064x", 2) {
+				return `null`
+			}
+			return `{"gasUsed":"0x5208","effectiveGasPrice":"0x1","status":"0x1"}`
+		}
+		t.Errorf("unexpected method %s", req.Method)
+		return `null`
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		if body[0] != '[' {
+			var req rpcRequest
+			json.Unmarshal(body, &req)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, result(req))
+			return
+		}
+		if failBatches {
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+			return
+		}
+		var reqs []rpcRequest
+		json.Unmarshal(body, &reqs)
+		resps := make([]json.RawMessage, len(reqs))
+		for i, req := range reqs {
+			resps[i] = json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, result(req)))
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+}
+
+func testLog(tx string, index int) string {
+	return fmt.Sprintf(`{"address":"0x01","topics":[],"data":"0x","blockNumber":"0xa","blockHash":"0x0a","transactionHash":%q,"transactionIndex":"0x0","logIndex":"0x%x"}`, tx, index)
+}
+
+func TestFetchLogsEnrichment(t *testing.T) {
+	srv := enrichServer(t, false)
+	defer srv.Close()
+	c := New(srv.URL, WithBlockTimestamps(16), WithTxMetadata(16))
+
+	from, to := uint64(10), uint64(10)
+	logs, err := c.FetchLogs(context.Background(), filter.Query{FromBlock: &from, ToBlock: &to})
+	if err != nil {
+		t.Fatalf("FetchLogs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs, want 2", len(logs))
+	}
+	for _, log := range logs {
+		if log.Timestamp.Unix() != 100 {
+			t.Errorf("log %d timestamp = %v, want 100", log.LogIndex, log.Timestamp.Unix())
+		}
+	}
+	if md := logs[0].Metadata; md == nil || md.GasUsed != 21000 {
+		t.Errorf("metadata of the first log = %+v, want gas used 21000", md)
+	}
+	if md := logs[1].Metadata; md != nil {
+		t.Errorf("metadata of the log without a receipt = %+v, want nil", md)
+	}
+}
+
+func TestFetchLogsEnrichmentBatchFails(t *testing.T) {
+	srv := enrichServer(t, true)
+	defer srv.Close()
+	c := New(srv.URL, WithBlockTimestamps(16))
+
+	from, to := uint64(10), uint64(10)
+	if _, err := c.FetchLogs(context.Background(), filter.Query{FromBlock: &from, ToBlock: &to}); err == nil {
+		t.Error("FetchLogs succeeded with a failed batch, want an error")
+	}
+}
@@ -1,12 +1,19 @@
 package ethereum
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/hedeqiang/sonar/event"
 )
 
+// enrichDelay is how long a subscription that enriches logs holds the logs
+// of a block, waiting for more of them to enrich together, when no log of
+// another block arrives first.
+const enrichDelay = 50 * time.Millisecond
+
 // Subscription wraps a WebSocket subscription for Ethereum logs.
 type Subscription struct {
 	chainID string
@@ -15,15 +22,21 @@ type Subscription struct {
 	unsub   func()
 	done    chan struct{}
 	once    sync.Once
+
+	// enrich, if set, adds data such as block timestamps and transaction
+	// metadata to the logs of a block before they are delivered. Logs it
+	// cannot enrich are delivered as they are.
+	enrich func(context.Context, []event.Log)
 }
 
-func newSubscription(chainID string, raw <-chan []byte, unsub func()) *Subscription {
+func newSubscription(chainID string, raw <-chan []byte, unsub func(), enrich func(context.Context, []event.Log)) *Subscription {
 	s := &Subscription{
 		chainID: chainID,
 		logs:    make(chan event.Log, 64),
 		errs:    make(chan error, 1),
 		unsub:   unsub,
 		done:    make(chan struct{}),
+		enrich:  enrich,
 	}
 	go s.consume(raw)
 	return s
@@ -49,16 +62,63 @@ func (s *Subscription) Unsubscribe() {
 	})
 }
 
+// consume delivers the logs received on raw. If the subscription enriches
+// logs, the logs of a block are held until a log of another block arrives or
+// enrichDelay has passed, and enriched together.
 func (s *Subscription) consume(raw <-chan []byte) {
 	defer close(s.logs)
 	defer close(s.errs)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var (
+		pending []event.Log
+		timer   *time.Timer
+		expired <-chan time.Time // nil while no logs are pending
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	flush := func() bool {
+		expired = nil
+		if len(pending) == 0 {
+			return true
+		}
+		if s.enrich != nil {
+			s.enrich(ctx, pending)
+		}
+		for _, log := range pending {
+			select {
+			case s.logs <- log:
+			case <-s.done:
+				return false
+			}
+		}
+		pending = pending[:0]
+		return true
+	}
+
 	for {
 		select {
 		case <-s.done:
 			return
+		case <-expired:
+			if !flush() {
+				return
+			}
 		case msg, ok := <-raw:
 			if !ok {
+				flush()
 				return
 			}
 
@@ -87,10 +147,24 @@ func (s *Subscription) consume(raw <-chan []byte) {
 				continue
 			}
 
-			select {
-			case s.logs <- log:
-			case <-s.done:
-				return
+			if len(pending) > 0 && pending[0].BlockHash != log.BlockHash {
+				if !flush() {
+					return
+				}
+			}
+			pending = append(pending, log)
+			switch {
+			case s.enrich == nil:
+				if !flush() {
+					return
+				}
+			case expired == nil:
+				if timer == nil {
+					timer = time.NewTimer(enrichDelay)
+				} else {
+					timer.Reset(enrichDelay)
+				}
+				expired = timer.C
 			}
 		}
 	}
@@ -0,0 +1,85 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// notification returns a logs subscription notification for the log at
+// index in block n.
+func notification(n uint64, index int) []byte {
+	return fmt.Appendf(nil, `{"result":{"address":"0x01","topics":[],"data":"0x","blockNumber":"0x%x","blockHash":"0x%x","transactionHash":"0x01","transactionIndex":"0x0","logIndex":"0x%x"}}`, n, n, index)
+}
+
+func TestSubscriptionEnrichesPerBlock(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]uint64 // blocks of the logs of each enrich call
+	)
+	enrich := func(ctx context.Context, logs []event.Log) {
+		var blocks []uint64
+		for _, log := range logs {
+			blocks = append(blocks, log.BlockNumber)
+		}
+		mu.Lock()
+		batches = append(batches, blocks)
+		mu.Unlock()
+	}
+	raw := make(chan []byte)
+	sub := newSubscription("ethereum", raw, nil, enrich)
+	defer sub.Unsubscribe()
+
+	// The logs of block 1 are enriched once block 2 starts, and those of
+	// block 2 once enrichDelay has passed.
+	go func() {
+		for _, msg := range [][]byte{notification(1, 0), notification(1, 1), notification(2, 0)} {
+			raw <- msg
+		}
+	}()
+	var got []uint64
+	for range 3 {
+		select {
+		case log := <-sub.Logs():
+			got = append(got, log.BlockNumber)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out with logs of blocks %v", got)
+		}
+	}
+	if want := []uint64{1, 1, 2}; !slices.Equal(got, want) {
+		t.Errorf("delivered logs of blocks %v, want %v", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := [][]uint64{{1, 1}, {2}}
+	if !slices.EqualFunc(batches, want, slices.Equal) {
+		t.Errorf("enriched %v, want %v", batches, want)
+	}
+}
+
+func TestSubscriptionWithoutEnrichment(t *testing.T) {
+	raw := make(chan []byte, 1)
+	sub := newSubscription("ethereum", raw, nil, nil)
+	defer sub.Unsubscribe()
+
+	raw <- notification(1, 0)
+	select {
+	case log := <-sub.Logs():
+		if log.BlockNumber != 1 {
+			t.Errorf("delivered block %d, want 1", log.BlockNumber)
+		}
+	case <-time.After(enrichDelay / 2):
+		t.Error("a log was held back without enrichment")
+	}
+
+	close(raw)
+	if _, ok := <-sub.Logs(); ok {
+		t.Error("Logs still open after the raw channel closed")
+	}
+}
@@ -0,0 +1,86 @@
+package ethereum
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/internal/lru"
+	"github.com/hedeqiang/sonar/transport"
+)
+
+// maxBatchCalls is the largest number of calls sent in one JSON-RPC batch;
+// providers commonly reject larger batches.
+const maxBatchCalls = 100
+
+// WithBlockTimestamps sets Timestamp on the logs returned by FetchLogs and
+// delivered by Subscribe. The headers of the blocks in each result are
+// fetched in batched eth_getBlockByHash calls and cached by block hash; the
+// cache holds the timestamps of up to cacheSize blocks. Logs of a block whose
+// header the node does not return are left without a timestamp, and the
+// failure is logged.
+func WithBlockTimestamps(cacheSize int) Option {
+	return func(c *Client) {
+		c.timestamps = lru.New[event.Hash, time.Time](cacheSize)
+	}
+}
+
+// fillTimestamps sets the block timestamp of every log, fetching the headers
+// of blocks that are not cached. Logs of blocks the node does not return keep
+// a zero timestamp. It is a no-op unless WithBlockTimestamps is set.
+func (c *Client) fillTimestamps(ctx context.Context, logs []event.Log) error {
+	if c.timestamps == nil || len(logs) == 0 {
+		return nil
+	}
+
+	found := make(map[event.Hash]time.Time)
+	var missing []event.Hash
+	for _, log := range logs {
+		if _, ok := found[log.BlockHash]; ok {
+			continue
+		}
+		if ts, ok := c.timestamps.Get(log.BlockHash); ok {
+			found[log.BlockHash] = ts
+			continue
+		}
+		found[log.BlockHash] = time.Time{}
+		missing = append(missing, log.BlockHash)
+	}
+
+	for start := 0; start < len(missing); start += maxBatchCalls {
+		end := min(start+maxBatchCalls, len(missing))
+		chunk := missing[start:end]
+
+		reqs := make([]transport.BatchRequest, len(chunk))
+		for i, hash := range chunk {
+			reqs[i] = transport.BatchRequest{
+				Method: "eth_getBlockByHash",
+				Params: []interface{}{hash.Hex(), false},
+			}
+		}
+		resps, err := transport.Batch(ctx, c.transport, reqs)
+		if err != nil {
+			return fmt.Errorf("ethereum: fetch block headers: %w", err)
+		}
+		for i, resp := range resps {
+			hash := chunk[i].Hex()
+			if resp.Err != nil {
+				c.warn("block timestamp unavailable", "block_hash", hash, "error", resp.Err)
+				continue
+			}
+			h, err := parseHeader(resp.Result, hash)
+			if err != nil {
+				c.warn("block timestamp unavailable", "block_hash", hash, "error", err)
+				continue
+			}
+			found[chunk[i]] = h.Timestamp
+			c.timestamps.Add(chunk[i], h.Timestamp)
+		}
+	}
+
+	for i := range logs {
+		logs[i].Timestamp = found[logs[i].BlockHash]
+	}
+	return nil
+}
@@ -3,10 +3,13 @@
 package polygon
 
 import (
+	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/chain/ethereum"
 )
 
-// New creates a Polygon chain client.
-func New(rpcURL string) *ethereum.Client {
-	return ethereum.NewWithID("polygon", rpcURL)
+// New creates a Polygon chain client. Watchers that configure neither a
+// finality mode nor confirmations default to the "finalized" block, which
+// tracks Heimdall milestones.
+func New(rpcURL string, opts ...ethereum.Option) *ethereum.Client {
+	return ethereum.NewWithID("polygon", rpcURL, append([]ethereum.Option{ethereum.WithDefaultFinality(chain.TagFinalized)}, opts...)...)
 }
@@ -0,0 +1,71 @@
+// Command sonar-coverage prints the block ranges recorded in a coverage file
+// written by coverage.NewFile, and the gaps between them.
+//
+// Usage:
+//
+//	go run ./cmd/sonar-coverage -file ./data/coverage.json [-key ethereum:3f2a...] [-gaps]
+//
+// Each line holds a cursor key, "covered" or "gap", the first and last block
+// of the range and its number of blocks, in aligned columns. The command
+// exits with status 1 if any gap is found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hedeqiang/sonar/coverage"
+)
+
+func main() {
+	path := flag.String("file", "", "coverage file written by coverage.NewFile")
+	key := flag.String("key", "", "print only this cursor key")
+	gapsOnly := flag.Bool("gaps", false, "print only gaps")
+	flag.Parse()
+
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if _, err := os.Stat(*path); err != nil {
+		log.Fatal(err)
+	}
+
+	store := coverage.NewFile(*path)
+	keys := []string{*key}
+	if *key == "" {
+		var err error
+		if keys, err = store.Keys(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	gaps := 0
+	for _, k := range keys {
+		ranges, err := store.Load(k)
+		if err != nil {
+			log.Fatal(err)
+		}
+		set := coverage.NewSet(ranges...)
+		if !*gapsOnly {
+			for _, r := range set.Ranges() {
+				fmt.Fprintf(w, "%s\tcovered\t%d\t%d\t%d\n", k, r.From, r.To, r.Blocks())
+			}
+		}
+		for _, g := range set.Gaps() {
+			fmt.Fprintf(w, "%s\tgap\t%d\t%d\t%d\n", k, g.From, g.To, g.Blocks())
+			gaps++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+
+	if gaps > 0 {
+		os.Exit(1)
+	}
+}
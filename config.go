@@ -1,27 +1,71 @@
 package sonar
 
 import (
+	"log/slog"
 	"time"
 
 	"github.com/hedeqiang/sonar/watcher"
 )
 
+// WatchMode selects how Watch receives event logs.
+type WatchMode int
+
+const (
+	// ModePoll fetches block ranges over RPC at a fixed interval.
+	ModePoll WatchMode = iota
+	// ModeStream receives logs through a real-time subscription (WebSocket).
+	ModeStream
+	// ModeHybrid streams logs and backfills missed blocks over RPC after
+	// every disconnect.
+	ModeHybrid
+	// ModeHeads polls block headers, and polls again as soon as a newHeads
+	// subscription reports a block. It is the mode of block watches that
+	// subscribe; Watch treats it as ModePoll.
+	ModeHeads
+)
+
+// String returns the lower-case name of the mode.
+func (m WatchMode) String() string {
+	switch m {
+	case ModePoll:
+		return "poll"
+	case ModeStream:
+		return "stream"
+	case ModeHybrid:
+		return "hybrid"
+	case ModeHeads:
+		return "heads"
+	default:
+		return "unknown"
+	}
+}
+
 // Config holds the global configuration for a Sonar instance.
 type Config struct {
+	// Mode selects how Watch receives logs. Defaults to ModePoll.
+	Mode WatchMode
+
 	// Poller configures the default polling behavior.
 	Poller watcher.PollerConfig
 
 	// LogLevel controls log verbosity ("debug", "info", "warn", "error").
+	// Records below it are dropped whatever Logger is set.
 	LogLevel string
+
+	// Logger receives structured logs from Sonar, its watchers and chain
+	// transports. Defaults to a text logger on stderr.
+	Logger *slog.Logger
 }
 
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() Config {
 	return Config{
+		Mode: ModePoll,
 		Poller: watcher.PollerConfig{
 			Interval:      2 * time.Second,
 			BatchSize:     1000,
 			Confirmations: 0,
+			ReorgDepth:    64,
 		},
 		LogLevel: "info",
 	}
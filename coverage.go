@@ -0,0 +1,250 @@
+package sonar
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hedeqiang/sonar/coverage"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+// coverageState is the coverage recorded under one key, cached from the
+// coverage store.
+type coverageState struct {
+	covered *coverage.Set
+	known   *coverage.Set // gaps already reported
+}
+
+// Coverage returns the block ranges recorded as fully processed under the
+// given cursor key, merged and in block order. Watches record the ranges
+// they complete under their cursor key, and replays under the key set with
+// WithCursorKey, or CursorKey(chain, query) if none is set.
+func (s *Sonar) Coverage(key string) ([]coverage.Range, error) {
+	s.covMu.Lock()
+	defer s.covMu.Unlock()
+	st, err := s.coverageFor(key)
+	if err != nil {
+		return nil, err
+	}
+	return st.covered.Ranges(), nil
+}
+
+// Gaps returns the block ranges missing between the ranges recorded under
+// the given cursor key, i.e. blocks skipped after processing had moved past
+// them, in block order.
+func (s *Sonar) Gaps(key string) ([]coverage.Range, error) {
+	s.covMu.Lock()
+	defer s.covMu.Unlock()
+	st, err := s.coverageFor(key)
+	if err != nil {
+		return nil, err
+	}
+	return st.covered.Gaps(), nil
+}
+
+// coverageFor returns the cached coverage of key, loading it from the store
+// on first use. Coverage that is corrupt is logged and started over, as it
+// only serves gap detection. Callers hold s.covMu.
+func (s *Sonar) coverageFor(key string) (*coverageState, error) {
+	if st, ok := s.covered[key]; ok {
+		return st, nil
+	}
+	ranges, err := s.coverage.Load(key)
+	if errors.Is(err, coverage.ErrCorrupt) {
+		s.logger.Warn("coverage unreadable, starting empty", "cursor_key", key, "error", err)
+		ranges, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sonar: load coverage: %w", err)
+	}
+	st := &coverageState{covered: coverage.NewSet(ranges...), known: &coverage.Set{}}
+	s.covered[key] = st
+	return st, nil
+}
+
+// loadCoverage loads the coverage of key, so that a watch fails to start if
+// its coverage store cannot be reached.
+func (s *Sonar) loadCoverage(key string) error {
+	s.covMu.Lock()
+	defer s.covMu.Unlock()
+	_, err := s.coverageFor(key)
+	return err
+}
+
+// trackCoverage records the ranges the watcher of h completes under its
+// cursor key and reports the gaps its coverage already has.
+func (s *Sonar) trackCoverage(h *Handle) {
+	cr, ok := h.w.(watcher.CoverageReporter)
+	key := h.CursorKey()
+	if !ok || key == "" {
+		return
+	}
+	cr.OnCovered(func(from, to uint64) {
+		s.repair(h, s.cover(h.chain, h.id, h.CursorKey(), coverage.Range{From: from, To: to}))
+	})
+
+	s.covMu.Lock()
+	gaps := s.newGaps(h.chain, h.id, key)
+	s.covMu.Unlock()
+	s.repair(h, gaps)
+}
+
+// moveCoverage records the coverage of from under to as well, once the
+// cursor key of h has changed from one to the other, so that a restart with
+// the new key finds it. Gaps already reported under from are not reported
+// again.
+func (s *Sonar) moveCoverage(h *Handle, from, to string) {
+	s.covMu.Lock()
+	src, err := s.coverageFor(from)
+	var dst *coverageState
+	if err == nil {
+		dst, err = s.coverageFor(to)
+	}
+	if err != nil {
+		s.covMu.Unlock()
+		s.reportError(h.chain, h.id, err)
+		return
+	}
+	for _, g := range src.known.Ranges() {
+		dst.known.Add(g)
+	}
+	ranges := src.covered.Ranges()
+	s.covMu.Unlock()
+
+	if len(ranges) > 0 {
+		s.repair(h, s.cover(h.chain, h.id, to, ranges...))
+	}
+}
+
+// pendingCoverage is the coverage recorded under one key and not yet
+// written to the coverage store, with the watch to report write errors to.
+type pendingCoverage struct {
+	chainID, watchID string
+	ranges           *coverage.Set
+}
+
+// cover records ranges under key and returns the gaps of key not reported
+// before. The watch ID is empty for replays. The ranges are written to the
+// coverage store by flushCoverage, outside s.covMu.
+func (s *Sonar) cover(chainID, watchID, key string, ranges ...coverage.Range) []coverage.Range {
+	s.covMu.Lock()
+	st, err := s.coverageFor(key)
+	if err != nil {
+		s.covMu.Unlock()
+		s.reportError(chainID, watchID, err)
+		return nil
+	}
+	p, ok := s.covPending[key]
+	if !ok {
+		p = &pendingCoverage{ranges: &coverage.Set{}}
+		s.covPending[key] = p
+	}
+	p.chainID, p.watchID = chainID, watchID
+	for _, r := range ranges {
+		st.covered.Add(r)
+		p.ranges.Add(r)
+	}
+	gaps := s.newGaps(chainID, watchID, key)
+	start := s.covFlush == nil
+	if start {
+		s.covFlush = make(chan struct{})
+	}
+	s.covMu.Unlock()
+
+	if start {
+		go s.flushCoverage()
+	}
+	return gaps
+}
+
+// flushCoverage writes the pending coverage to the coverage store until
+// none is left. Ranges recorded while a write is in flight are merged and
+// written by the next one, so that a slow store is written once per round
+// rather than once per completed range. Only one flush runs at a time.
+func (s *Sonar) flushCoverage() {
+	for {
+		s.covMu.Lock()
+		pending := s.covPending
+		if len(pending) == 0 {
+			close(s.covFlush)
+			s.covFlush = nil
+			s.covMu.Unlock()
+			return
+		}
+		s.covPending = make(map[string]*pendingCoverage)
+		s.covMu.Unlock()
+
+		if b, ok := s.coverage.(coverage.Batcher); ok {
+			batch := make(map[string][]coverage.Range, len(pending))
+			for key, p := range pending {
+				batch[key] = p.ranges.Ranges()
+			}
+			if err := b.AddBatch(batch); err != nil {
+				for key, p := range pending {
+					s.reportError(p.chainID, p.watchID, fmt.Errorf("sonar: record coverage %v: %w", batch[key], err))
+				}
+			}
+			continue
+		}
+		for key, p := range pending {
+			for _, r := range p.ranges.Ranges() {
+				if err := s.coverage.Add(key, r); err != nil {
+					s.reportError(p.chainID, p.watchID, fmt.Errorf("sonar: record coverage %s: %w", r, err))
+				}
+			}
+		}
+	}
+}
+
+// waitCoverage waits for the running flush, if any, to store the pending
+// coverage.
+func (s *Sonar) waitCoverage() {
+	s.covMu.Lock()
+	flush := s.covFlush
+	s.covMu.Unlock()
+	if flush != nil {
+		<-flush
+	}
+}
+
+// newGaps returns the gaps of key not reported before, logging each. The
+// coverage of key is loaded. Callers hold s.covMu.
+func (s *Sonar) newGaps(chainID, watchID, key string) []coverage.Range {
+	st := s.covered[key]
+	var gaps []coverage.Range
+	for _, g := range st.covered.Gaps() {
+		if st.known.Contains(g) {
+			continue
+		}
+		st.known.Add(g)
+		gaps = append(gaps, g)
+		s.logger.Warn("coverage gap detected", "chain", chainID, "watch", watchID, "cursor_key", key, "from_block", g.From, "to_block", g.To)
+	}
+	return gaps
+}
+
+// repair schedules backfills of gaps with the current query of h, if gap
+// repair is enabled and the watcher can backfill. Backfills are scheduled
+// from another goroutine, as the watcher reports coverage while it holds
+// off query updates and backfills.
+func (s *Sonar) repair(h *Handle, gaps []coverage.Range) {
+	if !s.repairGaps || len(gaps) == 0 {
+		return
+	}
+	b, ok := h.w.(watcher.Backfiller)
+	if !ok {
+		return
+	}
+	go func() {
+		select {
+		case <-h.done:
+			return
+		default:
+		}
+		q := h.Query()
+		for _, g := range gaps {
+			b.Backfill(q, g.From, g.To, nil)
+			s.logger.Info("gap repair scheduled", "chain", h.chain, "watch", h.id, "from_block", g.From, "to_block", g.To)
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+// Package coverage records the block ranges a watch has fully processed, so
+// that ranges it skipped, e.g. after its cursor was edited by hand or a
+// replay failed part way, show up as gaps.
+package coverage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Range is an inclusive range of block numbers.
+type Range struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// Blocks returns the number of blocks in r.
+func (r Range) Blocks() uint64 {
+	return r.To - r.From + 1
+}
+
+// String formats r as "[from, to]".
+func (r Range) String() string {
+	return fmt.Sprintf("[%d, %d]", r.From, r.To)
+}
+
+// Store persists coverage per key, e.g. per watch cursor key.
+type Store interface {
+	// Load returns the ranges stored under key, merged and in block order.
+	Load(key string) ([]Range, error)
+
+	// Add records r as covered under key.
+	Add(key string, r Range) error
+}
+
+// Batcher is implemented by stores that record the ranges of several keys
+// in one write, e.g. File, which replaces its file on each write.
+type Batcher interface {
+	// AddBatch records each of the ranges as covered under its key.
+	AddBatch(ranges map[string][]Range) error
+}
+
+// Set is a set of blocks kept as sorted, non-overlapping, non-adjacent
+// ranges. The zero value is an empty set.
+type Set struct {
+	ranges []Range
+}
+
+// NewSet returns a set of the given ranges, which may overlap and be in any
+// order.
+func NewSet(ranges ...Range) *Set {
+	s := &Set{}
+	for _, r := range ranges {
+		s.Add(r)
+	}
+	return s
+}
+
+// Add adds the blocks of r, merging it with the ranges it overlaps or
+// touches. Ranges with From after To are ignored.
+func (s *Set) Add(r Range) {
+	if r.From > r.To {
+		return
+	}
+	// First range that ends at or after the block before r; ranges before it
+	// neither overlap nor touch r.
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return r.From == 0 || s.ranges[i].To >= r.From-1
+	})
+	j := i
+	for j < len(s.ranges) && (r.To == ^uint64(0) || s.ranges[j].From <= r.To+1) {
+		if s.ranges[j].From < r.From {
+			r.From = s.ranges[j].From
+		}
+		if s.ranges[j].To > r.To {
+			r.To = s.ranges[j].To
+		}
+		j++
+	}
+	s.ranges = append(s.ranges[:i], append([]Range{r}, s.ranges[j:]...)...)
+}
+
+// Contains reports whether every block of r is in the set.
+func (s *Set) Contains(r Range) bool {
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].To >= r.From
+	})
+	return i < len(s.ranges) && s.ranges[i].From <= r.From && s.ranges[i].To >= r.To
+}
+
+// Ranges returns the ranges of the set in block order.
+func (s *Set) Ranges() []Range {
+	out := make([]Range, len(s.ranges))
+	copy(out, s.ranges)
+	return out
+}
+
+// Gaps returns the ranges missing between the first and last block of the
+// set, in block order. Blocks before the first range or after the last are
+// not gaps.
+func (s *Set) Gaps() []Range {
+	var gaps []Range
+	for i := 1; i < len(s.ranges); i++ {
+		gaps = append(gaps, Range{From: s.ranges[i-1].To + 1, To: s.ranges[i].From - 1})
+	}
+	return gaps
+}
@@ -0,0 +1,92 @@
+package coverage
+
+import (
+	"slices"
+	"testing"
+)
+
+const maxBlock = ^uint64(0)
+
+func TestSetAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		add  []Range
+		want []Range
+	}{
+		{name: "empty", want: nil},
+		{name: "single", add: []Range{{5, 9}}, want: []Range{{5, 9}}},
+		{name: "disjoint kept apart", add: []Range{{20, 29}, {1, 9}}, want: []Range{{1, 9}, {20, 29}}},
+		{name: "adjacent after", add: []Range{{1, 9}, {10, 19}}, want: []Range{{1, 19}}},
+		{name: "adjacent before", add: []Range{{10, 19}, {1, 9}}, want: []Range{{1, 19}}},
+		{name: "overlapping", add: []Range{{1, 10}, {5, 15}}, want: []Range{{1, 15}}},
+		{name: "overlapping from before", add: []Range{{5, 15}, {1, 10}}, want: []Range{{1, 15}}},
+		{name: "contained", add: []Range{{1, 20}, {5, 10}}, want: []Range{{1, 20}}},
+		{name: "containing", add: []Range{{5, 10}, {1, 20}}, want: []Range{{1, 20}}},
+		{name: "duplicate", add: []Range{{5, 10}, {5, 10}}, want: []Range{{5, 10}}},
+		{name: "bridges a gap", add: []Range{{1, 9}, {20, 29}, {10, 19}}, want: []Range{{1, 29}}},
+		{name: "spans several", add: []Range{{1, 2}, {5, 6}, {9, 10}, {20, 30}, {2, 9}}, want: []Range{{1, 10}, {20, 30}}},
+		{name: "one block apart", add: []Range{{1, 9}, {11, 19}}, want: []Range{{1, 9}, {11, 19}}},
+		{name: "single blocks merge", add: []Range{{3, 3}, {5, 5}, {4, 4}}, want: []Range{{3, 5}}},
+		{name: "inverted ignored", add: []Range{{1, 5}, {9, 7}}, want: []Range{{1, 5}}},
+		{name: "from block zero", add: []Range{{1, 5}, {0, 0}}, want: []Range{{0, 5}}},
+		{name: "up to the last block", add: []Range{{maxBlock - 1, maxBlock}, {maxBlock - 5, maxBlock - 2}}, want: []Range{{maxBlock - 5, maxBlock}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewSet(tt.add...).Ranges()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ranges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetGaps(t *testing.T) {
+	tests := []struct {
+		name string
+		add  []Range
+		want []Range
+	}{
+		{name: "empty", want: nil},
+		{name: "single range", add: []Range{{100, 200}}, want: nil},
+		{name: "adjacent ranges", add: []Range{{1, 9}, {10, 19}}, want: nil},
+		{name: "overlapping ranges", add: []Range{{1, 12}, {10, 19}}, want: nil},
+		{name: "contained range", add: []Range{{1, 20}, {5, 10}}, want: nil},
+		{name: "one gap", add: []Range{{1, 9}, {20, 29}}, want: []Range{{10, 19}}},
+		{name: "single-block gap", add: []Range{{1, 9}, {11, 19}}, want: []Range{{10, 10}}},
+		{name: "several gaps", add: []Range{{30, 39}, {1, 9}, {20, 24}}, want: []Range{{10, 19}, {25, 29}}},
+		{name: "gap filled", add: []Range{{1, 9}, {20, 29}, {10, 19}}, want: nil},
+		{name: "gap partly filled", add: []Range{{1, 9}, {20, 29}, {12, 15}}, want: []Range{{10, 11}, {16, 19}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewSet(tt.add...).Gaps()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("gaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetContains(t *testing.T) {
+	s := NewSet(Range{10, 19}, Range{30, 39})
+
+	tests := []struct {
+		r    Range
+		want bool
+	}{
+		{Range{10, 19}, true},
+		{Range{12, 15}, true},
+		{Range{19, 19}, true},
+		{Range{5, 12}, false},
+		{Range{15, 25}, false},
+		{Range{15, 35}, false},
+		{Range{20, 29}, false},
+		{Range{40, 50}, false},
+	}
+	for _, tt := range tests {
+		if got := s.Contains(tt.r); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
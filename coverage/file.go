@@ -0,0 +1,119 @@
+package coverage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ErrCorrupt is returned by File when its file cannot be parsed.
+var ErrCorrupt = errors.New("coverage: corrupt file")
+
+// File is a Store that keeps the merged ranges of every key in one JSON
+// file, replaced on each Add or AddBatch. Merging keeps the file small: a watch that
+// never skips a block has a single range.
+//
+// A file that cannot be parsed makes Load and Keys fail with ErrCorrupt.
+// The next Add moves it aside to path + ".corrupt" and starts over.
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFile creates a file-backed store. The directory containing path will be
+// created if it does not exist.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Load returns the ranges stored under key, merged and in block order.
+func (f *File) Load(key string) ([]Range, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+	return data[key], nil
+}
+
+// Keys returns the keys with stored coverage, sorted.
+func (f *File) Keys() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Add records r as covered under key and replaces the file.
+func (f *File) Add(key string, r Range) error {
+	return f.AddBatch(map[string][]Range{key: {r}})
+}
+
+// AddBatch records each of the ranges as covered under its key and replaces
+// the file once.
+func (f *File) AddBatch(ranges map[string][]Range) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := f.readAll()
+	if errors.Is(err, ErrCorrupt) {
+		if err := os.Rename(f.path, f.path+".corrupt"); err != nil {
+			return err
+		}
+		data, err = make(map[string][]Range), nil
+	}
+	if err != nil {
+		return err
+	}
+	for key, rs := range ranges {
+		set := NewSet(data[key]...)
+		for _, r := range rs {
+			set.Add(r)
+		}
+		data[key] = set.Ranges()
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("coverage: marshal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func (f *File) readAll() (map[string][]Range, error) {
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string][]Range), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string][]Range)
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorrupt, f.path, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,88 @@
+package coverage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "coverage.json")
+	f := NewFile(path)
+
+	for _, r := range []Range{{1, 9}, {20, 29}, {10, 12}} {
+		if err := f.Add("a", r); err != nil {
+			t.Fatalf("Add(%s): %v", r, err)
+		}
+	}
+	if err := f.Add("b", Range{5, 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewFile(path).Load("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Range{{1, 12}, {20, 29}}; !slices.Equal(got, want) {
+		t.Errorf("Load(a) = %v, want %v", got, want)
+	}
+	keys, err := f.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(keys, want) {
+		t.Errorf("Keys = %v, want %v", keys, want)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestFileCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	corrupt := []byte(`{"a": [{"from": 1, "to"`)
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFile(path)
+
+	if _, err := f.Load("a"); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Load error = %v, want ErrCorrupt", err)
+	}
+	if err := f.Add("a", Range{5, 9}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	got, err := f.Load("a")
+	if err != nil {
+		t.Fatalf("Load after Add: %v", err)
+	}
+	if want := []Range{{5, 9}}; !slices.Equal(got, want) {
+		t.Errorf("Load(a) = %v, want %v", got, want)
+	}
+	if saved, err := os.ReadFile(path + ".corrupt"); err != nil || string(saved) != string(corrupt) {
+		t.Errorf("corrupt file not kept aside: %q, %v", saved, err)
+	}
+}
+
+func TestFileAddBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coverage.json")
+	f := NewFile(path)
+	if err := f.Add("a", Range{1, 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddBatch(map[string][]Range{"a": {{20, 29}, {10, 12}}, "b": {{5, 5}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string][]Range{"a": {{1, 12}, {20, 29}}, "b": {{5, 5}}} {
+		got, err := NewFile(path).Load(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Load(%s) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package coverage
+
+import "sync"
+
+// Memory is an in-memory Store implementation.
+// Suitable for development and testing; coverage is lost on restart.
+type Memory struct {
+	mu   sync.Mutex
+	sets map[string]*Set
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{sets: make(map[string]*Set)}
+}
+
+// Load returns the ranges stored under key, merged and in block order.
+func (m *Memory) Load(key string) ([]Range, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sets[key]; ok {
+		return s.Ranges(), nil
+	}
+	return nil, nil
+}
+
+// Add records r as covered under key.
+func (m *Memory) Add(key string, r Range) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sets[key]
+	if !ok {
+		s = &Set{}
+		m.sets[key] = s
+	}
+	s.Add(r)
+	return nil
+}
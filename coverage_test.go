@@ -0,0 +1,84 @@
+package sonar
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/coverage"
+)
+
+// slowCoverage is a coverage store whose writes block until released.
+type slowCoverage struct {
+	*coverage.Memory
+	writing chan struct{} // receives when a write starts
+	release chan struct{}
+
+	mu      sync.Mutex
+	batches []map[string][]coverage.Range
+}
+
+func (c *slowCoverage) AddBatch(ranges map[string][]coverage.Range) error {
+	c.writing <- struct{}{}
+	<-c.release
+	c.mu.Lock()
+	c.batches = append(c.batches, ranges)
+	c.mu.Unlock()
+	for key, rs := range ranges {
+		for _, r := range rs {
+			c.Memory.Add(key, r)
+		}
+	}
+	return nil
+}
+
+func TestCoverWritesOutsideLock(t *testing.T) {
+	st := &slowCoverage{Memory: coverage.NewMemory(), writing: make(chan struct{}, 2), release: make(chan struct{})}
+	s := newTestSonar(WithCoverage(st))
+
+	// The first range starts a write that blocks; the ranges recorded
+	// meanwhile neither wait for it nor for each other.
+	s.cover("test", "w1", "pools", coverage.Range{From: 1, To: 10})
+	<-st.writing
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		for _, r := range []coverage.Range{{From: 11, To: 20}, {From: 21, To: 30}} {
+			s.cover("test", "w1", "pools", r)
+		}
+		s.cover("test", "w2", "other", coverage.Range{From: 5, To: 6})
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Fatal("recording coverage waited for the store")
+	}
+	if got, _ := s.Coverage("pools"); !slices.Equal(got, []coverage.Range{{From: 1, To: 30}}) {
+		t.Errorf("Coverage while writing = %v, want [1, 30]", got)
+	}
+
+	close(st.release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// The ranges recorded during the first write are merged into a second.
+	st.mu.Lock()
+	batches := len(st.batches)
+	st.mu.Unlock()
+	if batches != 2 {
+		t.Errorf("%d writes, want 2", batches)
+	}
+	for key, want := range map[string][]coverage.Range{
+		"pools": {{From: 1, To: 30}},
+		"other": {{From: 5, To: 6}},
+	} {
+		if got, _ := st.Load(key); !slices.Equal(got, want) {
+			t.Errorf("stored %s = %v, want %v", key, got, want)
+		}
+	}
+}
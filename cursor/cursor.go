@@ -1,8 +1,9 @@
 // Package cursor provides progress tracking for event log scanning.
 package cursor
 
-// Cursor tracks the last processed block for each chain,
-// allowing resumable event scanning.
+// Cursor tracks the last processed block under a key, allowing resumable
+// event scanning. Watchers key progress by chain ID unless configured with a
+// per-watch key.
 type Cursor interface {
 	// Load returns the last saved block number for the given chain ID.
 	// Returns 0 if no progress has been saved.
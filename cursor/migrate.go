@@ -0,0 +1,36 @@
+package cursor
+
+import "fmt"
+
+// Migrate moves the progress saved under fromKey to toKey, e.g. to carry a
+// chain-keyed checkpoint over to a per-watch key, and then clears fromKey by
+// saving zero, so that the progress is carried over once even if several
+// keys are migrated from fromKey. Nothing is moved if fromKey has no
+// progress or toKey already has some, so Migrate is safe to call on every
+// start. It reports whether progress was moved.
+func Migrate(c Cursor, fromKey, toKey string) (bool, error) {
+	if fromKey == toKey {
+		return false, nil
+	}
+	existing, err := c.Load(toKey)
+	if err != nil {
+		return false, fmt.Errorf("cursor: load %s: %w", toKey, err)
+	}
+	if existing > 0 {
+		return false, nil
+	}
+	block, err := c.Load(fromKey)
+	if err != nil {
+		return false, fmt.Errorf("cursor: load %s: %w", fromKey, err)
+	}
+	if block == 0 {
+		return false, nil
+	}
+	if err := c.Save(toKey, block); err != nil {
+		return false, fmt.Errorf("cursor: save %s: %w", toKey, err)
+	}
+	if err := c.Save(fromKey, 0); err != nil {
+		return true, fmt.Errorf("cursor: clear %s: %w", fromKey, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,65 @@
+package cursor
+
+import "testing"
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name         string
+		from, to     uint64 // saved before migrating; 0 for none
+		wantMoved    bool
+		wantFrom     uint64
+		wantTo       uint64
+		sameKeyTwice bool // migrate to a second key afterwards
+	}{
+		{name: "moves progress", from: 100, wantMoved: true, wantTo: 100},
+		{name: "nothing to move", wantTo: 0},
+		{name: "target has progress", from: 100, to: 50, wantFrom: 100, wantTo: 50},
+		{name: "second key gets nothing", from: 100, wantMoved: true, wantTo: 100, sameKeyTwice: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemory()
+			if tt.from > 0 {
+				c.Save("ethereum", tt.from)
+			}
+			if tt.to > 0 {
+				c.Save("watch-a", tt.to)
+			}
+
+			moved, err := Migrate(c, "ethereum", "watch-a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != tt.wantMoved {
+				t.Errorf("moved = %v, want %v", moved, tt.wantMoved)
+			}
+			if got, _ := c.Load("ethereum"); got != tt.wantFrom {
+				t.Errorf("chain-keyed progress = %d, want %d", got, tt.wantFrom)
+			}
+			if got, _ := c.Load("watch-a"); got != tt.wantTo {
+				t.Errorf("migrated progress = %d, want %d", got, tt.wantTo)
+			}
+
+			if tt.sameKeyTwice {
+				moved, err := Migrate(c, "ethereum", "watch-b")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := c.Load("watch-b"); moved || got != 0 {
+					t.Errorf("second migration moved %v to block %d, want nothing", moved, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateSameKey(t *testing.T) {
+	c := NewMemory()
+	c.Save("ethereum", 100)
+	if moved, err := Migrate(c, "ethereum", "ethereum"); moved || err != nil {
+		t.Fatalf("Migrate to the same key = %v, %v; want false, nil", moved, err)
+	}
+	if got, _ := c.Load("ethereum"); got != 100 {
+		t.Errorf("progress = %d, want 100", got)
+	}
+}
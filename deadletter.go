@@ -0,0 +1,232 @@
+package sonar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hedeqiang/sonar/deadletter"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// deadLetterHandler wraps handler so that a log it keeps failing on is put in
+// the dead-letter queue and acknowledged, letting the watch move past it. A
+// log is dead-lettered after maxAttempts failed calls, or immediately when
+// the handler returns an error marked with retry.Permanent.
+//
+// Failed calls are counted per log until it is handled or dead-lettered.
+// If progress is set, counts of logs in blocks up to the block it returns,
+// the watch's cursor, are dropped: such logs were undone by a reorg and
+// will not come back. The watch ID is empty for replays; key returns the
+// cursor key of the watch, which is empty for streams, and is nil for
+// replays.
+func (s *Sonar) deadLetterHandler(chainID, watchID string, key func() string, progress func() uint64, maxAttempts int, handler func(event.Log) error) func(event.Log) error {
+	if s.deadLetters == nil {
+		return handler
+	}
+
+	type failure struct {
+		calls int
+		block uint64
+	}
+	var mu sync.Mutex
+	attempts := make(map[string]failure) // entry ID -> failed calls
+	return func(log event.Log) error {
+		err := handler(log)
+		id := deadletter.ID(watchID, log)
+
+		mu.Lock()
+		if progress != nil && len(attempts) > 0 {
+			cursor := progress()
+			for k, f := range attempts {
+				if f.block <= cursor {
+					delete(attempts, k)
+				}
+			}
+		}
+		if err == nil {
+			delete(attempts, id)
+			mu.Unlock()
+			return nil
+		}
+		f := attempts[id]
+		f.calls++
+		f.block = log.BlockNumber
+		attempts[id] = f
+		n := f.calls
+		mu.Unlock()
+
+		if n < maxAttempts && !retry.IsPermanent(err) {
+			return err
+		}
+
+		entry := deadletter.Entry{
+			ID:       id,
+			Chain:    chainID,
+			WatchID:  watchID,
+			Log:      log,
+			Err:      err.Error(),
+			Attempts: n,
+			Time:     time.Now(),
+		}
+		if key != nil {
+			entry.CursorKey = key()
+		}
+		if perr := s.deadLetters.Put(entry); perr != nil {
+			return fmt.Errorf("%w (dead-letter: %v)", err, perr)
+		}
+		mu.Lock()
+		delete(attempts, id)
+		mu.Unlock()
+		e := newWatchError(chainID, watchID, KindHandler,
+			fmt.Errorf("sonar: dead-lettered log %s in block %d after %d attempts: %w", id, log.BlockNumber, n, err))
+		e.FromBlock, e.ToBlock, e.Attempt = log.BlockNumber, log.BlockNumber, n
+		s.report(e)
+		return nil
+	}
+}
+
+// maxAttempts returns the number of failed calls after which a log is
+// dead-lettered. Watchers that do not deliver a failed log again give up once
+// the retry strategy is exhausted, so the limit is capped at the number of
+// attempts the strategy allows.
+func (s *Sonar) maxAttempts(strategy retry.Strategy, redelivers bool) int {
+	if redelivers {
+		return s.deadLetterAttempts
+	}
+	n := 1
+	for strategy != nil && n < s.deadLetterAttempts {
+		if _, ok := strategy.Next(n); !ok {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// DeadLetters lists the dead-lettered logs, oldest first.
+// Returns an empty list if no dead-letter queue is configured.
+func (s *Sonar) DeadLetters() ([]deadletter.Entry, error) {
+	if s.deadLetters == nil {
+		return nil, nil
+	}
+	return s.deadLetters.List()
+}
+
+// Redrive delivers dead-lettered logs again to the watches they came from,
+// through the middleware pipeline. Entries are removed once handled; entries
+// that fail again stay in the queue with their attempt count increased.
+// With no IDs, every entry is re-driven.
+//
+// Generated watch IDs depend on the order watches are started, so entries
+// are matched to the running watch on the same chain with their cursor key.
+// Entries without one, from streams, go to the watch with their watch ID
+// only if it was started with WithWatchID. Entries whose watch is not
+// running fail with ErrNotRunning.
+func (s *Sonar) Redrive(ctx context.Context, ids ...string) error {
+	if s.deadLetters == nil {
+		return fmt.Errorf("sonar: no dead-letter queue configured")
+	}
+	entries, err := s.deadLetters.List()
+	if err != nil {
+		return fmt.Errorf("sonar: list dead letters: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if len(ids) > 0 && !wanted[e.ID] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		h, err := s.redriveTarget(e)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if h.handler == nil {
+			errs = append(errs, fmt.Errorf("sonar: redrive %s: watch %s delivers batches", e.ID, e.WatchID))
+			continue
+		}
+
+		if err := buildHandler(h.handler, s.middlewares)(e.Log); err != nil {
+			e.Attempts++
+			e.Err = err.Error()
+			e.Time = time.Now()
+			if perr := s.deadLetters.Put(e); perr != nil {
+				err = fmt.Errorf("%w (dead-letter: %v)", err, perr)
+			}
+			errs = append(errs, fmt.Errorf("sonar: redrive %s: %w", e.ID, err))
+			continue
+		}
+		if err := s.deadLetters.Delete(e.ID); err != nil {
+			errs = append(errs, fmt.Errorf("sonar: redrive %s: %w", e.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// redriveTarget returns the running watch entry e is re-driven to: the one
+// on its chain with its cursor key, preferring its watch ID if several share
+// the key, or else the watch with its ID if that ID was chosen by the user.
+func (s *Sonar) redriveTarget(e deadletter.Entry) (*Handle, error) {
+	if e.CursorKey != "" {
+		var match *Handle
+		for _, h := range s.handles() {
+			if h.chain != e.Chain || h.CursorKey() != e.CursorKey {
+				continue
+			}
+			if match == nil || h.id == e.WatchID {
+				match = h
+			}
+		}
+		if match == nil {
+			return nil, fmt.Errorf("%w: no watch with cursor key %s (entry %s)", ErrNotRunning, e.CursorKey, e.ID)
+		}
+		return match, nil
+	}
+
+	s.mu.Lock()
+	h, ok := s.watchers[e.WatchID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (entry %s)", ErrNotRunning, e.WatchID, e.ID)
+	}
+	if !h.named {
+		return nil, fmt.Errorf("sonar: redrive %s: watch %s has a generated ID, which may name another watch after a restart; start it with WithWatchID", e.ID, e.WatchID)
+	}
+	return h, nil
+}
+
+// moveDeadLetters records the cursor key to on the dead-letter entries of h
+// recorded under from, once the cursor key of h has changed from one to the
+// other, so that they are re-driven to h after a restart with the new key.
+func (s *Sonar) moveDeadLetters(h *Handle, from, to string) {
+	if s.deadLetters == nil {
+		return
+	}
+	entries, err := s.deadLetters.List()
+	if err != nil {
+		s.reportError(h.chain, h.id, fmt.Errorf("sonar: list dead letters: %w", err))
+		return
+	}
+	for _, e := range entries {
+		if e.Chain != h.chain || e.WatchID != h.id || e.CursorKey != from {
+			continue
+		}
+		e.CursorKey = to
+		if err := s.deadLetters.Put(e); err != nil {
+			s.reportError(h.chain, h.id, fmt.Errorf("sonar: move dead letter %s: %w", e.ID, err))
+		}
+	}
+}
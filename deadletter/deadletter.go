@@ -0,0 +1,70 @@
+// Package deadletter stores event logs whose handlers kept failing, so that
+// processing can continue past them and they can be re-driven later.
+package deadletter
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// Entry is an event log that was given up on after repeated handler failures.
+type Entry struct {
+	// ID identifies the entry. The same log on the same watch always gets
+	// the same ID, so putting it again replaces the earlier entry.
+	ID string
+
+	// Chain is the chain the log came from.
+	Chain string
+
+	// WatchID is the watch the log was delivered to. Empty for replays.
+	WatchID string
+
+	// CursorKey is the cursor key of the watch the log was delivered to,
+	// which unlike a generated watch ID identifies the watch across
+	// restarts. Empty for streams and replays.
+	CursorKey string
+
+	// Log is the failed event log.
+	Log event.Log
+
+	// Err is the message of the last handler error.
+	Err string
+
+	// Attempts is the number of failed handler calls.
+	Attempts int
+
+	// Time is when the entry was last written.
+	Time time.Time
+}
+
+// Queue stores dead-lettered entries.
+type Queue interface {
+	// Put stores an entry, replacing any entry with the same ID.
+	Put(e Entry) error
+
+	// List returns all entries, oldest first.
+	List() ([]Entry, error)
+
+	// Delete removes the entries with the given IDs. Unknown IDs are ignored.
+	Delete(ids ...string) error
+}
+
+// ID returns the entry ID of log delivered to the given watch.
+func ID(watchID string, log event.Log) string {
+	h := sha256.New()
+	h.Write([]byte(watchID))
+	h.Write([]byte{0})
+	h.Write(log.BlockHash[:])
+	h.Write(log.TxHash[:])
+	var n [9]byte
+	binary.BigEndian.PutUint64(n[:8], uint64(log.LogIndex))
+	if log.Removed {
+		n[8] = 1
+	}
+	h.Write(n[:])
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
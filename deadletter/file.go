@@ -0,0 +1,225 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// File is a Queue that appends entries to a JSON Lines file. Putting an entry
+// again appends a newer record for its ID; Delete compacts the file.
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFile creates a file-backed queue. The directory containing path will be
+// created if it does not exist.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Put appends the entry to the file.
+func (f *File) Put(e Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line, err := json.Marshal(toRecord(e))
+	if err != nil {
+		return fmt.Errorf("deadletter: marshal entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// List returns all entries, oldest first.
+func (f *File) List() ([]Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readAll()
+}
+
+// Delete removes the entries with the given IDs by rewriting the file.
+func (f *File) Delete(ids ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	entries = without(entries, ids)
+
+	var b strings.Builder
+	for _, e := range entries {
+		line, err := json.Marshal(toRecord(e))
+		if err != nil {
+			return fmt.Errorf("deadletter: marshal entry: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// readAll reads the file, keeping the latest record of each ID at the
+// position of its first record.
+func (f *File) readAll() ([]Entry, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("deadletter: parse %s: %w", f.path, err)
+		}
+		e, err := r.toEntry()
+		if err != nil {
+			return nil, fmt.Errorf("deadletter: parse %s: %w", f.path, err)
+		}
+		if i, ok := index[e.ID]; ok {
+			entries[i] = e
+			continue
+		}
+		index[e.ID] = len(entries)
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// record is the JSON form of an Entry, with binary fields hex-encoded.
+type record struct {
+	ID       string    `json:"id"`
+	Chain    string    `json:"chain"`
+	WatchID  string    `json:"watchId,omitempty"`
+	Key      string    `json:"cursorKey,omitempty"`
+	Err      string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+	Log      logRecord `json:"log"`
+}
+
+type logRecord struct {
+	Chain       string    `json:"chain"`
+	Address     string    `json:"address"`
+	Topics      []string  `json:"topics"`
+	Data        string    `json:"data"`
+	BlockNumber uint64    `json:"blockNumber"`
+	BlockHash   string    `json:"blockHash"`
+	TxHash      string    `json:"transactionHash"`
+	TxIndex     uint      `json:"transactionIndex"`
+	LogIndex    uint      `json:"logIndex"`
+	Removed     bool      `json:"removed"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func toRecord(e Entry) record {
+	topics := make([]string, len(e.Log.Topics))
+	for i, t := range e.Log.Topics {
+		topics[i] = t.Hex()
+	}
+	return record{
+		ID:       e.ID,
+		Chain:    e.Chain,
+		WatchID:  e.WatchID,
+		Key:      e.CursorKey,
+		Err:      e.Err,
+		Attempts: e.Attempts,
+		Time:     e.Time,
+		Log: logRecord{
+			Chain:       e.Log.Chain,
+			Address:     e.Log.Address.Hex(),
+			Topics:      topics,
+			Data:        "0x" + hex.EncodeToString(e.Log.Data),
+			BlockNumber: e.Log.BlockNumber,
+			BlockHash:   e.Log.BlockHash.Hex(),
+			TxHash:      e.Log.TxHash.Hex(),
+			TxIndex:     e.Log.TxIndex,
+			LogIndex:    e.Log.LogIndex,
+			Removed:     e.Log.Removed,
+			Timestamp:   e.Log.Timestamp,
+		},
+	}
+}
+
+func (r record) toEntry() (Entry, error) {
+	log := event.Log{
+		Chain:       r.Log.Chain,
+		BlockNumber: r.Log.BlockNumber,
+		TxIndex:     r.Log.TxIndex,
+		LogIndex:    r.Log.LogIndex,
+		Removed:     r.Log.Removed,
+		Timestamp:   r.Log.Timestamp,
+	}
+	var err error
+	if log.Address, err = event.HexToAddress(r.Log.Address); err != nil {
+		return Entry{}, err
+	}
+	if log.BlockHash, err = event.HexToHash(r.Log.BlockHash); err != nil {
+		return Entry{}, err
+	}
+	if log.TxHash, err = event.HexToHash(r.Log.TxHash); err != nil {
+		return Entry{}, err
+	}
+	for _, t := range r.Log.Topics {
+		h, err := event.HexToHash(t)
+		if err != nil {
+			return Entry{}, err
+		}
+		log.Topics = append(log.Topics, h)
+	}
+	if log.Data, err = hex.DecodeString(strings.TrimPrefix(r.Log.Data, "0x")); err != nil {
+		return Entry{}, fmt.Errorf("invalid data: %w", err)
+	}
+
+	return Entry{
+		ID:        r.ID,
+		Chain:     r.Chain,
+		WatchID:   r.WatchID,
+		CursorKey: r.Key,
+		Log:       log,
+		Err:       r.Err,
+		Attempts:  r.Attempts,
+		Time:      r.Time,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package deadletter
+
+import "sync"
+
+// Memory is an in-memory Queue implementation.
+// Suitable for development and testing; entries are lost on restart.
+type Memory struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewMemory creates an empty in-memory queue.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Put stores an entry, replacing any entry with the same ID.
+func (m *Memory) Put(e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.entries {
+		if m.entries[i].ID == e.ID {
+			m.entries[i] = e
+			return nil
+		}
+	}
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// List returns all entries, oldest first.
+func (m *Memory) List() ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Entry, len(m.entries))
+	copy(out, m.entries)
+	return out, nil
+}
+
+// Delete removes the entries with the given IDs.
+func (m *Memory) Delete(ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = without(m.entries, ids)
+	return nil
+}
+
+// without returns entries minus those with the given IDs, reusing the slice.
+func without(entries []Entry, ids []string) []Entry {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !drop[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
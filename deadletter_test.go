@@ -0,0 +1,82 @@
+package sonar
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/deadletter"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+func TestDeadLetterRedrive(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		err          error
+		wantAttempts int
+	}{
+		{name: "after repeated failures", maxAttempts: 2, err: errors.New("db down"), wantAttempts: 2},
+		{name: "permanent failure", maxAttempts: 5, err: retry.Permanent(errors.New("bad payload")), wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &logChain{head: 10, logs: []event.Log{logAt(address(1), 3, 0), logAt(address(1), 5, 0)}}
+			s := newTestSonar(
+				WithDeadLetter(deadletter.NewMemory(), tt.maxAttempts),
+				WithRetry(&retry.Backoff{MaxAttempts: 3, InitialDelay: time.Millisecond}),
+				WithPollInterval(time.Millisecond),
+			)
+			defer s.Shutdown(context.Background())
+			if err := s.AddChain(c); err != nil {
+				t.Fatal(err)
+			}
+
+			var failing atomic.Bool
+			failing.Store(true)
+			got := newCollector()
+			q := filter.Query{Addresses: []event.Address{address(1)}}
+			h, err := s.WatchE("test", q, func(log event.Log) error {
+				if log.BlockNumber == 3 && failing.Load() {
+					return tt.err
+				}
+				return got.handle(log)
+			}, WithStartBlock(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The watch moves past the dead-lettered log.
+			if blocks := got.wait(t, 1); !slices.Equal(blocks, []uint64{5}) {
+				t.Fatalf("delivered blocks %v, want [5]", blocks)
+			}
+			entries, err := s.DeadLetters()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("dead letters %+v, want one", entries)
+			}
+			if e := entries[0]; e.Log.BlockNumber != 3 || e.Attempts != tt.wantAttempts || e.CursorKey != h.CursorKey() {
+				t.Errorf("entry for block %d after %d attempts under %s, want block 3 after %d under %s",
+					e.Log.BlockNumber, e.Attempts, e.CursorKey, tt.wantAttempts, h.CursorKey())
+			}
+
+			failing.Store(false)
+			if err := s.Redrive(context.Background()); err != nil {
+				t.Fatalf("Redrive: %v", err)
+			}
+			if blocks := got.wait(t, 2); !slices.Equal(blocks, []uint64{5, 3}) {
+				t.Errorf("delivered blocks %v after Redrive, want [5 3]", blocks)
+			}
+			if entries, _ := s.DeadLetters(); len(entries) != 0 {
+				t.Errorf("dead letters %+v after Redrive, want none", entries)
+			}
+		})
+	}
+}
@@ -90,12 +90,12 @@ func (d *ABIDecoder) registerParsed(parsed *abiutil.ParsedEvent) {
 // Decode attempts to decode a log using registered event definitions.
 func (d *ABIDecoder) Decode(log event.Log) (*DecodedEvent, error) {
 	if len(log.Topics) == 0 {
-		return nil, fmt.Errorf("decoder: log has no topics")
+		return nil, fmt.Errorf("%w: log has no topics", ErrUnknownEvent)
 	}
 
 	def, ok := d.schema.Lookup(log.Topics[0])
 	if !ok {
-		return nil, fmt.Errorf("decoder: unknown event signature %x", log.Topics[0])
+		return nil, fmt.Errorf("%w: signature %x", ErrUnknownEvent, log.Topics[0])
 	}
 
 	decoded := &DecodedEvent{
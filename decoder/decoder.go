@@ -4,6 +4,7 @@ package decoder
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -12,10 +13,15 @@ import (
 	"github.com/hedeqiang/sonar/event"
 )
 
+// ErrUnknownEvent is wrapped by Decode errors for logs that match no
+// registered event.
+var ErrUnknownEvent = errors.New("decoder: unknown event")
+
 // Decoder decodes raw event logs into structured data.
 type Decoder interface {
 	// Decode parses a raw log into a DecodedEvent.
-	// Returns ErrDecode if the log cannot be matched or parsed.
+	// Returns an error wrapping ErrUnknownEvent if the log matches no
+	// registered event, and another error if it cannot be parsed.
 	Decode(log event.Log) (*DecodedEvent, error)
 
 	// Register adds an event ABI signature to the decoder.
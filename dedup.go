@@ -0,0 +1,59 @@
+package sonar
+
+import (
+	"fmt"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// dedupHandler wraps a pipeline so that logs the watch already handled are
+// suppressed before they reach it. A log is remembered once the pipeline
+// acknowledges it.
+func (s *Sonar) dedupHandler(chainID, watchID string, pipeline func(event.Log) error) func(event.Log) error {
+	if s.dedup == nil {
+		return pipeline
+	}
+	return func(log event.Log) error {
+		if !s.dedup.Claim(watchID, log) {
+			return nil
+		}
+		err := pipeline(log)
+		if rerr := s.dedup.Release(watchID, log, err == nil); rerr != nil {
+			s.reportError(chainID, watchID, fmt.Errorf("sonar: record handled log: %w", rerr))
+		}
+		return err
+	}
+}
+
+// dedupBatchHandler is the batch counterpart of dedupHandler: it leaves logs
+// the watch already handled out of each batch. A batch of duplicates is only
+// delivered if emptyBatches is set.
+func (s *Sonar) dedupBatchHandler(chainID, watchID string, emptyBatches bool, pipeline func(event.Batch) error) func(event.Batch) error {
+	if s.dedup == nil {
+		return pipeline
+	}
+	return func(batch event.Batch) error {
+		claimed := make([]event.Log, 0, len(batch.Logs))
+		for _, log := range batch.Logs {
+			if s.dedup.Claim(watchID, log) {
+				claimed = append(claimed, log)
+			}
+		}
+		if len(claimed) == 0 && !batch.IsEmpty() && !emptyBatches {
+			return nil
+		}
+		batch.Logs = claimed
+		err := pipeline(batch)
+
+		var rerr error
+		for _, log := range claimed {
+			if e := s.dedup.Release(watchID, log, err == nil); e != nil && rerr == nil {
+				rerr = e
+			}
+		}
+		if rerr != nil {
+			s.reportError(chainID, watchID, fmt.Errorf("sonar: record handled log: %w", rerr))
+		}
+		return err
+	}
+}
@@ -0,0 +1,214 @@
+// Package dedup suppresses event logs that were already handled, e.g. when a
+// restart, a retried range, a reorg re-scan or a stream and its gap-fill
+// deliver the same log more than once.
+package dedup
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// Key identifies a delivery of a log to one consumer.
+type Key struct {
+	// Scope separates consumers that each need every log, e.g. watches.
+	Scope string
+
+	Chain     string
+	BlockHash event.Hash
+	TxHash    event.Hash
+	LogIndex  uint
+
+	// Removed separates the reorg removal of a log from its delivery.
+	Removed bool
+}
+
+// KeyOf returns the key of log within scope.
+func KeyOf(scope string, log event.Log) Key {
+	return Key{
+		Scope:     scope,
+		Chain:     log.Chain,
+		BlockHash: log.BlockHash,
+		TxHash:    log.TxHash,
+		LogIndex:  log.LogIndex,
+		Removed:   log.Removed,
+	}
+}
+
+// Filter remembers the logs handled in a window of recent blocks per scope
+// and chain. Logs are claimed before they are handled and released
+// afterwards; only logs released as handled are remembered, so a log whose
+// handler failed is let through again. Logs older than the window are
+// always let through.
+type Filter struct {
+	window uint64
+	file   *file // nil for an in-memory filter
+
+	mu       sync.Mutex
+	windows  map[windowKey]*logWindow
+	inFlight map[Key]bool
+
+	suppressed atomic.Uint64
+}
+
+// windowKey identifies the logs of one chain handled in one scope.
+type windowKey struct {
+	scope, chain string
+}
+
+// logWindow holds the handled logs of one scope and chain.
+type logWindow struct {
+	head    uint64         // highest block of a handled log
+	pruneAt uint64         // head at which logs out of the window are next forgotten
+	seen    map[Key]uint64 // key -> block number
+}
+
+// New creates an in-memory filter remembering, for each scope and chain,
+// the logs of the window blocks below the highest handled block, and those
+// of that block.
+func New(window uint64) *Filter {
+	return &Filter{
+		window:   window,
+		windows:  make(map[windowKey]*logWindow),
+		inFlight: make(map[Key]bool),
+	}
+}
+
+// Claim reports whether log should be handled in scope. It returns false,
+// counting the log as suppressed, if the log was handled before or is being
+// handled right now. Every successful claim must be followed by Release.
+func (f *Filter) Claim(scope string, log event.Log) bool {
+	k := KeyOf(scope, log)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := f.logWindow(k)
+	if block, ok := w.seen[k]; ok && f.inWindow(w, block) || f.inFlight[k] {
+		f.suppressed.Add(1)
+		return false
+	}
+	f.inFlight[k] = true
+	return true
+}
+
+// Release ends the claim on log. If handled, the log is remembered and
+// suppressed from now on, and the window moves up to its block. Handling a
+// log forgets its twin, i.e. the log with Removed flipped, so that a log
+// removed by a reorg and then re-added by another is delivered again.
+func (f *Filter) Release(scope string, log event.Log, handled bool) error {
+	k := KeyOf(scope, log)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, k)
+	if !handled || !f.add(k, log.BlockNumber) {
+		return nil
+	}
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.append(k, log.BlockNumber); err != nil {
+		return err
+	}
+	if live := f.len(); f.file.needsCompaction(live) {
+		return f.file.compact(f.records(live))
+	}
+	return nil
+}
+
+// Close closes the file of a persistent filter. The filter must not be
+// released to afterwards. Closing an in-memory filter does nothing.
+func (f *Filter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	return f.file.close()
+}
+
+// Suppressed returns the number of duplicate logs suppressed so far.
+func (f *Filter) Suppressed() uint64 {
+	return f.suppressed.Load()
+}
+
+// Len returns the number of remembered logs.
+func (f *Filter) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.len()
+}
+
+func (f *Filter) len() int {
+	n := 0
+	for _, w := range f.windows {
+		for _, block := range w.seen {
+			if f.inWindow(w, block) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// records returns the remembered keys in their file form.
+func (f *Filter) records(n int) []record {
+	records := make([]record, 0, n)
+	for _, w := range f.windows {
+		for k, block := range w.seen {
+			if f.inWindow(w, block) {
+				records = append(records, toRecord(k, block))
+			}
+		}
+	}
+	return records
+}
+
+func (f *Filter) logWindow(k Key) *logWindow {
+	wk := windowKey{scope: k.Scope, chain: k.Chain}
+	w, ok := f.windows[wk]
+	if !ok {
+		w = &logWindow{seen: make(map[Key]uint64)}
+		f.windows[wk] = w
+	}
+	return w
+}
+
+// inWindow reports whether block is within the window of w. Logs that fell
+// out of it are only forgotten by prune, once per quarter window.
+func (f *Filter) inWindow(w *logWindow, block uint64) bool {
+	return block+f.window >= w.head
+}
+
+// add remembers k at block and forgets its twin, pruning the logs that fell
+// out of the window as the head moves. It reports false if block is already
+// outside the window.
+func (f *Filter) add(k Key, block uint64) bool {
+	w := f.logWindow(k)
+	if !f.inWindow(w, block) {
+		return false
+	}
+	twin := k
+	twin.Removed = !k.Removed
+	delete(w.seen, twin)
+	w.seen[k] = block
+	if block > w.head {
+		w.head = block
+		if w.head >= w.pruneAt {
+			f.prune(w)
+		}
+	}
+	return true
+}
+
+// prune forgets the logs of w that fell out of the window. It runs at most
+// once per quarter window to keep the amortized cost low.
+func (f *Filter) prune(w *logWindow) {
+	w.pruneAt = w.head + f.window/4 + 1
+	for k, block := range w.seen {
+		if !f.inWindow(w, block) {
+			delete(w.seen, k)
+		}
+	}
+}
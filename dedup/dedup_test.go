@@ -0,0 +1,230 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// logAt returns a log of chain "test" in block n, identified by index.
+func logAt(n uint64, index uint) event.Log {
+	var h event.Hash
+	h[31] = byte(n)
+	return event.Log{Chain: "test", BlockNumber: n, BlockHash: h, TxHash: h, LogIndex: index}
+}
+
+func removed(log event.Log) event.Log {
+	log.Removed = true
+	return log
+}
+
+// step claims log in scope and, if the claim succeeds, releases it as
+// handled unless failed is set.
+type step struct {
+	scope     string
+	log       event.Log
+	failed    bool
+	wantClaim bool
+}
+
+func TestFilter(t *testing.T) {
+	a, b := logAt(10, 0), logAt(10, 1)
+
+	tests := []struct {
+		name           string
+		window         uint64
+		steps          []step
+		wantLen        int
+		wantSuppressed uint64
+	}{
+		{
+			name:   "duplicate suppressed",
+			window: 10,
+			steps: []step{
+				{log: a, wantClaim: true},
+				{log: b, wantClaim: true},
+				{log: a, wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "scopes are separate",
+			window: 10,
+			steps: []step{
+				{scope: "w1", log: a, wantClaim: true},
+				{scope: "w2", log: a, wantClaim: true},
+				{scope: "w1", log: a, wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "windows move per scope",
+			window: 10,
+			steps: []step{
+				{scope: "w1", log: logAt(100, 0), wantClaim: true},
+				{scope: "w2", log: logAt(10, 0), wantClaim: true},
+				{scope: "w2", log: logAt(10, 0), wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "failed log let through again",
+			window: 10,
+			steps: []step{
+				{log: a, failed: true, wantClaim: true},
+				{log: a, wantClaim: true},
+				{log: a, wantClaim: false},
+			},
+			wantLen:        1,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "log at the window boundary remembered",
+			window: 10,
+			steps: []step{
+				{log: logAt(20, 0), wantClaim: true},
+				{log: logAt(10, 0), wantClaim: true}, // 10+10 == head
+				{log: logAt(10, 0), wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "log below the window not remembered",
+			window: 10,
+			steps: []step{
+				{log: logAt(20, 0), wantClaim: true},
+				{log: logAt(9, 0), wantClaim: true},
+				{log: logAt(9, 0), wantClaim: true},
+			},
+			wantLen: 1,
+		},
+		{
+			name:   "boundary log kept while head reaches it",
+			window: 10,
+			steps: []step{
+				{log: logAt(10, 0), wantClaim: true},
+				{log: logAt(20, 0), wantClaim: true},
+				{log: logAt(10, 0), wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "pruned once the head moves past the window",
+			window: 10,
+			steps: []step{
+				{log: logAt(10, 0), wantClaim: true},
+				{log: logAt(11, 0), wantClaim: true},
+				{log: logAt(21, 0), wantClaim: true},
+				{log: logAt(10, 0), wantClaim: true},
+				{log: logAt(11, 0), wantClaim: false},
+			},
+			wantLen:        2,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "zero window keeps only the head block",
+			window: 0,
+			steps: []step{
+				{log: logAt(5, 0), wantClaim: true},
+				{log: logAt(5, 1), wantClaim: true},
+				{log: logAt(6, 0), wantClaim: true},
+				{log: logAt(5, 0), wantClaim: true},
+			},
+			wantLen: 1,
+		},
+		{
+			name:   "removal delivered once",
+			window: 10,
+			steps: []step{
+				{log: a, wantClaim: true},
+				{log: removed(a), wantClaim: true},
+				{log: removed(a), wantClaim: false},
+			},
+			wantLen:        1,
+			wantSuppressed: 1,
+		},
+		{
+			name:   "log re-added after its removal delivered again",
+			window: 10,
+			steps: []step{
+				{log: a, wantClaim: true},
+				{log: removed(a), wantClaim: true},
+				{log: a, wantClaim: true},
+				{log: a, wantClaim: false},
+				{log: removed(a), wantClaim: true},
+			},
+			wantLen:        1,
+			wantSuppressed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := New(tt.window)
+			for i, s := range tt.steps {
+				if got := f.Claim(s.scope, s.log); got != s.wantClaim {
+					t.Fatalf("step %d: Claim(block %d, index %d, removed %v) = %v, want %v",
+						i, s.log.BlockNumber, s.log.LogIndex, s.log.Removed, got, s.wantClaim)
+				}
+				if s.wantClaim {
+					if err := f.Release(s.scope, s.log, !s.failed); err != nil {
+						t.Fatalf("step %d: Release: %v", i, err)
+					}
+				}
+			}
+			if got := f.Len(); got != tt.wantLen {
+				t.Errorf("Len = %d, want %d", got, tt.wantLen)
+			}
+			if got := f.Suppressed(); got != tt.wantSuppressed {
+				t.Errorf("Suppressed = %d, want %d", got, tt.wantSuppressed)
+			}
+		})
+	}
+}
+
+func TestFilterInFlight(t *testing.T) {
+	f := New(10)
+	a := logAt(10, 0)
+
+	if !f.Claim("", a) {
+		t.Fatal("first Claim = false, want true")
+	}
+	if f.Claim("", a) {
+		t.Error("Claim of a log being handled = true, want false")
+	}
+	if err := f.Release("", a, false); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Claim("", a) {
+		t.Error("Claim after a failed release = false, want true")
+	}
+}
+
+func TestFilterPrunesPerQuarterWindow(t *testing.T) {
+	f := New(8)
+	seen := func() int { return len(f.windows[windowKey{chain: "test"}].seen) }
+
+	handle(t, f, logAt(10, 0)) // prunes, next at 13
+	handle(t, f, logAt(3, 0))
+	handle(t, f, logAt(12, 0))
+	// Block 3 fell out of the window: it is let through, but still held.
+	if got := f.Len(); got != 2 {
+		t.Errorf("Len = %d, want 2", got)
+	}
+	if got := seen(); got != 3 {
+		t.Errorf("held %d logs before pruning, want 3", got)
+	}
+	if !f.Claim("", logAt(3, 0)) {
+		t.Error("Claim of a log out of the window = false, want true")
+	}
+	f.Release("", logAt(3, 0), false)
+
+	handle(t, f, logAt(13, 0))
+	if got := seen(); got != 3 {
+		t.Errorf("held %d logs after pruning, want 3", got)
+	}
+}
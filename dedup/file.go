@@ -0,0 +1,189 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// minCompactRecords is the number of records below which the file is never
+// compacted.
+const minCompactRecords = 1024
+
+// NewFile creates a filter like New that also appends every handled log to a
+// JSON Lines file at path, so duplicates are suppressed across restarts.
+// Records that fell out of the window are dropped when the file is
+// compacted. An incomplete last record, left by a crash while appending, is
+// truncated away. The file is kept open for appending until Close. The
+// directory containing path will be created if it does not exist.
+func NewFile(path string, window uint64) (*Filter, error) {
+	f := New(window)
+	f.file = &file{path: path}
+
+	records, err := f.file.readAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		k, err := r.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("dedup: parse %s: %w", path, err)
+		}
+		f.add(k, r.Block)
+	}
+	f.file.records = len(records)
+	return f, nil
+}
+
+// file is the append-only log of handled keys behind a persistent Filter.
+// Access is serialized by the Filter's mutex.
+type file struct {
+	path    string
+	fh      *os.File // opened by the first append; nil until then
+	records int      // records in the file, including pruned ones
+}
+
+// append writes a record for k.
+func (f *file) append(k Key, block uint64) error {
+	line, err := json.Marshal(toRecord(k, block))
+	if err != nil {
+		return fmt.Errorf("dedup: marshal key: %w", err)
+	}
+	if f.fh == nil {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return err
+		}
+		fh, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		f.fh = fh
+	}
+	if _, err := f.fh.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	f.records++
+	return nil
+}
+
+// close closes the file if it is open. The next append opens it again.
+func (f *file) close() error {
+	if f.fh == nil {
+		return nil
+	}
+	err := f.fh.Close()
+	f.fh = nil
+	return err
+}
+
+// needsCompaction reports whether most records in the file were pruned from
+// the window, given the number of live ones.
+func (f *file) needsCompaction(live int) bool {
+	return f.records > minCompactRecords && f.records > 2*live
+}
+
+// compact rewrites the file with the given records.
+func (f *file) compact(records []record) error {
+	var b strings.Builder
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("dedup: marshal key: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	// The open handle would keep appending to the replaced file.
+	if err := f.close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+	f.records = len(records)
+	return nil
+}
+
+// readAll reads the records of the file. Bytes after the last newline are an
+// incomplete record; they are truncated away so that the next append starts
+// on a line of its own.
+func (f *file) readAll() ([]record, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	if complete < len(data) {
+		if err := os.Truncate(f.path, int64(complete)); err != nil {
+			return nil, fmt.Errorf("dedup: truncate incomplete record of %s: %w", f.path, err)
+		}
+	}
+
+	var records []record
+	for _, line := range bytes.Split(data[:complete], []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("dedup: parse %s: %w", f.path, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// record is the JSON form of a remembered key, with hashes hex-encoded.
+type record struct {
+	Scope     string `json:"scope,omitempty"`
+	Chain     string `json:"chain"`
+	Block     uint64 `json:"blockNumber"`
+	BlockHash string `json:"blockHash"`
+	TxHash    string `json:"transactionHash"`
+	LogIndex  uint   `json:"logIndex"`
+	Removed   bool   `json:"removed,omitempty"`
+}
+
+func toRecord(k Key, block uint64) record {
+	return record{
+		Scope:     k.Scope,
+		Chain:     k.Chain,
+		Block:     block,
+		BlockHash: k.BlockHash.Hex(),
+		TxHash:    k.TxHash.Hex(),
+		LogIndex:  k.LogIndex,
+		Removed:   k.Removed,
+	}
+}
+
+func (r record) toKey() (Key, error) {
+	k := Key{
+		Scope:    r.Scope,
+		Chain:    r.Chain,
+		LogIndex: r.LogIndex,
+		Removed:  r.Removed,
+	}
+	var err error
+	if k.BlockHash, err = event.HexToHash(r.BlockHash); err != nil {
+		return Key{}, err
+	}
+	if k.TxHash, err = event.HexToHash(r.TxHash); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
@@ -0,0 +1,120 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+func TestNewFile(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string // written after the last complete record
+	}{
+		{name: "complete records"},
+		{name: "torn last record", tail: `{"chain":"test","blockNum`},
+		{name: "torn removal", tail: `{"chain":"test","blockNumber":11,"removed":tr`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dedup", "seen.jsonl")
+			a, b := logAt(10, 0), logAt(11, 0)
+
+			f, err := NewFile(path, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handle(t, f, a)
+			handle(t, f, b)
+			if tt.tail != "" {
+				appendRaw(t, path, tt.tail)
+			}
+
+			if f, err = NewFile(path, 10); err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if got := f.Len(); got != 2 {
+				t.Errorf("Len after reopening = %d, want 2", got)
+			}
+			if f.Claim("", a) || f.Claim("", b) {
+				t.Error("a log handled before reopening was claimed again")
+			}
+
+			// A record appended after a torn one starts on a line of its own.
+			handle(t, f, logAt(12, 0))
+			if f, err = NewFile(path, 10); err != nil {
+				t.Fatalf("reopen after append: %v", err)
+			}
+			if got := f.Len(); got != 3 {
+				t.Errorf("Len after appending = %d, want 3", got)
+			}
+		})
+	}
+}
+
+func TestNewFileCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.jsonl")
+	f, err := NewFile(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With a zero window every record but the last is pruned, so the file
+	// is compacted once it passes minCompactRecords.
+	for n := uint64(1); n <= minCompactRecords+10; n++ {
+		handle(t, f, logAt(n, uint(n)))
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records appended after compacting land in the compacted file.
+	if lines := strings.Count(string(data), "\n"); lines == 0 || lines > minCompactRecords/2 {
+		t.Errorf("file has %d records after compacting, want a few", lines)
+	}
+	if f, err = NewFile(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Claim("", logAt(minCompactRecords+10, minCompactRecords+10)) {
+		t.Error("the last handled log was claimed again after reopening")
+	}
+}
+
+func TestNewFileCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.jsonl")
+	if err := os.WriteFile(path, []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFile(path, 10); err == nil {
+		t.Error("NewFile succeeded on a corrupt complete record, want an error")
+	}
+}
+
+func handle(t *testing.T, f *Filter, log event.Log) {
+	t.Helper()
+	if !f.Claim("", log) {
+		t.Fatalf("Claim(block %d) = false, want true", log.BlockNumber)
+	}
+	if err := f.Release("", log, true); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+}
+
+func appendRaw(t *testing.T, path, s string) {
+	t.Helper()
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if _, err := fh.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
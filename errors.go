@@ -3,7 +3,15 @@
 // Sonar — a deep probe for every on-chain event signal.
 package sonar
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/retry"
+	"github.com/hedeqiang/sonar/transport"
+	"github.com/hedeqiang/sonar/watcher"
+)
 
 var (
 	// ErrChainNotFound is returned when operating on an unregistered chain.
@@ -33,3 +41,194 @@ var (
 	// ErrChainAlreadyRegistered is returned when adding a chain that already exists.
 	ErrChainAlreadyRegistered = errors.New("sonar: chain already registered")
 )
+
+// Sentinels matched by a WatchError of the corresponding kind. KindDecode
+// errors match ErrDecode.
+var (
+	// ErrTransient matches errors expected to clear up on their own.
+	ErrTransient = errors.New("sonar: transient error")
+
+	// ErrRateLimited matches errors caused by an RPC rate limit.
+	ErrRateLimited = errors.New("sonar: rate limited")
+
+	// ErrRangeTooLarge matches log queries the provider rejected as too large
+	// even at the smallest block window.
+	ErrRangeTooLarge = errors.New("sonar: range too large")
+
+	// ErrHandler matches failures of the watch's handler.
+	ErrHandler = errors.New("sonar: handler failed")
+
+	// ErrFatal matches errors that stopped a watch.
+	ErrFatal = errors.New("sonar: watch stopped")
+
+	// ErrReorgTooDeep matches reorganizations deeper than the tracked
+	// history, whose orphaned logs could not all be undone.
+	ErrReorgTooDeep = errors.New("sonar: reorg too deep")
+
+	// ErrCursorSave matches failures to save a watch's progress.
+	ErrCursorSave = errors.New("sonar: cursor save failed")
+)
+
+// ErrorKind classifies a WatchError.
+type ErrorKind int
+
+const (
+	// KindTransient is an RPC or storage failure that is retried, e.g. a
+	// dropped connection or an open circuit breaker.
+	KindTransient ErrorKind = iota
+	// KindRateLimited is an RPC call rejected by the provider's rate limit.
+	KindRateLimited
+	// KindRangeTooLarge is a log query rejected as too large at the
+	// smallest block window.
+	KindRangeTooLarge
+	// KindDecode is a log the decoder could not parse. The log is skipped.
+	KindDecode
+	// KindHandler is a handler that failed on a log or batch, including
+	// logs that were dead-lettered.
+	KindHandler
+	// KindFatal is an error that stopped the watch.
+	KindFatal
+	// KindReorgTooDeep is a reorganization that reached below the blocks
+	// tracked for reorg detection. Logs of orphaned blocks older than the
+	// tracked ones were not delivered again with Removed set, so data may
+	// be lost; raise the reorg depth.
+	KindReorgTooDeep
+	// KindCursorSave is a failure to save the watch's progress. The watch
+	// goes on, but a restart delivers the blocks after the last saved one
+	// again.
+	KindCursorSave
+)
+
+// String returns the lower-case name of the kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case KindTransient:
+		return "transient"
+	case KindRateLimited:
+		return "rate-limited"
+	case KindRangeTooLarge:
+		return "range-too-large"
+	case KindDecode:
+		return "decode"
+	case KindHandler:
+		return "handler"
+	case KindFatal:
+		return "fatal"
+	case KindReorgTooDeep:
+		return "reorg-too-deep"
+	case KindCursorSave:
+		return "cursor-save"
+	default:
+		return "unknown"
+	}
+}
+
+// sentinel returns the error matched by WatchErrors of kind k.
+func (k ErrorKind) sentinel() error {
+	switch k {
+	case KindTransient:
+		return ErrTransient
+	case KindRateLimited:
+		return ErrRateLimited
+	case KindRangeTooLarge:
+		return ErrRangeTooLarge
+	case KindDecode:
+		return ErrDecode
+	case KindHandler:
+		return ErrHandler
+	case KindFatal:
+		return ErrFatal
+	case KindReorgTooDeep:
+		return ErrReorgTooDeep
+	case KindCursorSave:
+		return ErrCursorSave
+	default:
+		return nil
+	}
+}
+
+// WatchError is an error reported by a running watch, with the context it
+// occurred in. It matches the sentinel of its kind with errors.Is, as well as
+// ErrConnection if the endpoint could not be reached, and unwraps to the
+// underlying error.
+type WatchError struct {
+	Kind ErrorKind
+
+	// Chain is the chain ID, and WatchID the watch's ID. WatchID is empty
+	// for replays.
+	Chain   string
+	WatchID string
+
+	// FromBlock and ToBlock bound the blocks the error concerns. Both are
+	// zero if it concerns no particular range.
+	FromBlock uint64
+	ToBlock   uint64
+
+	// Method is the RPC method that failed, if any.
+	Method string
+
+	// Attempt is the number of times the failed operation was tried,
+	// including retries.
+	Attempt int
+
+	Err error
+}
+
+// newWatchError builds a WatchError of the given kind, taking the block
+// range, RPC method and attempt count from err.
+func newWatchError(chainID, watchID string, kind ErrorKind, err error) WatchError {
+	e := WatchError{
+		Kind:    kind,
+		Chain:   chainID,
+		WatchID: watchID,
+		Attempt: retry.Attempts(err),
+		Err:     err,
+	}
+	var re *watcher.RangeError
+	if errors.As(err, &re) {
+		e.FromBlock, e.ToBlock = re.FromBlock, re.ToBlock
+	}
+	var ce *transport.CallError
+	if errors.As(err, &ce) {
+		e.Method = ce.Method
+	}
+	return e
+}
+
+// classify returns the kind of an error reported by a running watch.
+func classify(err error) ErrorKind {
+	var re *watcher.RangeError
+	switch {
+	case errors.As(err, &re) && re.Handler:
+		return KindHandler
+	case errors.Is(err, transport.ErrRateLimited):
+		return KindRateLimited
+	case errors.Is(err, chain.ErrRangeTooLarge):
+		return KindRangeTooLarge
+	case errors.Is(err, watcher.ErrReorgTooDeep):
+		return KindReorgTooDeep
+	case errors.Is(err, watcher.ErrCursorSave):
+		return KindCursorSave
+	default:
+		return KindTransient
+	}
+}
+
+func (e WatchError) Error() string {
+	id := e.Chain
+	if e.WatchID != "" {
+		id = e.WatchID
+	}
+	return fmt.Sprintf("sonar: %s: %s: %v", id, e.Kind, e.Err)
+}
+
+func (e WatchError) Unwrap() error { return e.Err }
+
+// Is reports whether target is the sentinel of e's kind, or ErrConnection
+// for errors reaching the endpoint.
+func (e WatchError) Is(target error) bool {
+	if target == ErrConnection {
+		return transport.IsConnectionError(e.Err)
+	}
+	return target == e.Kind.sentinel()
+}
@@ -0,0 +1,38 @@
+package sonar
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/transport"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{name: "rpc failure", err: errors.New("connection reset"), want: KindTransient},
+		{name: "rate limited", err: fmt.Errorf("eth_getLogs: %w", transport.ErrRateLimited), want: KindRateLimited},
+		{name: "range too large", err: fmt.Errorf("eth_getLogs: %w", chain.ErrRangeTooLarge), want: KindRangeTooLarge},
+		{name: "handler", err: &watcher.RangeError{FromBlock: 1, ToBlock: 2, Handler: true, Err: errors.New("db down")}, want: KindHandler},
+		{name: "reorg too deep", err: fmt.Errorf("reorg at block 9: %w", watcher.ErrReorgTooDeep), want: KindReorgTooDeep},
+		{name: "cursor save", err: fmt.Errorf("hybrid: %w: %w", watcher.ErrCursorSave, errors.New("disk full")), want: KindCursorSave},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classify(tt.err)
+			if got != tt.want {
+				t.Fatalf("classify = %v, want %v", got, tt.want)
+			}
+			e := newWatchError("test", "w", got, tt.err)
+			if !errors.Is(e, tt.want.sentinel()) {
+				t.Errorf("%v does not match the sentinel of its kind", e)
+			}
+		})
+	}
+}
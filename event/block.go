@@ -0,0 +1,32 @@
+package event
+
+import (
+	"math/big"
+	"time"
+)
+
+// Block represents a block header delivered by a block watch.
+type Block struct {
+	// Chain identifies which blockchain this block belongs to.
+	Chain string
+
+	// Number is the block height.
+	Number uint64
+
+	// Hash is the block hash.
+	Hash Hash
+
+	// ParentHash is the hash of the preceding block.
+	ParentHash Hash
+
+	// Timestamp is the block timestamp.
+	Timestamp time.Time
+
+	// BaseFee is the EIP-1559 base fee per gas in wei, or nil if the block
+	// has none.
+	BaseFee *big.Int
+
+	// Removed is true if the block was orphaned by a chain reorganization
+	// after it was delivered.
+	Removed bool
+}
@@ -47,6 +47,9 @@ type Log struct {
 
 	// Timestamp is the block timestamp (if available).
 	Timestamp time.Time
+
+	// Metadata describes the transaction that emitted the log (if available).
+	Metadata *Metadata
 }
 
 // EventSignature returns the first topic (event signature hash), or a zero hash if no topics exist.
@@ -62,6 +65,28 @@ type Metadata struct {
 	ChainID   string
 	Network   string
 	BlockTime time.Time
-	GasUsed   uint64
-	GasPrice  *big.Int
+
+	// From is the sender of the transaction.
+	From Address
+
+	// To is the recipient of the transaction, or nil for contract creation.
+	To *Address
+
+	// GasUsed is the gas used by the transaction.
+	GasUsed uint64
+
+	// GasPrice is the effective gas price paid per unit of gas.
+	GasPrice *big.Int
+
+	// Status is the receipt status: 1 for success, 0 for failure.
+	Status uint64
+
+	// Selector is the first four bytes of the transaction input, identifying
+	// the called function. It is zero for plain transfers and contract creation.
+	Selector [4]byte
+}
+
+// Succeeded reports whether the transaction executed successfully.
+func (m *Metadata) Succeeded() bool {
+	return m.Status == 1
 }
@@ -51,7 +51,7 @@ func main() {
 	q := filter.NewQuery(filter.WithAddresses(usdt))
 
 	// 5. Watch raw events
-	err := s.Watch("ethereum", q, func(l event.Log) {
+	_, err := s.Watch("ethereum", q, func(l event.Log) {
 		fmt.Printf("[block %d] tx=%s addr=%s topics=%d data=%d bytes\n",
 			l.BlockNumber,
 			l.TxHash.Hex(),
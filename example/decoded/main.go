@@ -54,7 +54,7 @@ func main() {
 	q := filter.NewQuery(filter.WithAddresses(usdt))
 
 	// WatchDecoded — only successfully decoded events reach the handler
-	err := s.WatchDecoded("ethereum", q, func(ev *decoder.DecodedEvent) {
+	_, err := s.WatchDecoded("ethereum", q, func(ev *decoder.DecodedEvent) {
 		switch ev.Name {
 		case "Transfer":
 			from, _ := ev.Indexed["from"].(event.Address)
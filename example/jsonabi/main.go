@@ -78,7 +78,7 @@ func main() {
 	usdt := event.MustHexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
 	q := filter.NewQuery(filter.WithAddresses(usdt))
 
-	err := s.WatchDecoded("ethereum", q, func(ev *decoder.DecodedEvent) {
+	_, err := s.WatchDecoded("ethereum", q, func(ev *decoder.DecodedEvent) {
 		value, _ := ev.Params["value"].(*big.Int)
 		fmt.Printf("[%s] block=%d value=%s tx=%s\n",
 			ev.Name, ev.Raw.BlockNumber, value.String(), ev.Raw.TxHash.Hex())
@@ -80,7 +80,7 @@ func main() {
 		contractAddr := event.MustHexToAddress(addr)
 		q := filter.NewQuery(filter.WithAddresses(contractAddr))
 
-		err := s.Watch(chainID, q, func(l event.Log) {
+		_, err := s.Watch(chainID, q, func(l event.Log) {
 			fmt.Printf("[%s] block=%d tx=%s\n",
 				l.Chain, l.BlockNumber, l.TxHash.Hex())
 		})
@@ -6,15 +6,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"sync/atomic"
+	"syscall"
 
+	"github.com/hedeqiang/sonar"
 	"github.com/hedeqiang/sonar/chain/ethereum"
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
-	"github.com/hedeqiang/sonar/watcher"
+	mw "github.com/hedeqiang/sonar/middleware"
+	"github.com/hedeqiang/sonar/retry"
 )
 
 func main() {
@@ -23,7 +28,18 @@ func main() {
 		log.Fatal("ETH_RPC_URL environment variable is required")
 	}
 
-	eth := ethereum.New(rpcURL)
+	// Replay with a batch size of 50 blocks, retrying failed ranges
+	s := sonar.New(
+		sonar.WithBatchSize(50),
+		sonar.WithRetry(retry.Exponential(3)),
+	)
+	if err := s.AddChain(ethereum.New(rpcURL)); err != nil {
+		log.Fatal(err)
+	}
+
+	// Middleware applies to replays just like to live watches
+	metrics := mw.NewMetrics()
+	s.Use(metrics)
 
 	// Scan USDT events in a 100-block range
 	// Adjust the block numbers to a recent range on mainnet
@@ -33,26 +49,22 @@ func main() {
 		filter.WithBlockRange(21000000, 21000100),
 	)
 
-	// Create a replay watcher with batch size of 50 blocks
-	r := watcher.NewReplay(eth, q, 50)
-
 	var count atomic.Int64
 
-	r.OnEvent(func(l event.Log) {
+	// Stop early on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Println("Replaying USDT events from block 21000000 to 21000100...")
+
+	err := s.Replay(ctx, "ethereum", q, func(l event.Log) {
 		n := count.Add(1)
 		fmt.Printf("#%d [block %d] tx=%s topics=%d\n",
 			n, l.BlockNumber, l.TxHash.Hex(), len(l.Topics))
 	})
-
-	r.OnError(func(err error) {
-		log.Printf("Error: %v", err)
-	})
-
-	fmt.Println("Replaying USDT events from block 21000000 to 21000100...")
-
-	if err := r.Watch(); err != nil {
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("Done. Total events: %d\n", count.Load())
+	fmt.Printf("Done. Total events: %d (processed by pipeline: %d)\n", count.Load(), metrics.Processed())
 }
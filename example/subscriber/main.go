@@ -66,7 +66,7 @@ func main() {
 	usdt := event.MustHexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
 	q := filter.NewQuery(filter.WithAddresses(usdt))
 
-	err := s.Watch("ethereum", q, func(l event.Log) {
+	_, err := s.Watch("ethereum", q, func(l event.Log) {
 		bc.Send(l)
 	})
 	if err != nil {
@@ -97,7 +97,7 @@ func main() {
 	contractAddr := event.MustHexToAddress("0xbF09f23a3029F3b2AF7230767c4c830e1d7Ac2d5")
 	q := filter.NewQuery(filter.WithAddresses(contractAddr))
 
-	err := s.WatchDecoded("sepolia", q, func(ev *decoder.DecodedEvent) {
+	_, err := s.WatchDecoded("sepolia", q, func(ev *decoder.DecodedEvent) {
 		// --- Method 1: String() ---
 		fmt.Println("String():", ev.String())
 
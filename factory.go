@@ -0,0 +1,205 @@
+package sonar
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/factory"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+// WatchFactory watches a factory contract and every contract it deploys.
+// Creation events of the factory are decoded to find each child, which is
+// stored under the watch's cursor key in the factory store and added to the
+// watched addresses with a backfill from its creation block, as
+// AddAddressesFrom does. Children stored by an earlier run are watched from
+// the start, and the store records which have been backfilled: those whose
+// backfill had not completed when the process stopped are backfilled again
+// from their creation block up to the saved progress. The handler receives
+// the creation events as well as the children's logs.
+//
+// The default cursor key is derived from the factory address and topics
+// alone, so it does not change as children are added. Streaming is not
+// supported; if it is the configured WatchMode, the watch polls instead.
+// Creation events undone by a reorg do not remove their child.
+func (s *Sonar) WatchFactory(chainID string, cfg factory.Config, handler func(event.Log) error, opts ...WatchOption) (*Handle, error) {
+	t, err := factory.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filter.Query{Addresses: []event.Address{t.Factory()}, Topics: t.Topics()}
+	o := s.watchOptions(chainID, opts)
+	key := o.CursorKey
+	if key == "" {
+		key = CursorKey(chainID, base)
+	}
+	children, err := s.factories.Load(key)
+	if err != nil {
+		return nil, fmt.Errorf("sonar: load factory children: %w", err)
+	}
+
+	f := &follower{
+		tracker: t,
+		store:   s.factories,
+		key:     key,
+		known:   map[event.Address]bool{t.Factory(): true},
+		notify:  make(chan struct{}, 1),
+	}
+	query := base
+	var unfinished []factory.Child
+	for _, c := range children {
+		if !f.known[c.Address] {
+			f.known[c.Address] = true
+			query.Addresses = append(query.Addresses, c.Address)
+		}
+		if !c.Backfilled {
+			unfinished = append(unfinished, c)
+		}
+	}
+	last, err := s.cursor.Load(key)
+	if err != nil {
+		return nil, fmt.Errorf("sonar: load cursor: %w", err)
+	}
+
+	mode := s.config.Mode
+	if mode == ModeStream {
+		mode = ModePoll
+	}
+	opts = append([]WatchOption{WithCursorKey(key)}, opts...)
+	h, err := s.watch(chainID, query, mode, f.handler(handler), nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("factory watch started", "chain", chainID, "watch", h.id, "factory", t.Factory().Hex(), "children", len(children))
+	if len(unfinished) > 0 {
+		f.resume(s, h, unfinished, last)
+	}
+	go f.run(s, h)
+	return h, nil
+}
+
+// follower adds the children found by a factory watch to its query. The
+// handler only records children, since a query cannot be updated while a
+// log is being delivered; run applies them once delivery moves on.
+type follower struct {
+	tracker *factory.Tracker
+	store   factory.Store
+	key     string
+
+	mu      sync.Mutex
+	known   map[event.Address]bool
+	pending []factory.Child
+	notify  chan struct{}
+}
+
+// handler returns a handler that records the children announced by creation
+// events before passing every log to next.
+func (f *follower) handler(next func(event.Log) error) func(event.Log) error {
+	return func(log event.Log) error {
+		child, ok, err := f.tracker.Child(log)
+		if err != nil {
+			return &decodeError{err}
+		}
+		if ok {
+			if err := f.add(child); err != nil {
+				return err
+			}
+		}
+		return next(log)
+	}
+}
+
+// add stores child and queues it for run, unless it is known.
+func (f *follower) add(child factory.Child) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.known[child.Address] {
+		return nil
+	}
+	if err := f.store.Add(f.key, child); err != nil {
+		return fmt.Errorf("sonar: store factory child: %w", err)
+	}
+	f.known[child.Address] = true
+	f.pending = append(f.pending, child)
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run adds the queued children to the watch of h until it exits, marking
+// them backfilled in the store once their backfill completes.
+func (f *follower) run(s *Sonar, h *Handle) {
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-f.notify:
+		}
+
+		f.mu.Lock()
+		children := f.pending
+		f.pending = nil
+		f.mu.Unlock()
+		if len(children) == 0 {
+			continue
+		}
+
+		from, addrs := span(children)
+		if _, err := s.addAddressesFrom(h.id, from, addrs, f.backfilled(s, h, addrs)); err != nil {
+			if errors.Is(err, ErrNotRunning) {
+				return
+			}
+			s.reportError(h.chain, h.id, err)
+			continue
+		}
+		s.logger.Info("factory children added", "chain", h.chain, "watch", h.id, "children", len(children), "from_block", from)
+	}
+}
+
+// resume backfills children stored by an earlier run whose backfill had not
+// completed, from their earliest creation block up to last, the block the
+// watch has saved progress at. They are part of the watch's query from the
+// block after it on. Without saved progress, the watch starts afresh and
+// they are not backfilled.
+func (f *follower) resume(s *Sonar, h *Handle, children []factory.Child, last uint64) {
+	from, addrs := span(children)
+	done := f.backfilled(s, h, addrs)
+	b, ok := h.w.(watcher.Backfiller)
+	if !ok || last == 0 {
+		done()
+		return
+	}
+	b.Backfill(filter.Query{Addresses: addrs, Topics: h.Query().Topics}, from, last, done)
+	s.logger.Info("factory backfill resumed", "chain", h.chain, "watch", h.id, "children", len(children), "from_block", from, "to_block", last)
+}
+
+// backfilled returns a function that records the backfill of addrs as
+// complete in the store.
+func (f *follower) backfilled(s *Sonar, h *Handle, addrs []event.Address) func() {
+	return func() {
+		if err := f.store.SetBackfilled(f.key, addrs...); err != nil {
+			s.reportError(h.chain, h.id, fmt.Errorf("sonar: store factory backfill: %w", err))
+		}
+	}
+}
+
+// span returns the earliest creation block of children and their addresses.
+// Children backfilled together start from the earliest, as none has logs
+// before its own.
+func span(children []factory.Child) (uint64, []event.Address) {
+	from := children[0].Block
+	addrs := make([]event.Address, len(children))
+	for i, c := range children {
+		addrs[i] = c.Address
+		if c.Block < from {
+			from = c.Block
+		}
+	}
+	return from, addrs
+}
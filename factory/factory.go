@@ -0,0 +1,140 @@
+// Package factory follows the contracts a factory contract deploys, e.g. the
+// pairs of a DEX, by decoding the factory's creation events.
+package factory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hedeqiang/sonar/decoder"
+	"github.com/hedeqiang/sonar/event"
+	abiutil "github.com/hedeqiang/sonar/internal/abi"
+)
+
+// ErrInvalidConfig is returned by New for a configuration that cannot be
+// used to find children.
+var ErrInvalidConfig = errors.New("factory: invalid config")
+
+// Config describes a factory contract and the event it announces children with.
+type Config struct {
+	// Factory is the address of the factory contract.
+	Factory event.Address
+
+	// Event is the Solidity signature of the creation event, with parameter
+	// names, e.g. "PairCreated(address indexed token0, address indexed token1,
+	// address pair, uint256)".
+	Event string
+
+	// Param is the name of the event parameter holding the child's address.
+	// It must be of type address.
+	Param string
+
+	// ChildTopics restricts the children's logs to these event signature
+	// hashes (topic 0). Empty delivers every log of the children.
+	ChildTopics []event.Hash
+}
+
+// Child is a contract deployed by a factory.
+type Child struct {
+	// Address is the address of the child contract.
+	Address event.Address
+
+	// Block is the block the child was created in. It has no logs before it.
+	Block uint64
+
+	// Backfilled reports whether the child's logs from Block up to the block
+	// it was added to the watch at have been delivered.
+	Backfilled bool
+}
+
+// Store persists the children discovered for a watch, so that a restart
+// resumes watching them, and backfilling those whose backfill had not
+// completed.
+type Store interface {
+	// Load returns the children stored under key, in the order they were added.
+	Load(key string) ([]Child, error)
+
+	// Add stores a child under key. Adding a known address again is a no-op.
+	Add(key string, c Child) error
+
+	// SetBackfilled marks the backfill of the children with the given
+	// addresses under key complete. Unknown addresses are ignored.
+	SetBackfilled(key string, addrs ...event.Address) error
+}
+
+// Tracker recognizes the creation events of a factory.
+type Tracker struct {
+	config  Config
+	topic   event.Hash
+	decoder *decoder.ABIDecoder
+}
+
+// New creates a tracker for the factory described by cfg. It fails if the
+// event signature cannot be parsed or has no address parameter named Param.
+func New(cfg Config) (*Tracker, error) {
+	parsed, err := abiutil.ParseEventSignature(cfg.Event)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	found := false
+	for _, p := range parsed.Params {
+		if p.Name != cfg.Param {
+			continue
+		}
+		if p.Type != "address" {
+			return nil, fmt.Errorf("%w: parameter %q of %s is %s, not address", ErrInvalidConfig, cfg.Param, parsed.Name, p.Type)
+		}
+		found = true
+	}
+	if cfg.Param == "" || !found {
+		return nil, fmt.Errorf("%w: %s has no parameter %q", ErrInvalidConfig, parsed.Name, cfg.Param)
+	}
+
+	dec := decoder.NewABIDecoder()
+	if err := dec.Register(cfg.Event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return &Tracker{
+		config:  cfg,
+		topic:   abiutil.EventSignatureHash(parsed.Canonical()),
+		decoder: dec,
+	}, nil
+}
+
+// Factory returns the address of the factory contract.
+func (t *Tracker) Factory() event.Address {
+	return t.config.Factory
+}
+
+// Topic returns the signature hash of the creation event.
+func (t *Tracker) Topic() event.Hash {
+	return t.topic
+}
+
+// Topics returns the topic filter matching the creation events and the
+// children's logs: nil if the children's logs are not restricted.
+func (t *Tracker) Topics() [][]event.Hash {
+	if len(t.config.ChildTopics) == 0 {
+		return nil
+	}
+	first := append([]event.Hash{t.topic}, t.config.ChildTopics...)
+	return [][]event.Hash{first}
+}
+
+// Child returns the child announced by log, and false if log is not a
+// creation event of the factory. Removed logs are never creation events. It
+// fails if a creation event cannot be decoded.
+func (t *Tracker) Child(log event.Log) (Child, bool, error) {
+	if log.Removed || log.Address != t.config.Factory || len(log.Topics) == 0 || log.Topics[0] != t.topic {
+		return Child{}, false, nil
+	}
+	decoded, err := t.decoder.Decode(log)
+	if err != nil {
+		return Child{}, false, err
+	}
+	addr, ok := decoded.Params[t.config.Param].(event.Address)
+	if !ok {
+		return Child{}, false, fmt.Errorf("factory: %s in block %d has no %s address", decoded.Name, log.BlockNumber, t.config.Param)
+	}
+	return Child{Address: addr, Block: log.BlockNumber}, true, nil
+}
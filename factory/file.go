@@ -0,0 +1,177 @@
+package factory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// File is a Store that appends children to a JSON Lines file shared by all
+// keys. Completed backfills are appended as records of their own.
+type File struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFile creates a file-backed store. The directory containing path will be
+// created if it does not exist.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Load returns the children stored under key, in the order they were added.
+func (f *File) Load(key string) ([]Child, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var children []Child
+	index := make(map[event.Address]int)
+	for _, r := range records {
+		if r.Key != key {
+			continue
+		}
+		c, err := r.toChild()
+		if err != nil {
+			return nil, fmt.Errorf("factory: parse %s: %w", f.path, err)
+		}
+		if i, ok := index[c.Address]; ok {
+			// A later record of a known child marks its backfill complete.
+			children[i].Backfilled = children[i].Backfilled || c.Backfilled
+			continue
+		}
+		index[c.Address] = len(children)
+		children = append(children, c)
+	}
+	return children, nil
+}
+
+// Add appends the child to the file unless its address is known under key.
+func (f *File) Add(key string, c Child) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	r := toRecord(key, c)
+	for _, known := range records {
+		if known.Key == key && known.Address == r.Address {
+			return nil
+		}
+	}
+	return f.write(r)
+}
+
+// SetBackfilled appends a record marking the backfill of each known child
+// with the given addresses complete.
+func (f *File) SetBackfilled(key string, addrs ...event.Address) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	records, err := f.readAll()
+	if err != nil {
+		return err
+	}
+	backfilled := make(map[string]bool) // of the known children
+	for _, r := range records {
+		if r.Key == key {
+			backfilled[r.Address] = backfilled[r.Address] || r.Backfilled
+		}
+	}
+	var marks []record
+	for _, a := range addrs {
+		hex := a.Hex()
+		if done, known := backfilled[hex]; known && !done {
+			backfilled[hex] = true
+			marks = append(marks, record{Key: key, Address: hex, Backfilled: true})
+		}
+	}
+	return f.write(marks...)
+}
+
+// write appends records to the file, creating it if needed.
+func (f *File) write(records ...record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("factory: marshal child: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *File) readAll() ([]record, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("factory: parse %s: %w", f.path, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// record is the JSON form of a stored child, with the address hex-encoded,
+// or of the completion of its backfill.
+type record struct {
+	Key        string `json:"key"`
+	Address    string `json:"address"`
+	Block      uint64 `json:"blockNumber,omitempty"`
+	Backfilled bool   `json:"backfilled,omitempty"`
+}
+
+func toRecord(key string, c Child) record {
+	return record{Key: key, Address: c.Address.Hex(), Block: c.Block, Backfilled: c.Backfilled}
+}
+
+func (r record) toChild() (Child, error) {
+	addr, err := event.HexToAddress(r.Address)
+	if err != nil {
+		return Child{}, err
+	}
+	return Child{Address: addr, Block: r.Block, Backfilled: r.Backfilled}, nil
+}
@@ -0,0 +1,78 @@
+package factory
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+func TestFileBackfilled(t *testing.T) {
+	a, b := address(1), address(2)
+	tests := []struct {
+		name       string
+		backfilled []event.Address // marked in order, each in a call of its own
+		want       []Child
+	}{
+		{
+			name: "pending",
+			want: []Child{{Address: a, Block: 5}, {Address: b, Block: 7}},
+		},
+		{
+			name:       "one backfilled",
+			backfilled: []event.Address{b},
+			want:       []Child{{Address: a, Block: 5}, {Address: b, Block: 7, Backfilled: true}},
+		},
+		{
+			name:       "marked twice",
+			backfilled: []event.Address{a, a},
+			want:       []Child{{Address: a, Block: 5, Backfilled: true}, {Address: b, Block: 7}},
+		},
+		{
+			name:       "unknown address",
+			backfilled: []event.Address{address(3)},
+			want:       []Child{{Address: a, Block: 5}, {Address: b, Block: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "children.jsonl")
+			f := NewFile(path)
+			for _, c := range []Child{{Address: a, Block: 5}, {Address: b, Block: 7}} {
+				if err := f.Add("pairs", c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Add("other", Child{Address: a, Block: 9}); err != nil {
+				t.Fatal(err)
+			}
+			for _, addr := range tt.backfilled {
+				if err := f.SetBackfilled("pairs", addr); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := NewFile(path).Load("pairs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Load = %v, want %v", got, tt.want)
+			}
+			other, err := NewFile(path).Load("other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []Child{{Address: a, Block: 9}}; !slices.Equal(other, want) {
+				t.Errorf("Load(other) = %v, want %v", other, want)
+			}
+		})
+	}
+}
+
+func address(b byte) event.Address {
+	var a event.Address
+	a[19] = b
+	return a
+}
@@ -0,0 +1,55 @@
+package factory
+
+import (
+	"sync"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+// Memory is an in-memory Store implementation.
+// Suitable for development and testing; children are lost on restart.
+type Memory struct {
+	mu       sync.Mutex
+	children map[string][]Child
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{children: make(map[string][]Child)}
+}
+
+// Load returns the children stored under key, in the order they were added.
+func (m *Memory) Load(key string) ([]Child, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Child, len(m.children[key]))
+	copy(out, m.children[key])
+	return out, nil
+}
+
+// Add stores a child under key unless its address is known.
+func (m *Memory) Add(key string, c Child) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, known := range m.children[key] {
+		if known.Address == c.Address {
+			return nil
+		}
+	}
+	m.children[key] = append(m.children[key], c)
+	return nil
+}
+
+// SetBackfilled marks the children with the given addresses backfilled.
+func (m *Memory) SetBackfilled(key string, addrs ...event.Address) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.children[key] {
+		for _, a := range addrs {
+			if c.Address == a {
+				m.children[key][i].Backfilled = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sonar
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/factory"
+)
+
+var (
+	testFactory = address(0xfa)
+	testChild   = address(0xc1)
+)
+
+var testFactoryConfig = factory.Config{
+	Factory: testFactory,
+	Event:   "Created(address child)",
+	Param:   "child",
+}
+
+// creationAt returns the creation event of child in block n.
+func creationAt(t *testing.T, child event.Address, n uint64) event.Log {
+	t.Helper()
+	tracker, err := factory.New(testFactoryConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 32)
+	copy(data[12:], child[:])
+	log := logAt(testFactory, n, 0)
+	log.Topics = []event.Hash{tracker.Topic()}
+	log.Data = data
+	return log
+}
+
+func TestWatchFactory(t *testing.T) {
+	c := &logChain{head: 20, logs: []event.Log{
+		creationAt(t, testChild, 5),
+		logAt(testChild, 5, 1),
+		logAt(testChild, 12, 0),
+		logAt(testChild, 18, 0),
+	}}
+	store := factory.NewMemory()
+	s := newTestSonar(WithFactoryStore(store), WithPollInterval(time.Millisecond))
+	defer s.Shutdown(context.Background())
+	if err := s.AddChain(c); err != nil {
+		t.Fatal(err)
+	}
+
+	got := newCollector()
+	_, err := s.WatchFactory("test", testFactoryConfig, got.handle,
+		WithCursorKey("pairs"), WithStartBlock(1), WithWatchBatchSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The child's logs up to the block it was found at are backfilled from
+	// its creation block, including the one next to the creation event.
+	blocks := got.wait(t, 4)
+	slices.Sort(blocks)
+	if want := []uint64{5, 5, 12, 18}; !slices.Equal(blocks, want) {
+		t.Errorf("delivered blocks %v, want %v", blocks, want)
+	}
+	eventually(t, "the child to be stored as backfilled", func() bool {
+		children, _ := store.Load("pairs")
+		return len(children) == 1 && children[0] == factory.Child{Address: testChild, Block: 5, Backfilled: true}
+	})
+}
+
+func TestWatchFactoryResumesBackfill(t *testing.T) {
+	tests := []struct {
+		name       string
+		backfilled bool
+		want       []uint64
+	}{
+		{name: "unfinished backfill", want: []uint64{6, 8, 12}},
+		{name: "finished backfill", backfilled: true, want: []uint64{12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &logChain{head: 20, logs: []event.Log{
+				logAt(testChild, 6, 0),
+				logAt(testChild, 8, 0),
+				logAt(testChild, 12, 0),
+			}}
+			store := factory.NewMemory()
+			store.Add("pairs", factory.Child{Address: testChild, Block: 5, Backfilled: tt.backfilled})
+			cur := cursor.NewMemory()
+			cur.Save("pairs", 10)
+
+			s := newTestSonar(WithFactoryStore(store), WithCursor(cur), WithPollInterval(time.Millisecond))
+			defer s.Shutdown(context.Background())
+			if err := s.AddChain(c); err != nil {
+				t.Fatal(err)
+			}
+			got := newCollector()
+			if _, err := s.WatchFactory("test", testFactoryConfig, got.handle, WithCursorKey("pairs")); err != nil {
+				t.Fatal(err)
+			}
+
+			blocks := got.wait(t, len(tt.want))
+			if !slices.Equal(blocks, tt.want) {
+				t.Errorf("delivered blocks %v, want %v", blocks, tt.want)
+			}
+			eventually(t, "the child to be stored as backfilled", func() bool {
+				children, _ := store.Load("pairs")
+				return len(children) == 1 && children[0].Backfilled
+			})
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sort"
+)
+
+// Fingerprint returns a stable identifier for the logs the query selects.
+// Queries matching the same addresses and topics share a fingerprint
+// regardless of the order addresses or OR-ed topics were given in, and
+// trailing wildcard topic positions, which match any log, are ignored. The
+// block range is not part of the fingerprint.
+func (q Query) Fingerprint() string {
+	h := sha256.New()
+
+	addrs := make([][]byte, len(q.Addresses))
+	for i := range q.Addresses {
+		addrs[i] = q.Addresses[i][:]
+	}
+	writeSet(h, addrs)
+
+	topics := q.Topics
+	for len(topics) > 0 && len(topics[len(topics)-1]) == 0 {
+		topics = topics[:len(topics)-1]
+	}
+	for _, position := range topics {
+		hashes := make([][]byte, len(position))
+		for i := range position {
+			hashes[i] = position[i][:]
+		}
+		writeSet(h, hashes)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// writeSet writes the sorted, deduplicated items prefixed by their count, so
+// that consecutive sets cannot be confused with one another.
+func writeSet(w io.Writer, items [][]byte) {
+	sort.Slice(items, func(i, j int) bool {
+		return bytes.Compare(items[i], items[j]) < 0
+	})
+	unique := items[:0]
+	for _, item := range items {
+		if len(unique) > 0 && bytes.Equal(unique[len(unique)-1], item) {
+			continue
+		}
+		unique = append(unique, item)
+	}
+
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(unique)))
+	w.Write(n[:])
+	for _, item := range unique {
+		w.Write(item)
+	}
+}
@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/hedeqiang/sonar/event"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	addr1, addr2 := event.Address{1}, event.Address{2}
+	topicA, topicB, topicC := event.Hash{0xa}, event.Hash{0xb}, event.Hash{0xc}
+	from, to := uint64(100), uint64(200)
+
+	base := Query{Addresses: []event.Address{addr1, addr2}, Topics: [][]event.Hash{{topicA}, {topicB, topicC}}}
+
+	tests := []struct {
+		name string
+		q    Query
+		same bool // whether q shares the fingerprint of base
+	}{
+		{name: "identical", q: base, same: true},
+		{name: "addresses reordered", q: Query{Addresses: []event.Address{addr2, addr1}, Topics: base.Topics}, same: true},
+		{name: "OR-ed topics reordered", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA}, {topicC, topicB}}}, same: true},
+		{name: "duplicate address", q: Query{Addresses: []event.Address{addr1, addr2, addr1}, Topics: base.Topics}, same: true},
+		{name: "block range ignored", q: Query{Addresses: base.Addresses, Topics: base.Topics, FromBlock: &from, ToBlock: &to}, same: true},
+		{name: "address removed", q: Query{Addresses: []event.Address{addr1}, Topics: base.Topics}, same: false},
+		{name: "topic removed", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA}, {topicB}}}, same: false},
+		{name: "topic moved to another position", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA, topicB}, {topicC}}}, same: false},
+		{name: "positions swapped", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicB, topicC}, {topicA}}}, same: false},
+		{name: "trailing wildcard position", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA}, {topicB, topicC}, {}}}, same: true},
+		{name: "trailing wildcard positions", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA}, {topicB, topicC}, {}, nil}}, same: true},
+		{name: "wildcard position before a topic", q: Query{Addresses: base.Addresses, Topics: [][]event.Hash{{topicA}, {}, {topicB, topicC}}}, same: false},
+		{name: "empty query", q: Query{}, same: false},
+	}
+	want := base.Fingerprint()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.q.Fingerprint()
+			if (got == want) != tt.same {
+				t.Errorf("Fingerprint = %s, base %s; same = %v, want %v", got, want, got == want, tt.same)
+			}
+			if len(got) != 16 {
+				t.Errorf("Fingerprint %q has %d characters, want 16", got, len(got))
+			}
+		})
+	}
+}
+
+func TestQueryFingerprintAddressTopicSeparation(t *testing.T) {
+	// An address and a topic must not be confused even when the bytes
+	// written for them line up.
+	var h event.Hash
+	var a event.Address
+	onlyAddr := Query{Addresses: []event.Address{a}}
+	onlyTopic := Query{Topics: [][]event.Hash{{h}}}
+	if onlyAddr.Fingerprint() == onlyTopic.Fingerprint() {
+		t.Error("a query on an address and one on a topic share a fingerprint")
+	}
+}
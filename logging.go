@@ -0,0 +1,49 @@
+package sonar
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// newLogger returns the logger Sonar writes to: base, or a text logger on
+// stderr if base is nil, filtered to records at or above level.
+func newLogger(base *slog.Logger, level string) *slog.Logger {
+	if base == nil {
+		base = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	return slog.New(&levelHandler{next: base.Handler(), level: parseLevel(level)})
+}
+
+// parseLevel parses a level name such as "debug" or "warn". Unknown names
+// fall back to info.
+func parseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// levelHandler drops records below a minimum level before they reach the
+// wrapped handler, whatever level that handler is configured with.
+type levelHandler struct {
+	next  slog.Handler
+	level slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), level: h.level}
+}
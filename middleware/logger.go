@@ -2,13 +2,26 @@ package middleware
 
 import (
 	"log"
+	"log/slog"
 
 	"github.com/hedeqiang/sonar/event"
 )
 
+// Logged is implemented by middleware that logs through a slog.Logger.
+// Sonar passes its logger to every middleware added with Use that has none.
+type Logged interface {
+	// Logger returns the slog logger set on the middleware, or nil if none
+	// is set.
+	Logger() *slog.Logger
+
+	SetLogger(l *slog.Logger)
+}
+
 // Logger logs each event log that passes through the pipeline.
 type Logger struct {
-	logger *log.Logger
+	logger     *log.Logger
+	slog       *slog.Logger // set by NewSlogLogger or SetLogger
+	structured bool         // created by NewSlogLogger
 }
 
 // NewLogger creates a logging middleware using the provided logger.
@@ -20,9 +33,49 @@ func NewLogger(l *log.Logger) *Logger {
 	return &Logger{logger: l}
 }
 
+// NewSlogLogger creates a logging middleware that logs a structured record
+// at info level to the provided logger. If logger is nil, Sonar's logger is
+// used once the middleware is added with Use, so that records honor
+// WithLogLevel; outside Sonar, slog.Default is used.
+func NewSlogLogger(l *slog.Logger) *Logger {
+	return &Logger{slog: l, structured: true}
+}
+
+// Logger returns the slog logger of a middleware created by NewSlogLogger,
+// or nil if none is set.
+func (l *Logger) Logger() *slog.Logger {
+	return l.slog
+}
+
+// SetLogger sets the slog logger of a middleware created by NewSlogLogger.
+// It has no effect on one created by NewLogger. It must be called before
+// Wrap.
+func (l *Logger) SetLogger(sl *slog.Logger) {
+	if l.structured {
+		l.slog = sl
+	}
+}
+
 // Wrap decorates the handler with event logging.
 func (l *Logger) Wrap(next Handler) Handler {
+	sl := l.slog
+	if l.structured && sl == nil {
+		sl = slog.Default()
+	}
 	return func(lg event.Log) *event.Log {
+		if sl != nil {
+			sl.Info("event log",
+				"chain", lg.Chain,
+				"block", lg.BlockNumber,
+				"tx", lg.TxHash.Hex(),
+				"log_index", lg.LogIndex,
+				"address", lg.Address.Hex(),
+				"topic0", lg.EventSignature().Hex(),
+				"removed", lg.Removed,
+			)
+			return next(lg)
+		}
+
 		sig := lg.EventSignature()
 		l.logger.Printf("[sonar] chain=%s block=%d tx=%x logIndex=%d addr=%x topic0=%x",
 			lg.Chain,
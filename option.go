@@ -1,10 +1,16 @@
 package sonar
 
 import (
+	"log/slog"
 	"time"
 
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/coverage"
 	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/deadletter"
 	"github.com/hedeqiang/sonar/decoder"
+	"github.com/hedeqiang/sonar/dedup"
+	"github.com/hedeqiang/sonar/factory"
 	"github.com/hedeqiang/sonar/middleware"
 	"github.com/hedeqiang/sonar/retry"
 	"github.com/hedeqiang/sonar/watcher"
@@ -20,13 +26,94 @@ func WithCursor(c cursor.Cursor) Option {
 	}
 }
 
-// WithRetry sets the retry strategy for failed RPC calls.
+// WithCursorMigration carries progress saved under a chain ID, as watchers did
+// before per-watch cursor keys, over to the key of the first watch started on
+// that chain without progress of its own. The chain-keyed entry is then
+// cleared, so that later watches on the chain do not resume from it too.
+// Without this option, a watch that finds such an entry logs a warning.
+func WithCursorMigration() Option {
+	return func(s *Sonar) {
+		s.migrateCursors = true
+	}
+}
+
+// WithRetry sets the retry strategy for failed RPC calls made by watchers.
 func WithRetry(strategy retry.Strategy) Option {
 	return func(s *Sonar) {
 		s.retry = strategy
 	}
 }
 
+// WithChainRetry sets the retry strategy for RPC calls on a single chain,
+// overriding the strategy set with WithRetry.
+func WithChainRetry(chainID string, strategy retry.Strategy) Option {
+	return func(s *Sonar) {
+		s.chainRetry[chainID] = strategy
+	}
+}
+
+// WithChainDefaults sets watch options applied to every watch on a chain,
+// e.g. confirmations suited to its finality. Options given to an individual
+// Watch call take precedence. WithWatchID and WithCursorKey must not be used
+// here.
+func WithChainDefaults(chainID string, opts ...WatchOption) Option {
+	return func(s *Sonar) {
+		s.chainDefaults[chainID] = append(s.chainDefaults[chainID], opts...)
+	}
+}
+
+// WithDeadLetter puts logs whose handlers keep failing into q, so that a
+// single poison log cannot block a watch. A log is dead-lettered after
+// maxAttempts failed handler calls, counting retries and redeliveries, or at
+// once if the handler returns an error marked with retry.Permanent.
+func WithDeadLetter(q deadletter.Queue, maxAttempts int) Option {
+	return func(s *Sonar) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		s.deadLetters = q
+		s.deadLetterAttempts = maxAttempts
+	}
+}
+
+// WithFactoryStore persists the children discovered by WatchFactory watches
+// in st, so that a restart resumes watching them. Defaults to an in-memory
+// store.
+func WithFactoryStore(st factory.Store) Option {
+	return func(s *Sonar) {
+		s.factories = st
+	}
+}
+
+// WithCoverage records the block ranges each watch and replay has fully
+// processed in st, under their cursor keys, so that skipped ranges show up
+// as gaps in Status and Gaps across restarts. Defaults to an in-memory store.
+func WithCoverage(st coverage.Store) Option {
+	return func(s *Sonar) {
+		s.coverage = st
+	}
+}
+
+// WithGapRepair makes watches that can backfill, i.e. polling and hybrid log
+// watches, backfill each gap found in their coverage with their current
+// query, including gaps recorded before they started. Repaired gaps are
+// recorded as covered once their backfill completes.
+func WithGapRepair() Option {
+	return func(s *Sonar) {
+		s.repairGaps = true
+	}
+}
+
+// WithDedup suppresses logs that a watch already handled, before they reach
+// middleware. Logs are remembered per watch ID once the handler acknowledges
+// them, so a persistent filter created with dedup.NewFile only works across
+// restarts for watches with stable IDs (see WithWatchID).
+func WithDedup(f *dedup.Filter) Option {
+	return func(s *Sonar) {
+		s.dedup = f
+	}
+}
+
 // WithMiddleware adds middleware to the event processing pipeline.
 func WithMiddleware(mw ...middleware.Middleware) Option {
 	return func(s *Sonar) {
@@ -34,6 +121,13 @@ func WithMiddleware(mw ...middleware.Middleware) Option {
 	}
 }
 
+// WithWatchMode selects how Watch receives logs: polling, streaming or hybrid.
+func WithWatchMode(mode WatchMode) Option {
+	return func(s *Sonar) {
+		s.config.Mode = mode
+	}
+}
+
 // WithPollerConfig overrides the default polling configuration.
 func WithPollerConfig(cfg watcher.PollerConfig) Option {
 	return func(s *Sonar) {
@@ -55,13 +149,53 @@ func WithBatchSize(size uint64) Option {
 	}
 }
 
-// WithConfirmations sets the number of confirmation blocks to wait.
+// WithCatchUpBatchSize sets the number of blocks per query while a watcher is
+// behind the chain head, e.g. after starting from an old block.
+func WithCatchUpBatchSize(size uint64) Option {
+	return func(s *Sonar) {
+		s.config.Poller.CatchUpBatchSize = size
+	}
+}
+
+// WithBatchSizeLimits bounds the adaptive block window used for eth_getLogs.
+// The window shrinks towards min when the provider rejects a range as too
+// large and grows back towards max after successful queries.
+func WithBatchSizeLimits(min, max uint64) Option {
+	return func(s *Sonar) {
+		s.config.Poller.MinBatchSize = min
+		s.config.Poller.MaxBatchSize = max
+	}
+}
+
+// WithConfirmations sets the number of confirmation blocks to wait. They
+// apply under the chain.TagLatest finality mode, which they select unless a
+// mode is set with WithFinality, and as the fallback when a node rejects the
+// configured block tag. Without them a watch whose tag is rejected fails.
 func WithConfirmations(n uint64) Option {
 	return func(s *Sonar) {
 		s.config.Poller.Confirmations = n
 	}
 }
 
+// WithFinality sets the finality mode of polling watchers: chain.TagLatest
+// for the latest block minus confirmations, or chain.TagSafe or
+// chain.TagFinalized for the block the node reports under that tag. By
+// default the chain's recommended mode is used, unless confirmations are
+// set; see the constructors of the built-in chains.
+func WithFinality(tag chain.BlockTag) Option {
+	return func(s *Sonar) {
+		s.config.Poller.Finality = tag
+	}
+}
+
+// WithReorgDepth sets how many recent blocks are remembered for chain
+// reorganization detection. Zero disables detection.
+func WithReorgDepth(n uint64) Option {
+	return func(s *Sonar) {
+		s.config.Poller.ReorgDepth = n
+	}
+}
+
 // WithLogLevel sets the log verbosity level.
 func WithLogLevel(level string) Option {
 	return func(s *Sonar) {
@@ -69,6 +203,24 @@ func WithLogLevel(level string) Option {
 	}
 }
 
+// WithLogger sets the structured logger, e.g. one with a JSON handler for log
+// aggregation. Records are filtered by the level set with WithLogLevel.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Sonar) {
+		s.config.Logger = l
+	}
+}
+
+// WithErrorHandler sets a function called with every error a watch or replay
+// reports, e.g. to page on KindFatal errors and ignore KindTransient ones.
+// It is called on the watch's goroutine, so it should return quickly. Errors
+// are logged whether or not a handler is set.
+func WithErrorHandler(fn func(WatchError)) Option {
+	return func(s *Sonar) {
+		s.errorHandler = fn
+	}
+}
+
 // WithDecoder sets the event decoder for ABI decoding.
 func WithDecoder(d decoder.Decoder) Option {
 	return func(s *Sonar) {
@@ -1,10 +1,15 @@
 package retry
 
 import (
+	"errors"
 	"sync"
 	"time"
 )
 
+// ErrCircuitOpen is returned for requests rejected by an open circuit breaker.
+// Do does not retry errors wrapping it.
+var ErrCircuitOpen = errors.New("retry: circuit breaker is open")
+
 // State represents the circuit breaker state.
 type State int
 
@@ -17,6 +22,20 @@ const (
 	HalfOpen
 )
 
+// String returns the lower-case name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
 // CircuitBreaker prevents cascading failures by tracking error rates and
 // temporarily halting requests when failures exceed a threshold.
 type CircuitBreaker struct {
@@ -26,6 +45,7 @@ type CircuitBreaker struct {
 	threshold    int
 	resetTimeout time.Duration
 	lastFailure  time.Time
+	onChange     func(from, to State)
 }
 
 // NewCircuitBreaker creates a circuit breaker that opens after threshold
@@ -37,26 +57,39 @@ func NewCircuitBreaker(threshold int, resetTimeout time.Duration) *CircuitBreake
 	}
 }
 
+// OnStateChange registers a callback invoked after every state transition.
+// The callback runs synchronously and must not call back into the breaker.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to State)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onChange = fn
+}
+
 // Allow reports whether a request is permitted.
 // In Closed state, it always allows. In Open state, it checks if the reset
 // timeout has elapsed (transitioning to HalfOpen). In HalfOpen state, it allows
 // one probe request.
 func (cb *CircuitBreaker) Allow() bool {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
 
 	switch cb.state {
 	case Closed:
+		cb.mu.Unlock()
 		return true
 	case Open:
 		if time.Since(cb.lastFailure) > cb.resetTimeout {
-			cb.state = HalfOpen
+			notify := cb.transition(HalfOpen)
+			cb.mu.Unlock()
+			notify()
 			return true
 		}
+		cb.mu.Unlock()
 		return false
 	case HalfOpen:
+		cb.mu.Unlock()
 		return true
 	default:
+		cb.mu.Unlock()
 		return false
 	}
 }
@@ -64,21 +97,38 @@ func (cb *CircuitBreaker) Allow() bool {
 // RecordSuccess records a successful operation, resetting the breaker to Closed.
 func (cb *CircuitBreaker) RecordSuccess() {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
 	cb.failures = 0
-	cb.state = Closed
+	notify := cb.transition(Closed)
+	cb.mu.Unlock()
+	notify()
 }
 
 // RecordFailure records a failed operation. If failures reach the threshold,
 // the breaker transitions to Open.
 func (cb *CircuitBreaker) RecordFailure() {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
 	cb.failures++
 	cb.lastFailure = time.Now()
+	notify := func() {}
 	if cb.failures >= cb.threshold {
-		cb.state = Open
+		notify = cb.transition(Open)
 	}
+	cb.mu.Unlock()
+	notify()
+}
+
+// Execute runs fn if the breaker allows it and records the outcome.
+// It returns ErrCircuitOpen without calling fn while the circuit is open.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	if !cb.Allow() {
+		return ErrCircuitOpen
+	}
+	if err := fn(); err != nil {
+		cb.RecordFailure()
+		return err
+	}
+	cb.RecordSuccess()
+	return nil
 }
 
 // State returns the current state of the circuit breaker.
@@ -87,3 +137,16 @@ func (cb *CircuitBreaker) CurrentState() State {
 	defer cb.mu.Unlock()
 	return cb.state
 }
+
+// transition moves the breaker to state and returns a function that notifies
+// the state-change callback. It must be called with cb.mu held; the returned
+// function must be called after the lock is released.
+func (cb *CircuitBreaker) transition(to State) func() {
+	from := cb.state
+	cb.state = to
+	fn := cb.onChange
+	if from == to || fn == nil {
+		return func() {}
+	}
+	return func() { fn(from, to) }
+}
@@ -3,6 +3,7 @@ package retry
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
@@ -14,19 +15,33 @@ type Strategy interface {
 }
 
 // Do executes fn, retrying according to the given strategy on non-nil errors.
-// It respects context cancellation.
+// It respects context cancellation. A nil strategy runs fn exactly once.
+// Errors wrapping ErrCircuitOpen and errors marked with Permanent are returned
+// immediately, the latter without the marker but with any context wrapped
+// around it. Once the strategy gives up, the last error is returned wrapped
+// so that Attempts reports how often fn was called.
 func Do(ctx context.Context, s Strategy, fn func(ctx context.Context) error) error {
+	if s == nil {
+		return fn(ctx)
+	}
+
 	var attempt int
 	for {
 		err := fn(ctx)
 		if err == nil {
 			return nil
 		}
+		if errors.Is(err, ErrCircuitOpen) {
+			return err
+		}
+		if IsPermanent(err) {
+			return unmark(err)
+		}
 
 		attempt++
 		delay, ok := s.Next(attempt)
 		if !ok {
-			return err
+			return &exhaustedError{err: err, attempts: attempt}
 		}
 
 		select {
@@ -36,3 +51,74 @@ func Do(ctx context.Context, s Strategy, fn func(ctx context.Context) error) err
 		}
 	}
 }
+
+// Permanent marks err as not worth retrying. Do returns the wrapped error
+// without further attempts.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// Attempts returns the number of calls Do made before giving up on err, or 1
+// if err was not returned by Do after retries.
+func Attempts(err error) int {
+	var ex *exhaustedError
+	if errors.As(err, &ex) {
+		return ex.attempts
+	}
+	return 1
+}
+
+// exhaustedError is the last error of a call retried until the strategy
+// gave up.
+type exhaustedError struct {
+	err      error
+	attempts int
+}
+
+func (e *exhaustedError) Error() string { return e.err.Error() }
+
+func (e *exhaustedError) Unwrap() error { return e.err }
+
+// unmark returns err without the Permanent marker, keeping the context
+// wrapped around it.
+func unmark(err error) error {
+	if perm, ok := err.(*permanentError); ok {
+		return perm.err
+	}
+	return &unmarkedError{err: err}
+}
+
+// unmarkedError is an error wrapping a Permanent marker further down its
+// chain. It has the message of err and matches what err matches, except the
+// marker, which cannot be cut out of another error's chain.
+type unmarkedError struct {
+	err error
+}
+
+func (e *unmarkedError) Error() string { return e.err.Error() }
+
+func (e *unmarkedError) Is(target error) bool { return errors.Is(e.err, target) }
+
+func (e *unmarkedError) As(target any) bool {
+	if _, ok := target.(**permanentError); ok {
+		return false
+	}
+	return errors.As(e.err, target)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
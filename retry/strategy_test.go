@@ -0,0 +1,126 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fixed retries up to max times without delay.
+type fixed struct{ max int }
+
+func (f fixed) Next(attempt int) (time.Duration, bool) { return 0, attempt <= f.max }
+
+func TestDo(t *testing.T) {
+	errFail := errors.New("fail")
+
+	tests := []struct {
+		name         string
+		strategy     Strategy
+		errs         []error // returned by successive calls; nil after the last
+		wantCalls    int
+		wantErr      error
+		wantAttempts int
+		wantPerm     bool
+	}{
+		{name: "success", strategy: fixed{3}, wantCalls: 1},
+		{name: "retried until success", strategy: fixed{3}, errs: []error{errFail, errFail}, wantCalls: 3},
+		{name: "exhausted", strategy: fixed{2}, errs: []error{errFail, errFail, errFail, errFail}, wantCalls: 3, wantErr: errFail, wantAttempts: 3},
+		{name: "nil strategy", strategy: nil, errs: []error{errFail}, wantCalls: 1, wantErr: errFail, wantAttempts: 1},
+		{name: "permanent", strategy: fixed{3}, errs: []error{Permanent(errFail)}, wantCalls: 1, wantErr: errFail, wantAttempts: 1},
+		{name: "permanent after retries", strategy: fixed{3}, errs: []error{errFail, Permanent(errFail)}, wantCalls: 2, wantErr: errFail, wantAttempts: 1},
+		{name: "circuit open", strategy: fixed{3}, errs: []error{ErrCircuitOpen}, wantCalls: 1, wantErr: ErrCircuitOpen, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), tt.strategy, func(ctx context.Context) error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Do: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Do error = %v, want %v", err, tt.wantErr)
+			}
+			if got := Attempts(err); got != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", got, tt.wantAttempts)
+			}
+			if IsPermanent(err) {
+				t.Errorf("Do returned the Permanent marker instead of the error it wraps")
+			}
+		})
+	}
+}
+
+// codeError is an error type callers match with errors.As.
+type codeError struct{ code int }
+
+func (e *codeError) Error() string { return fmt.Sprintf("code %d", e.code) }
+
+func TestDoKeepsWrappingOfPermanent(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantMsg string
+	}{
+		{name: "marker outermost", err: Permanent(fmt.Errorf("decode: %w", &codeError{7})), wantMsg: "decode: code 7"},
+		{name: "marker wrapped", err: fmt.Errorf("decode: %w", Permanent(&codeError{7})), wantMsg: "decode: code 7"},
+		{name: "marker wrapped twice", err: fmt.Errorf("handler: %w", fmt.Errorf("decode: %w", Permanent(&codeError{7}))), wantMsg: "handler: decode: code 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Do(context.Background(), fixed{3}, func(ctx context.Context) error {
+				return tt.err
+			})
+			if err == nil || err.Error() != tt.wantMsg {
+				t.Fatalf("Do = %v, want %q", err, tt.wantMsg)
+			}
+			var ce *codeError
+			if !errors.As(err, &ce) || ce.code != 7 {
+				t.Errorf("errors.As found %v, want the code error", ce)
+			}
+			if IsPermanent(err) {
+				t.Errorf("Do returned the Permanent marker")
+			}
+		})
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	errFail := errors.New("fail")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: Permanent(nil), want: false},
+		{name: "plain error", err: errFail, want: false},
+		{name: "marked", err: Permanent(errFail), want: true},
+		{name: "wrapped marker", err: fmt.Errorf("call: %w", Permanent(errFail)), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if tt.err != nil && !errors.Is(tt.err, errFail) {
+				t.Errorf("%v does not match the error it marks", tt.err)
+			}
+		})
+	}
+}
@@ -15,20 +15,29 @@
 //	    filter.WithAddresses(addr),
 //	)
 //
-//	s.Watch("ethereum", q, func(log event.Log) {
+//	h, err := s.Watch("ethereum", q, func(log event.Log) {
 //	    fmt.Println("event:", log.BlockNumber)
 //	})
+//	...
+//	s.Unwatch(h.ID())
 package sonar
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
 
 	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/coverage"
 	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/deadletter"
 	"github.com/hedeqiang/sonar/decoder"
+	"github.com/hedeqiang/sonar/dedup"
 	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/factory"
 	"github.com/hedeqiang/sonar/filter"
 	"github.com/hedeqiang/sonar/middleware"
 	"github.com/hedeqiang/sonar/retry"
@@ -37,42 +46,130 @@ import (
 
 // Sonar is the main SDK entry point for multi-chain event log monitoring.
 type Sonar struct {
-	registry    *chain.Registry
-	cursor      cursor.Cursor
-	retry       retry.Strategy
-	decoder     decoder.Decoder
-	middlewares []middleware.Middleware
-	config      Config
+	registry      *chain.Registry
+	cursor        cursor.Cursor
+	retry         retry.Strategy
+	chainRetry    map[string]retry.Strategy
+	chainDefaults map[string][]WatchOption
+	decoder       decoder.Decoder
+	middlewares   []middleware.Middleware
+	config        Config
+	logger        *slog.Logger
 
-	mu       sync.Mutex
-	watchers map[string]watcher.Watcher
-	shutdown bool
+	errorHandler func(WatchError)
+
+	deadLetters        deadletter.Queue
+	deadLetterAttempts int
+
+	dedup *dedup.Filter
+
+	factories factory.Store
+
+	coverage   coverage.Store
+	repairGaps bool
+	covMu      sync.Mutex
+	covered    map[string]*coverageState   // keyed by cursor key
+	covPending map[string]*pendingCoverage // recorded but not yet stored, keyed by cursor key
+	covFlush   chan struct{}               // closed when the running flush ends; nil if none runs
+
+	migrateCursors bool
+	legacyWarned   map[string]bool // chains warned about by warnLegacyCursor
+
+	mu        sync.Mutex
+	watchers  map[string]*Handle // keyed by watch ID
+	seq       uint64
+	shutdown  bool
+	pausedAll bool // watches start paused until ResumeAll
 }
 
 // New creates a new Sonar instance with the given options.
 func New(opts ...Option) *Sonar {
 	s := &Sonar{
-		registry: chain.NewRegistry(),
-		cursor:   cursor.NewMemory(),
-		config:   DefaultConfig(),
-		watchers: make(map[string]watcher.Watcher),
+		registry:      chain.NewRegistry(),
+		cursor:        cursor.NewMemory(),
+		chainRetry:    make(map[string]retry.Strategy),
+		chainDefaults: make(map[string][]WatchOption),
+		config:        DefaultConfig(),
+		factories:     factory.NewMemory(),
+		coverage:      coverage.NewMemory(),
+		covered:       make(map[string]*coverageState),
+		covPending:    make(map[string]*pendingCoverage),
+		legacyWarned:  make(map[string]bool),
+		watchers:      make(map[string]*Handle),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.logger = newLogger(s.config.Logger, s.config.LogLevel)
 	return s
 }
 
 // AddChain registers a chain implementation. Returns an error if the chain ID
-// is already registered.
+// is already registered. Chains that log their RPC traffic and have no logger
+// of their own are given Sonar's.
 func (s *Sonar) AddChain(c chain.Chain) error {
-	return s.registry.Register(c)
+	if err := s.registry.Register(c); err != nil {
+		return err
+	}
+	if l, ok := c.(chain.Logged); ok && l.Logger() == nil {
+		l.SetLogger(s.logger)
+	}
+	return nil
 }
 
 // Watch begins monitoring the specified chain for events matching the query.
 // The handler is called for each event log that passes through the middleware pipeline.
-// This method launches a background goroutine and returns immediately.
-func (s *Sonar) Watch(chainID string, query filter.Query, handler func(event.Log)) error {
+// Logs are received according to the configured WatchMode (polling by default).
+// Any number of watches may run on the same chain; the returned handle
+// identifies this one. This method launches a background goroutine and returns
+// immediately.
+func (s *Sonar) Watch(chainID string, query filter.Query, handler func(event.Log), opts ...WatchOption) (*Handle, error) {
+	return s.watch(chainID, query, s.config.Mode, acked(handler), nil, opts)
+}
+
+// WatchE is like Watch, but the handler acknowledges each log. A log the
+// handler returns an error for is retried under the chain's retry strategy,
+// and the watch never saves progress past its block, so a failed log is
+// delivered again after a restart. Delivery is at least once: logs from a
+// partially handled block may be delivered again. Streaming watches only
+// report handler errors.
+func (s *Sonar) WatchE(chainID string, query filter.Query, handler func(event.Log) error, opts ...WatchOption) (*Handle, error) {
+	return s.watch(chainID, query, s.config.Mode, handler, nil, opts)
+}
+
+// WatchBatch polls the specified chain and delivers each scanned block range
+// as one batch, regardless of the configured WatchMode. Every log passes
+// through the middleware pipeline first; logs dropped by middleware are left
+// out of the batch. The watch only saves progress past a range once the
+// handler returns nil for its batch; a failed batch is retried under the
+// chain's retry strategy and scanned again on the next cycle. Ranges without
+// logs are skipped unless WithEmptyBatches is set. Batches are not
+// dead-lettered.
+func (s *Sonar) WatchBatch(chainID string, query filter.Query, handler func(event.Batch) error, opts ...WatchOption) (*Handle, error) {
+	return s.watch(chainID, query, ModePoll, nil, handler, opts)
+}
+
+// Stream begins monitoring the specified chain through a real-time subscription,
+// regardless of the configured WatchMode. The chain must be reachable over
+// WebSocket. This method launches a background goroutine and returns immediately.
+func (s *Sonar) Stream(chainID string, query filter.Query, handler func(event.Log), opts ...WatchOption) (*Handle, error) {
+	return s.watch(chainID, query, ModeStream, acked(handler), nil, opts)
+}
+
+// Replay scans the block range set on the query (FromBlock and ToBlock) and
+// passes every log through the middleware pipeline to the handler.
+// It blocks until the range is complete, ctx is cancelled, or a range still
+// fails after retries, in which case the error names the failed range, and
+// until the coverage it recorded is stored.
+// Batch size and interval watch options apply; other options are ignored.
+func (s *Sonar) Replay(ctx context.Context, chainID string, query filter.Query, handler func(event.Log), opts ...WatchOption) error {
+	return s.ReplayE(ctx, chainID, query, acked(handler), opts...)
+}
+
+// ReplayE is like Replay, but the handler acknowledges each log. A log the
+// handler still fails on after retries stops the replay with an error, unless
+// it is dead-lettered.
+func (s *Sonar) ReplayE(ctx context.Context, chainID string, query filter.Query, handler func(event.Log) error, opts ...WatchOption) error {
 	s.mu.Lock()
 	if s.shutdown {
 		s.mu.Unlock()
@@ -85,67 +182,445 @@ func (s *Sonar) Watch(chainID string, query filter.Query, handler func(event.Log
 		return fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
 	}
 
-	// Build the middleware pipeline
-	finalHandler := buildHandler(handler, s.middlewares)
+	o := s.watchOptions(chainID, opts)
+	key := o.CursorKey
+	if key == "" {
+		key = CursorKey(chainID, query)
+	}
+	if err := s.loadCoverage(key); err != nil {
+		return err
+	}
 
-	// Create poller watcher
-	p := watcher.NewPoller(c, query, s.cursor, s.config.Poller)
-	p.OnEvent(func(log event.Log) {
-		result := finalHandler(log)
-		if result == nil {
-			return // dropped by middleware
-		}
+	cfg := s.pollerConfig(chainID, o)
+	r := watcher.NewReplayWithConfig(c, query, watcher.ReplayConfig{
+		BatchSize:    cfg.BatchSize,
+		MinBatchSize: cfg.MinBatchSize,
+		MaxBatchSize: cfg.MaxBatchSize,
+		Retry:        cfg.Retry,
+		Interval:     cfg.Interval,
+		Logger:       s.logger.With("chain", chainID),
 	})
-	p.OnError(func(err error) {
-		// TODO: configurable error handler
-		fmt.Printf("[sonar] chain=%s error: %v\n", chainID, err)
+	handler = s.skipDecodeErrors(chainID, "", handler)
+	s.attach(r, chainID, "", s.deadLetterHandler(chainID, "", nil, nil, s.maxAttempts(cfg.Retry, false), handler))
+	r.OnCovered(func(from, to uint64) {
+		s.cover(chainID, "", key, coverage.Range{From: from, To: to})
 	})
+	defer s.waitCoverage()
+
+	if err := r.WatchContext(ctx); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// watch creates a watcher for the given mode and runs it in the background.
+// If batch is set, the watcher polls and delivers batches instead of logs.
+func (s *Sonar) watch(chainID string, query filter.Query, mode WatchMode, handler func(event.Log) error, batch func(event.Batch) error, opts []WatchOption) (*Handle, error) {
+	o := s.watchOptions(chainID, opts)
+
+	c, ok := s.registry.Get(chainID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChainNotFound, chainID)
+	}
+
+	// Streaming watches do not track progress and have no cursor key.
+	var key string
+	derived := false
+	if mode != ModeStream {
+		if o.CursorKey == "" {
+			derived = true
+			o.CursorKey = CursorKey(chainID, query)
+		}
+		key = o.CursorKey
+		if s.migrateCursors {
+			if _, err := cursor.Migrate(s.cursor, chainID, key); err != nil {
+				return nil, err
+			}
+		} else {
+			s.warnLegacyCursor(chainID, key)
+		}
+		if err := s.loadCoverage(key); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reserve the watch ID first so that the watcher logs under it.
+	id, seq := s.reserveID(chainID, o)
+	logger := s.logger.With("chain", chainID, "watch", id)
 
+	cfg := s.pollerConfig(chainID, o)
+	cfg.Logger = logger
+
+	var w watcher.Watcher
+	switch mode {
+	case ModeStream:
+		st := watcher.NewStreamer(c, query)
+		st.SetLogger(logger)
+		w = st
+	case ModeHybrid:
+		w = watcher.NewHybrid(c, query, s.cursor, cfg)
+	default:
+		w = watcher.NewPoller(c, query, s.cursor, cfg)
+	}
+	if cu, ok := w.(interface{ OnCaughtUp(func(uint64)) }); ok && o.OnCaughtUp != nil {
+		cu.OnCaughtUp(o.OnCaughtUp)
+	}
+
+	h := &Handle{
+		id:      id,
+		seq:     seq,
+		chain:   chainID,
+		mode:    mode,
+		query:   query,
+		named:   o.ID != "",
+		key:     key,
+		derived: derived,
+		w:       w,
+		handler: handler,
+		s:       s,
+		done:    make(chan struct{}),
+	}
+	if err := s.register(h); err != nil {
+		return nil, err
+	}
+
+	if p, ok := w.(*watcher.Poller); ok && batch != nil {
+		p.OnBatch(s.dedupBatchHandler(chainID, h.id, cfg.EmptyBatches, buildBatchHandler(batch, s.middlewares, cfg.EmptyBatches)))
+		w.OnError(func(err error) {
+			s.reportError(chainID, h.id, err)
+		})
+	} else {
+		// Only streams do not deliver a failed log again.
+		attempts := s.maxAttempts(cfg.Retry, mode != ModeStream)
+		handler = s.skipDecodeErrors(chainID, h.id, handler)
+		s.attach(w, chainID, h.id, s.deadLetterHandler(chainID, h.id, h.CursorKey, h.cursor, attempts, handler))
+	}
+	s.trackCoverage(h)
+	s.start(h, logger)
+	return h, nil
+}
+
+// warnLegacyCursor logs a warning, once per chain, if progress is saved
+// under the chain ID, as watchers did before per-watch cursor keys: a watch
+// with key does not resume from it unless WithCursorMigration is set.
+func (s *Sonar) warnLegacyCursor(chainID, key string) {
+	if key == chainID {
+		return
+	}
 	s.mu.Lock()
-	if _, exists := s.watchers[chainID]; exists {
+	warned := s.legacyWarned[chainID]
+	s.legacyWarned[chainID] = true
+	s.mu.Unlock()
+	if warned {
+		return
+	}
+	block, err := s.cursor.Load(chainID)
+	if err != nil || block == 0 {
+		return
+	}
+	s.logger.Warn("progress saved under the chain ID is not resumed; set WithCursorMigration to carry it over",
+		"chain", chainID, "block", block, "cursor_key", key)
+}
+
+// reserveID returns the ID and sequence number of a new watch on chainID.
+func (s *Sonar) reserveID(chainID string, o WatchOptions) (string, uint64) {
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+	if o.ID != "" {
+		return o.ID, seq
+	}
+	return fmt.Sprintf("%s-%d", chainID, seq), seq
+}
+
+// register adds h to the running watches, paused if PauseAll is in effect.
+func (s *Sonar) register(h *Handle) error {
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return ErrShutdown
+	}
+	if _, exists := s.watchers[h.id]; exists {
 		s.mu.Unlock()
-		return fmt.Errorf("%w: %s", ErrAlreadyRunning, chainID)
+		return fmt.Errorf("%w: %s", ErrAlreadyRunning, h.id)
 	}
-	s.watchers[chainID] = p
+	s.watchers[h.id] = h
+	paused := s.pausedAll
 	s.mu.Unlock()
 
-	go p.Watch()
+	if p, ok := h.w.(watcher.Pauser); ok && paused {
+		p.Pause()
+	}
+	return nil
+}
+
+// start runs the watcher of h in the background, reporting the error it
+// exits with, if any.
+func (s *Sonar) start(h *Handle, logger *slog.Logger) {
+	logger.Info("watch started", "mode", h.mode.String(), "cursor_key", h.CursorKey())
 
+	go func() {
+		defer close(h.done)
+		if err := h.w.Watch(); err != nil {
+			s.report(newWatchError(h.chain, h.id, KindFatal, err))
+		}
+	}()
+}
+
+// Unwatch stops the watch with the given ID and waits for it to exit.
+// Returns ErrNotRunning if no such watch exists.
+func (s *Sonar) Unwatch(id string) error {
+	s.mu.Lock()
+	h, ok := s.watchers[id]
+	delete(s.watchers, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, id)
+	}
+	// Stop returns at once if the watcher has not started yet; its goroutine
+	// then exits as soon as it does.
+	err := h.w.Stop()
+	<-h.done
+	s.logger.Info("watch stopped", "chain", h.chain, "watch", id)
+	return err
+}
+
+// Pause halts the watch with the given ID without losing its position, e.g.
+// while the handler's database is migrated. It returns once the log or batch
+// being delivered, if any, has been handled; nothing is delivered until
+// Resume. Polling and hybrid watches continue from where they stopped and
+// keep following the chain head, so that Status shows the growing lag;
+// streaming watches miss the logs emitted while paused. Pause must not be
+// called from a handler. Returns ErrNotRunning if no such watch exists.
+func (s *Sonar) Pause(id string) error {
+	h, err := s.handle(id)
+	if err != nil {
+		return err
+	}
+	p, ok := h.w.(watcher.Pauser)
+	if !ok {
+		return fmt.Errorf("sonar: watch %s cannot be paused", id)
+	}
+	p.Pause()
+	s.logger.Info("watch paused", "chain", h.chain, "watch", id)
 	return nil
 }
 
+// Resume continues the watch with the given ID after Pause. Returns
+// ErrNotRunning if no such watch exists.
+func (s *Sonar) Resume(id string) error {
+	h, err := s.handle(id)
+	if err != nil {
+		return err
+	}
+	p, ok := h.w.(watcher.Pauser)
+	if !ok {
+		return fmt.Errorf("sonar: watch %s cannot be paused", id)
+	}
+	p.Resume()
+	s.logger.Info("watch resumed", "chain", h.chain, "watch", id)
+	return nil
+}
+
+// PauseAll pauses every running watch, as Pause does, and makes watches
+// started afterwards start paused, e.g. for a maintenance window. It returns
+// once no handler is running.
+func (s *Sonar) PauseAll() {
+	s.mu.Lock()
+	s.pausedAll = true
+	s.mu.Unlock()
+
+	for _, h := range s.handles() {
+		if p, ok := h.w.(watcher.Pauser); ok {
+			p.Pause()
+		}
+	}
+	s.logger.Info("all watches paused")
+}
+
+// ResumeAll resumes every running watch, including those paused one by one,
+// and lets new watches start running again.
+func (s *Sonar) ResumeAll() {
+	s.mu.Lock()
+	s.pausedAll = false
+	s.mu.Unlock()
+
+	for _, h := range s.handles() {
+		if p, ok := h.w.(watcher.Pauser); ok {
+			p.Resume()
+		}
+	}
+	s.logger.Info("all watches resumed")
+}
+
+// handle returns the running watch with the given ID.
+func (s *Sonar) handle(id string) (*Handle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.watchers[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotRunning, id)
+	}
+	return h, nil
+}
+
+// Watches lists the running watches in the order they were started.
+func (s *Sonar) Watches() []WatchInfo {
+	handles := s.handles()
+	infos := make([]WatchInfo, len(handles))
+	for i, h := range handles {
+		infos[i] = h.info()
+	}
+	return infos
+}
+
+// Status reports the progress of the running watches in the order they were
+// started.
+func (s *Sonar) Status() []WatchStatus {
+	handles := s.handles()
+	statuses := make([]WatchStatus, len(handles))
+	for i, h := range handles {
+		statuses[i] = h.Status()
+	}
+	return statuses
+}
+
+// handles returns the running watches in the order they were started.
+func (s *Sonar) handles() []*Handle {
+	s.mu.Lock()
+	handles := make([]*Handle, 0, len(s.watchers))
+	for _, h := range s.watchers {
+		handles = append(handles, h)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(handles, func(i, j int) bool {
+		return handles[i].seq < handles[j].seq
+	})
+	return handles
+}
+
+// attach wires deduplication, the middleware pipeline and error reporting
+// into a watcher. Logs are deduplicated per watch ID; replays, which pass an
+// empty ID, bypass deduplication.
+func (s *Sonar) attach(w watcher.Watcher, chainID, watchID string, handler func(event.Log) error) {
+	pipeline := buildHandler(handler, s.middlewares)
+	if watchID != "" {
+		pipeline = s.dedupHandler(chainID, watchID, pipeline)
+	}
+	w.OnEventE(pipeline)
+	w.OnError(func(err error) {
+		s.reportError(chainID, watchID, err)
+	})
+}
+
+// reportError surfaces a watcher error, classified by its cause. The watch
+// ID is empty for replays.
+func (s *Sonar) reportError(chainID, watchID string, err error) {
+	s.report(newWatchError(chainID, watchID, classify(err), err))
+}
+
+// report logs e and passes it to the error handler, if one is set. Fatal,
+// handler and decode errors are logged at error level, others at warn.
+func (s *Sonar) report(e WatchError) {
+	attrs := []any{"chain", e.Chain}
+	if e.WatchID != "" {
+		attrs = append(attrs, "watch", e.WatchID)
+	}
+	attrs = append(attrs, "kind", e.Kind.String())
+	if e.FromBlock != 0 || e.ToBlock != 0 {
+		attrs = append(attrs, "from_block", e.FromBlock, "to_block", e.ToBlock)
+	}
+	if e.Method != "" {
+		attrs = append(attrs, "method", e.Method)
+	}
+	attrs = append(attrs, "attempt", e.Attempt, "error", e.Err)
+
+	level := slog.LevelWarn
+	switch e.Kind {
+	case KindFatal, KindHandler, KindDecode, KindReorgTooDeep, KindCursorSave:
+		level = slog.LevelError
+	}
+	s.logger.Log(context.Background(), level, "watch error", attrs...)
+
+	if s.errorHandler != nil {
+		s.errorHandler(e)
+	}
+}
+
+// watchOptions merges the chain's default watch options with opts, which
+// take precedence.
+func (s *Sonar) watchOptions(chainID string, opts []WatchOption) WatchOptions {
+	var o WatchOptions
+	for _, opt := range s.chainDefaults[chainID] {
+		opt(&o)
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// pollerConfig returns the polling configuration for a watch on a chain: the
+// global configuration overridden by the watch options, with the chain's
+// retry strategy applied.
+func (s *Sonar) pollerConfig(chainID string, o WatchOptions) watcher.PollerConfig {
+	cfg := s.config.Poller
+	o.apply(&cfg)
+	if strategy := s.retryFor(chainID); strategy != nil {
+		cfg.Retry = strategy
+	}
+	return cfg
+}
+
 // WatchAll begins monitoring all registered chains with the same query and handler.
-func (s *Sonar) WatchAll(query filter.Query, handler func(event.Log)) error {
+// It returns one handle per chain. Options apply to every watch, so WithWatchID
+// must not be used here.
+func (s *Sonar) WatchAll(query filter.Query, handler func(event.Log), opts ...WatchOption) ([]*Handle, error) {
+	var handles []*Handle
 	for _, c := range s.registry.All() {
-		if err := s.Watch(c.ID(), query, handler); err != nil {
-			return err
+		h, err := s.Watch(c.ID(), query, handler, opts...)
+		if err != nil {
+			return handles, err
 		}
+		handles = append(handles, h)
 	}
-	return nil
+	return handles, nil
 }
 
-// Use appends middleware to the processing pipeline.
+// Use appends middleware to the processing pipeline. Middleware that logs
+// through slog and has no logger of its own is given Sonar's.
 // Must be called before Watch.
 func (s *Sonar) Use(mw ...middleware.Middleware) {
+	for _, m := range mw {
+		if l, ok := m.(middleware.Logged); ok && l.Logger() == nil {
+			l.SetLogger(s.logger)
+		}
+	}
 	s.middlewares = append(s.middlewares, mw...)
 }
 
-// Shutdown gracefully stops all watchers.
+// Shutdown gracefully stops all watchers and waits for the coverage they
+// recorded to be stored.
 func (s *Sonar) Shutdown(ctx context.Context) error {
 	s.mu.Lock()
 	s.shutdown = true
-	watchers := make(map[string]watcher.Watcher, len(s.watchers))
-	for k, v := range s.watchers {
-		watchers[k] = v
+	watchers := make([]*Handle, 0, len(s.watchers))
+	for _, h := range s.watchers {
+		watchers = append(watchers, h)
 	}
 	s.mu.Unlock()
 
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
-		for _, w := range watchers {
-			w.Stop()
+		for _, h := range watchers {
+			h.w.Stop()
+			<-h.done
 		}
+		s.waitCoverage()
 	}()
 
 	select {
@@ -190,6 +665,15 @@ func (s *Sonar) RegisterEventJSON(jsonABI []byte) error {
 	return dec.RegisterJSON(jsonABI)
 }
 
+// retryFor returns the retry strategy for a chain: its override if one was
+// configured with WithChainRetry, otherwise the global strategy.
+func (s *Sonar) retryFor(chainID string) retry.Strategy {
+	if strategy, ok := s.chainRetry[chainID]; ok {
+		return strategy
+	}
+	return s.retry
+}
+
 func (s *Sonar) ensureDecoder() {
 	if s.decoder == nil {
 		s.decoder = decoder.NewABIDecoder()
@@ -197,28 +681,147 @@ func (s *Sonar) ensureDecoder() {
 }
 
 // WatchDecoded begins monitoring the specified chain and delivers decoded events.
-// Events that cannot be decoded are silently skipped.
+// Events matching no registered event are skipped; events that fail to
+// decode are skipped and reported as KindDecode errors.
 // The decoder must have event signatures registered via RegisterEvent.
-func (s *Sonar) WatchDecoded(chainID string, query filter.Query, handler func(*decoder.DecodedEvent)) error {
+func (s *Sonar) WatchDecoded(chainID string, query filter.Query, handler func(*decoder.DecodedEvent), opts ...WatchOption) (*Handle, error) {
+	return s.WatchDecodedE(chainID, query, ackedDecoded(handler), opts...)
+}
+
+// WatchDecodedE is like WatchDecoded, but the handler acknowledges each event
+// as with WatchE.
+func (s *Sonar) WatchDecodedE(chainID string, query filter.Query, handler func(*decoder.DecodedEvent) error, opts ...WatchOption) (*Handle, error) {
+	h, err := s.decodedHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	return s.WatchE(chainID, query, h, opts...)
+}
+
+// StreamDecoded is like Stream but delivers decoded events.
+// Events matching no registered event are skipped; events that fail to
+// decode are skipped and reported as KindDecode errors.
+func (s *Sonar) StreamDecoded(chainID string, query filter.Query, handler func(*decoder.DecodedEvent), opts ...WatchOption) (*Handle, error) {
+	h, err := s.decodedHandler(ackedDecoded(handler))
+	if err != nil {
+		return nil, err
+	}
+	return s.watch(chainID, query, ModeStream, h, nil, opts)
+}
+
+// ReplayDecoded is like Replay but delivers decoded events.
+// Events matching no registered event are skipped; events that fail to
+// decode are skipped and reported as KindDecode errors.
+func (s *Sonar) ReplayDecoded(ctx context.Context, chainID string, query filter.Query, handler func(*decoder.DecodedEvent), opts ...WatchOption) error {
+	return s.ReplayDecodedE(ctx, chainID, query, ackedDecoded(handler), opts...)
+}
+
+// ReplayDecodedE is like ReplayDecoded, but the handler acknowledges each
+// event as with ReplayE.
+func (s *Sonar) ReplayDecodedE(ctx context.Context, chainID string, query filter.Query, handler func(*decoder.DecodedEvent) error, opts ...WatchOption) error {
+	h, err := s.decodedHandler(handler)
+	if err != nil {
+		return err
+	}
+	return s.ReplayE(ctx, chainID, query, h, opts...)
+}
+
+// decodedHandler adapts a decoded-event handler to a raw log handler.
+func (s *Sonar) decodedHandler(handler func(*decoder.DecodedEvent) error) (func(event.Log) error, error) {
 	if s.decoder == nil {
-		return fmt.Errorf("sonar: no decoder configured; call RegisterEvent first")
+		return nil, fmt.Errorf("sonar: no decoder configured; call RegisterEvent first")
 	}
 
 	dec := s.decoder
-	return s.Watch(chainID, query, func(log event.Log) {
+	return func(log event.Log) error {
 		decoded, err := dec.Decode(log)
+		if errors.Is(err, decoder.ErrUnknownEvent) {
+			return nil // skip unrecognized events
+		}
 		if err != nil {
-			return // skip unrecognized events
+			return &decodeError{err: fmt.Errorf("sonar: decode log %d in block %d: %w", log.LogIndex, log.BlockNumber, err)}
 		}
-		handler(decoded)
-	})
+		return handler(decoded)
+	}, nil
+}
+
+// decodeError is returned by a decoded-event handler for a log of a known
+// event that could not be decoded.
+type decodeError struct {
+	err error
 }
 
-// buildHandler constructs the middleware pipeline with the user handler at the end.
-func buildHandler(handler func(event.Log), mws []middleware.Middleware) middleware.Handler {
-	terminal := func(log event.Log) *event.Log {
+func (e *decodeError) Error() string { return e.err.Error() }
+
+// skipDecodeErrors reports the logs handler could not decode as KindDecode
+// errors and acknowledges them, so that they are skipped rather than retried.
+func (s *Sonar) skipDecodeErrors(chainID, watchID string, handler func(event.Log) error) func(event.Log) error {
+	return func(log event.Log) error {
+		err := handler(log)
+		var de *decodeError
+		if !errors.As(err, &de) {
+			return err
+		}
+		e := newWatchError(chainID, watchID, KindDecode, de.err)
+		e.FromBlock, e.ToBlock = log.BlockNumber, log.BlockNumber
+		s.report(e)
+		return nil
+	}
+}
+
+// acked adapts a handler without an error result to one that always succeeds.
+func acked(handler func(event.Log)) func(event.Log) error {
+	return func(log event.Log) error {
 		handler(log)
-		return &log
+		return nil
+	}
+}
+
+// ackedDecoded is acked for decoded-event handlers.
+func ackedDecoded(handler func(*decoder.DecodedEvent)) func(*decoder.DecodedEvent) error {
+	return func(ev *decoder.DecodedEvent) error {
+		handler(ev)
+		return nil
+	}
+}
+
+// buildHandler constructs the middleware pipeline with the user handler at the
+// end. The pipeline is built per log so that the handler's error can be
+// returned past middleware, whose handlers have no error result. A log dropped
+// by middleware counts as handled.
+func buildHandler(handler func(event.Log) error, mws []middleware.Middleware) func(event.Log) error {
+	return func(log event.Log) error {
+		var err error
+		terminal := func(log event.Log) *event.Log {
+			err = handler(log)
+			return &log
+		}
+		middleware.Chain(terminal, mws...)(log)
+		return err
+	}
+}
+
+// buildBatchHandler runs every log of a batch through the middleware chain and
+// passes the logs that come out of it to handler. A batch emptied by
+// middleware is only delivered if emptyBatches is set.
+func buildBatchHandler(handler func(event.Batch) error, mws []middleware.Middleware, emptyBatches bool) func(event.Batch) error {
+	return func(batch event.Batch) error {
+		if len(mws) == 0 {
+			return handler(batch)
+		}
+		logs := make([]event.Log, 0, len(batch.Logs))
+		terminal := func(log event.Log) *event.Log {
+			logs = append(logs, log)
+			return &log
+		}
+		run := middleware.Chain(terminal, mws...)
+		for _, log := range batch.Logs {
+			run(log)
+		}
+		if len(logs) == 0 && !batch.IsEmpty() && !emptyBatches {
+			return nil
+		}
+		batch.Logs = logs
+		return handler(batch)
 	}
-	return middleware.Chain(terminal, mws...)
 }
@@ -0,0 +1,262 @@
+package sonar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/middleware"
+)
+
+// newTestSonar creates a Sonar that discards its logs.
+func newTestSonar(opts ...Option) *Sonar {
+	return New(append([]Option{WithLogger(slog.New(slog.DiscardHandler))}, opts...)...)
+}
+
+// logChain is a chain at block head with the given logs. It filters logs
+// by address only; topics are ignored.
+type logChain struct {
+	mu   sync.Mutex
+	head uint64
+	logs []event.Log
+}
+
+func (c *logChain) ID() string { return "test" }
+
+func (c *logChain) LatestBlock(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.head, nil
+}
+
+func (c *logChain) FetchLogs(ctx context.Context, q filter.Query) ([]event.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var logs []event.Log
+	for _, log := range c.logs {
+		if log.BlockNumber < *q.FromBlock || log.BlockNumber > *q.ToBlock {
+			continue
+		}
+		if len(q.Addresses) > 0 && !slices.Contains(q.Addresses, log.Address) {
+			continue
+		}
+		logs = append(logs, log)
+	}
+	return logs, nil
+}
+
+func (c *logChain) Subscribe(ctx context.Context, q filter.Query) (chain.Subscription, error) {
+	return nil, errors.New("test: not supported")
+}
+
+// logAt returns a log of addr in block n, unique by block and index.
+func logAt(addr event.Address, n uint64, index uint) event.Log {
+	return event.Log{Chain: "test", Address: addr, BlockNumber: n, LogIndex: index}
+}
+
+// address returns an address ending in b.
+func address(b byte) event.Address {
+	var a event.Address
+	a[19] = b
+	return a
+}
+
+// collector records the blocks of delivered logs.
+type collector struct {
+	mu     sync.Mutex
+	blocks []uint64
+	more   chan struct{}
+}
+
+func newCollector() *collector {
+	return &collector{more: make(chan struct{}, 1)}
+}
+
+func (c *collector) handle(log event.Log) error {
+	c.mu.Lock()
+	c.blocks = append(c.blocks, log.BlockNumber)
+	c.mu.Unlock()
+	select {
+	case c.more <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// wait returns the delivered blocks once there are n, failing the test if
+// they do not arrive in time.
+func (c *collector) wait(t *testing.T, n int) []uint64 {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		c.mu.Lock()
+		got := slices.Clone(c.blocks)
+		c.mu.Unlock()
+		if len(got) >= n {
+			return got
+		}
+		select {
+		case <-c.more:
+		case <-timeout:
+			t.Fatalf("delivered blocks %v, want %d logs", got, n)
+		}
+	}
+}
+
+// syncBuffer is a buffer safe for concurrent use, e.g. as a log output.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// eventually fails the test if cond does not hold within a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatchLegacyCursor(t *testing.T) {
+	tests := []struct {
+		name        string
+		migrate     bool
+		wantResumed []bool // per watch, in start order
+		wantWarning bool
+	}{
+		{name: "without migration", wantResumed: []bool{false, false}, wantWarning: true},
+		{name: "with migration", migrate: true, wantResumed: []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := cursor.NewMemory()
+			cur.Save("test", 10)
+			var logs syncBuffer
+			opts := []Option{WithCursor(cur), WithLogger(slog.New(slog.NewTextHandler(&logs, nil)))}
+			if tt.migrate {
+				opts = append(opts, WithCursorMigration())
+			}
+			s := New(opts...)
+			defer s.Shutdown(context.Background())
+			// The head is below the legacy progress, so that a watch
+			// resuming from it does not move on.
+			if err := s.AddChain(&logChain{head: 5}); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, want := range tt.wantResumed {
+				q := filter.Query{Addresses: []event.Address{address(byte(i + 1))}}
+				h, err := s.Watch("test", q, func(event.Log) {})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := cur.Load(h.key); (got == 10) != want {
+					t.Errorf("watch %d: progress %d, resumed from the chain-keyed entry = %v, want %v", i, got, got == 10, want)
+				}
+			}
+			want := 0
+			if tt.wantWarning {
+				want = 1
+			}
+			if got := strings.Count(logs.String(), "WithCursorMigration"); got != want {
+				t.Errorf("logged %d warnings about the chain-keyed progress, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUseGivesSlogLoggerSonarsLogger(t *testing.T) {
+	tests := []struct {
+		level   string
+		wantLog bool
+	}{
+		{level: "info", wantLog: true},
+		{level: "warn", wantLog: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			var logs syncBuffer
+			s := New(WithLogger(slog.New(slog.NewTextHandler(&logs, nil))), WithLogLevel(tt.level))
+			mw := middleware.NewSlogLogger(nil)
+			s.Use(mw)
+
+			h := middleware.Chain(func(log event.Log) *event.Log { return &log }, mw)
+			h(event.Log{BlockNumber: 7})
+			if got := strings.Contains(logs.String(), "event log"); got != tt.wantLog {
+				t.Errorf("logged the event through Sonar's logger = %v, want %v; output %q", got, tt.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	c := &logChain{head: 10, logs: []event.Log{logAt(address(1), 3, 0)}}
+	s := newTestSonar(WithPollInterval(time.Millisecond))
+	defer s.Shutdown(context.Background())
+	if err := s.AddChain(c); err != nil {
+		t.Fatal(err)
+	}
+
+	got := newCollector()
+	q := filter.Query{Addresses: []event.Address{address(1)}}
+	h, err := s.WatchE("test", q, got.handle, WithStartBlock(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.wait(t, 1)
+
+	if err := h.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	c.head = 15
+	c.logs = append(c.logs, logAt(address(1), 12, 0))
+	c.mu.Unlock()
+
+	// While paused, nothing is delivered but the head is still followed.
+	eventually(t, "the paused watch to see the new head", func() bool {
+		return h.Status().SafeHead == 15
+	})
+	if blocks := got.wait(t, 1); len(blocks) != 1 {
+		t.Fatalf("delivered blocks %v while paused, want only [3]", blocks)
+	}
+	if got := h.Status().State; got != StatePaused {
+		t.Errorf("state %v while paused, want %v", got, StatePaused)
+	}
+
+	if err := h.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := got.wait(t, 2); !slices.Equal(blocks, []uint64{3, 12}) {
+		t.Errorf("delivered blocks %v after Resume, want [3 12]", blocks)
+	}
+	if err := s.Pause("missing"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Pause of an unknown watch = %v, want ErrNotRunning", err)
+	}
+}
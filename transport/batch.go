@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchRequest is one call of a batch.
+type BatchRequest struct {
+	Method string
+	Params []interface{}
+}
+
+// BatchResponse is the outcome of one call of a batch. Err holds a per-call
+// failure, such as a JSON-RPC error response.
+type BatchResponse struct {
+	Result []byte
+	Err    error
+}
+
+// Batcher is implemented by transports that can send several calls in one
+// round trip.
+type Batcher interface {
+	// BatchCall sends the requests together and returns their responses in
+	// request order. The error is non-nil only if the batch as a whole failed.
+	BatchCall(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error)
+}
+
+// maxConcurrentCalls bounds the calls Batch issues at once when the
+// transport cannot batch.
+const maxConcurrentCalls = 8
+
+// Batch sends reqs as a single batch if t implements Batcher, and as
+// concurrent individual calls otherwise.
+func Batch(ctx context.Context, t Transport, reqs []BatchRequest) ([]BatchResponse, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	if b, ok := t.(Batcher); ok {
+		return b.BatchCall(ctx, reqs)
+	}
+
+	resps := make([]BatchResponse, len(reqs))
+	sem := make(chan struct{}, maxConcurrentCalls)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resps[i].Result, resps[i].Err = t.Call(ctx, req.Method, req.Params...)
+		}()
+	}
+	wg.Wait()
+	return resps, ctx.Err()
+}
@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// Breaker wraps a Transport so that every request passes through a circuit
+// breaker. While the circuit is open, requests fail immediately with an error
+// wrapping retry.ErrCircuitOpen instead of reaching the endpoint.
+//
+// Only transport-level failures (connection errors, non-200 responses, closed
+// sockets) count against the breaker. JSON-RPC error responses prove that the
+// endpoint is alive and count as successes.
+type Breaker struct {
+	next Transport
+	cb   *retry.CircuitBreaker
+}
+
+// NewBreaker wraps t with the given circuit breaker.
+func NewBreaker(t Transport, cb *retry.CircuitBreaker) *Breaker {
+	return &Breaker{next: t, cb: cb}
+}
+
+// CircuitBreaker returns the underlying circuit breaker.
+func (b *Breaker) CircuitBreaker() *retry.CircuitBreaker {
+	return b.cb
+}
+
+// Call forwards the request if the circuit allows it.
+func (b *Breaker) Call(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
+	if !b.cb.Allow() {
+		return nil, callError(method, fmt.Errorf("transport: %s: %w", method, retry.ErrCircuitOpen))
+	}
+	result, err := b.next.Call(ctx, method, params...)
+	b.record(ctx, err)
+	return result, err
+}
+
+// BatchCall forwards the batch if the circuit allows it, batching it only if
+// the wrapped transport can.
+func (b *Breaker) BatchCall(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error) {
+	if !b.cb.Allow() {
+		return nil, callError("batch", fmt.Errorf("transport: batch: %w", retry.ErrCircuitOpen))
+	}
+	resps, err := Batch(ctx, b.next, reqs)
+	outcome := err
+	if err == nil && len(resps) > 0 {
+		// Judge the endpoint by the first call when the batch was split up.
+		outcome = resps[0].Err
+	}
+	b.record(ctx, outcome)
+	return resps, err
+}
+
+// Subscribe forwards the subscription request if the circuit allows it.
+func (b *Breaker) Subscribe(ctx context.Context, method string, params ...interface{}) (<-chan []byte, func(), error) {
+	if !b.cb.Allow() {
+		return nil, nil, callError(method, fmt.Errorf("transport: %s: %w", method, retry.ErrCircuitOpen))
+	}
+	ch, unsub, err := b.next.Subscribe(ctx, method, params...)
+	b.record(ctx, err)
+	return ch, unsub, err
+}
+
+// Close closes the wrapped transport.
+func (b *Breaker) Close() error {
+	return b.next.Close()
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	var rpcErr *jsonRPCError
+	switch {
+	case err == nil, errors.As(err, &rpcErr):
+		b.cb.RecordSuccess()
+	case ctx.Err() != nil:
+		// cancelled by the caller; says nothing about the endpoint
+	default:
+		b.cb.RecordFailure()
+	}
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrRateLimited is matched by errors for requests the endpoint rejected for
+// exceeding its rate limit: HTTP 429 responses and JSON-RPC rate-limit errors.
+var ErrRateLimited = errors.New("transport: rate limited")
+
+// CallError is returned by the transports in this package when a request
+// fails, and names its JSON-RPC method. Its message is that of the
+// underlying error.
+type CallError struct {
+	// Method is the JSON-RPC method, or "batch" for a batch request.
+	Method string
+	Err    error
+}
+
+func (e *CallError) Error() string { return e.Err.Error() }
+
+func (e *CallError) Unwrap() error { return e.Err }
+
+// callError wraps a non-nil err in a CallError for method.
+func callError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CallError{Method: method, Err: err}
+}
+
+// IsConnectionError reports whether err is a transport-level failure: the
+// endpoint could not be reached, did not answer with a JSON-RPC response or
+// was cut off by an open circuit breaker. JSON-RPC error responses and
+// requests cancelled by the caller are not connection errors.
+func IsConnectionError(err error) bool {
+	var ce *CallError
+	var rpcErr *jsonRPCError
+	return errors.As(err, &ce) && !errors.As(err, &rpcErr) && !errors.Is(err, context.Canceled)
+}
+
+// ErrorCode returns the code of the JSON-RPC error response err wraps, and
+// false if err does not wrap one.
+func ErrorCode(err error) (int, bool) {
+	var rpcErr *jsonRPCError
+	if !errors.As(err, &rpcErr) {
+		return 0, false
+	}
+	return rpcErr.Code, true
+}
+
+// statusError is a non-200 HTTP response.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("transport/http: HTTP %d: %s", e.code, e.body)
+}
+
+func (e *statusError) Is(target error) bool {
+	return target == ErrRateLimited && e.code == http.StatusTooManyRequests
+}
+
+// rateLimitMessages are fragments of JSON-RPC errors that providers return
+// when a client exceeds its rate limit.
+var rateLimitMessages = []string{
+	"rate limit",                 // generic
+	"too many requests",          // generic
+	"request limit",              // Infura, QuickNode
+	"exceeded its compute units", // Alchemy
+}
+
+// isRateLimited reports whether e is a provider's rate-limit rejection.
+func (e *jsonRPCError) isRateLimited() bool {
+	if e.Code == http.StatusTooManyRequests {
+		return true
+	}
+	msg := strings.ToLower(e.Message)
+	for _, fragment := range rateLimitMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *jsonRPCError) Is(target error) bool {
+	return target == ErrRateLimited && e.isRateLimited()
+}
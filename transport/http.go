@@ -48,8 +48,14 @@ func (e *jsonRPCError) Error() string {
 	return fmt.Sprintf("rpc error: code=%d message=%s", e.Code, e.Message)
 }
 
-// Call sends an HTTP JSON-RPC request and returns the result bytes.
+// Call sends an HTTP JSON-RPC request and returns the result bytes. Errors
+// are *CallError values.
 func (h *HTTP) Call(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
+	result, err := h.call(ctx, method, params...)
+	return result, callError(method, err)
+}
+
+func (h *HTTP) call(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
 	if params == nil {
 		params = []interface{}{}
 	}
@@ -61,7 +67,93 @@ func (h *HTTP) Call(ctx context.Context, method string, params ...interface{}) (
 		Params:  params,
 	}
 
-	body, err := json.Marshal(req)
+	respBody, err := h.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var rpcResp jsonRPCResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return nil, fmt.Errorf("transport/http: unmarshal response: %w", err)
+	}
+
+	if rpcResp.Error != nil {
+		return nil, rpcResp.Error
+	}
+
+	return rpcResp.Result, nil
+}
+
+// BatchCall sends the requests as one JSON-RPC batch. An error for the batch
+// as a whole is a *CallError with method "batch".
+func (h *HTTP) BatchCall(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error) {
+	resps, err := h.batchCall(ctx, reqs)
+	return resps, callError("batch", err)
+}
+
+func (h *HTTP) batchCall(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error) {
+	batch := make([]jsonRPCRequest, len(reqs))
+	index := make(map[uint64]int, len(reqs))
+	for i, r := range reqs {
+		params := r.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		id := h.nextID.Add(1)
+		batch[i] = jsonRPCRequest{
+			JSONRPC: "2.0",
+			ID:      id,
+			Method:  r.Method,
+			Params:  params,
+		}
+		index[id] = i
+	}
+
+	respBody, err := h.post(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	var rpcResps []jsonRPCResponse
+	if err := json.Unmarshal(respBody, &rpcResps); err != nil {
+		// Endpoints without batch support answer with a single error object.
+		var single jsonRPCResponse
+		if json.Unmarshal(respBody, &single) == nil && single.Error != nil {
+			return nil, single.Error
+		}
+		return nil, fmt.Errorf("transport/http: unmarshal batch response: %w", err)
+	}
+
+	resps := make([]BatchResponse, len(reqs))
+	seen := make([]bool, len(reqs))
+	for _, r := range rpcResps {
+		i, ok := index[r.ID]
+		if !ok {
+			continue
+		}
+		seen[i] = true
+		if r.Error != nil {
+			resps[i].Err = r.Error
+		} else {
+			resps[i].Result = r.Result
+		}
+	}
+	for i := range resps {
+		if !seen[i] {
+			resps[i].Err = fmt.Errorf("transport/http: no response to %s in batch", reqs[i].Method)
+		}
+	}
+	return resps, nil
+}
+
+// Subscribe is not supported over HTTP and always returns an error.
+func (h *HTTP) Subscribe(_ context.Context, _ string, _ ...interface{}) (<-chan []byte, func(), error) {
+	return nil, nil, fmt.Errorf("transport/http: subscriptions not supported over HTTP")
+}
+
+// post sends a JSON-RPC payload and returns the body of a 200 response.
+func (h *HTTP) post(ctx context.Context, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("transport/http: marshal request: %w", err)
 	}
@@ -88,24 +180,9 @@ func (h *HTTP) Call(ctx context.Context, method string, params ...interface{}) (
 		if len(body) > 256 {
 			body = body[:256]
 		}
-		return nil, fmt.Errorf("transport/http: HTTP %d: %s", resp.StatusCode, body)
+		return nil, &statusError{code: resp.StatusCode, body: body}
 	}
-
-	var rpcResp jsonRPCResponse
-	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
-		return nil, fmt.Errorf("transport/http: unmarshal response (status %d): %w", resp.StatusCode, err)
-	}
-
-	if rpcResp.Error != nil {
-		return nil, rpcResp.Error
-	}
-
-	return rpcResp.Result, nil
-}
-
-// Subscribe is not supported over HTTP and always returns an error.
-func (h *HTTP) Subscribe(_ context.Context, _ string, _ ...interface{}) (<-chan []byte, func(), error) {
-	return nil, nil, fmt.Errorf("transport/http: subscriptions not supported over HTTP")
+	return respBody, nil
 }
 
 // Close is a no-op for HTTP transport.
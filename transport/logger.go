@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Logger wraps a Transport so that every request is logged: successful calls
+// at debug level and failed ones at warn, with the method and duration.
+// Calls cancelled by the caller are logged at debug level.
+type Logger struct {
+	next Transport
+	log  atomic.Pointer[slog.Logger]
+}
+
+// NewLogger wraps t, logging its requests to l.
+func NewLogger(t Transport, l *slog.Logger) *Logger {
+	lt := &Logger{next: t}
+	lt.SetLogger(l)
+	return lt
+}
+
+// SetLogger replaces the logger requests are logged to; nil discards them.
+// It is safe to call while requests are in flight.
+func (l *Logger) SetLogger(log *slog.Logger) {
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	l.log.Store(log)
+}
+
+// Call forwards the request and logs its outcome.
+func (l *Logger) Call(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
+	start := time.Now()
+	result, err := l.next.Call(ctx, method, params...)
+	l.record(ctx, "rpc call", err, "method", method, "duration", time.Since(start))
+	return result, err
+}
+
+// BatchCall forwards the batch, batching it only if the wrapped transport
+// can, and logs its outcome. Per-call failures are not logged.
+func (l *Logger) BatchCall(ctx context.Context, reqs []BatchRequest) ([]BatchResponse, error) {
+	start := time.Now()
+	resps, err := Batch(ctx, l.next, reqs)
+	l.record(ctx, "rpc batch", err, "calls", len(reqs), "duration", time.Since(start))
+	return resps, err
+}
+
+// Subscribe forwards the subscription request and logs its outcome.
+func (l *Logger) Subscribe(ctx context.Context, method string, params ...interface{}) (<-chan []byte, func(), error) {
+	start := time.Now()
+	ch, unsub, err := l.next.Subscribe(ctx, method, params...)
+	l.record(ctx, "rpc subscribe", err, "method", method, "duration", time.Since(start))
+	return ch, unsub, err
+}
+
+// Close closes the wrapped transport.
+func (l *Logger) Close() error {
+	return l.next.Close()
+}
+
+func (l *Logger) record(ctx context.Context, msg string, err error, attrs ...any) {
+	log := l.log.Load()
+	switch {
+	case err == nil:
+		log.DebugContext(ctx, msg, attrs...)
+	case ctx.Err() != nil:
+		log.DebugContext(ctx, msg+" cancelled", attrs...)
+	default:
+		log.WarnContext(ctx, msg+" failed", append(attrs, "error", err)...)
+	}
+}
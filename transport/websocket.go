@@ -4,61 +4,106 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 // WebSocket implements Transport over a WebSocket connection.
+//
+// The connection is established lazily on the first Call or Subscribe and is
+// re-established on the next call after it drops. Subscriptions do not survive
+// a dropped connection: their channels are closed so that consumers notice the
+// disconnect and can subscribe again. A subscription whose consumer falls so
+// far behind that its buffer fills up is ended the same way, rather than
+// losing notifications silently.
 type WebSocket struct {
 	url    string
-	conn   *websocket.Conn
-	mu     sync.Mutex
 	nextID atomic.Uint64
 
-	// connection management
-	connOnce sync.Once
-	connErr  error
+	// mu guards the current connection and the routing tables bound to it.
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	done    chan struct{} // closed when conn drops
+	pending map[uint64]chan []byte
+	subs    map[string]*wsSubscription
 
-	// subscription management
-	subMu   sync.Mutex
-	subs    map[uint64]chan []byte
-	closed  chan struct{}
+	writeMu sync.Mutex
+
+	closed    chan struct{}
 	closeOnce sync.Once
 }
 
+// wsSubscriptionBuffer is the number of notifications buffered per
+// subscription before it is ended as overflowed.
+const wsSubscriptionBuffer = 256
+
+// wsSubscription is the delivery channel of one server-side subscription.
+type wsSubscription struct {
+	ch   chan []byte
+	once sync.Once
+
+	// cancel tells the server to stop sending notifications, without
+	// blocking.
+	cancel func()
+}
+
+func (s *wsSubscription) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
 // NewWebSocket creates a WebSocket transport.
 // The connection is established lazily on the first Call or Subscribe.
 func NewWebSocket(url string) *WebSocket {
 	return &WebSocket{
-		url:    url,
-		subs:   make(map[uint64]chan []byte),
-		closed: make(chan struct{}),
+		url:     url,
+		pending: make(map[uint64]chan []byte),
+		subs:    make(map[string]*wsSubscription),
+		closed:  make(chan struct{}),
 	}
 }
 
-// connect establishes the WebSocket connection (called lazily, at most once).
-func (ws *WebSocket) connect(ctx context.Context) error {
-	ws.connOnce.Do(func() {
-		dialer := websocket.Dialer{}
-		conn, _, err := dialer.DialContext(ctx, ws.url, nil)
-		if err != nil {
-			ws.connErr = fmt.Errorf("transport/ws: dial: %w", err)
-			return
-		}
-		ws.conn = conn
-		go ws.readLoop()
-	})
-	return ws.connErr
+// connect returns the current connection, dialing a new one if there is none.
+func (ws *WebSocket) connect(ctx context.Context) (*websocket.Conn, chan struct{}, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	select {
+	case <-ws.closed:
+		return nil, nil, fmt.Errorf("transport/ws: connection closed")
+	default:
+	}
+
+	if ws.conn != nil {
+		return ws.conn, ws.done, nil
+	}
+
+	dialer := websocket.Dialer{}
+	conn, _, err := dialer.DialContext(ctx, ws.url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transport/ws: dial: %w", err)
+	}
+	ws.conn = conn
+	ws.done = make(chan struct{})
+	go ws.readLoop(conn)
+	return conn, ws.done, nil
 }
 
 // Call sends a JSON-RPC request over WebSocket and waits for the response.
+// Errors are *CallError values.
 func (ws *WebSocket) Call(ctx context.Context, method string, params ...interface{}) ([]byte, error) {
-	if err := ws.connect(ctx); err != nil {
-		return nil, err
+	conn, done, err := ws.connect(ctx)
+	if err != nil {
+		return nil, callError(method, err)
 	}
+	result, err := ws.call(ctx, conn, done, method, params...)
+	return result, callError(method, err)
+}
 
+func (ws *WebSocket) call(ctx context.Context, conn *websocket.Conn, done chan struct{}, method string, params ...interface{}) ([]byte, error) {
 	if params == nil {
 		params = []interface{}{}
 	}
@@ -73,20 +118,21 @@ func (ws *WebSocket) Call(ctx context.Context, method string, params ...interfac
 
 	// Create a response channel for this request
 	ch := make(chan []byte, 1)
-	ws.subMu.Lock()
-	ws.subs[id] = ch
-	ws.subMu.Unlock()
+	ws.mu.Lock()
+	ws.pending[id] = ch
+	ws.mu.Unlock()
 
 	defer func() {
-		ws.subMu.Lock()
-		delete(ws.subs, id)
-		ws.subMu.Unlock()
+		ws.mu.Lock()
+		delete(ws.pending, id)
+		ws.mu.Unlock()
 	}()
 
-	ws.mu.Lock()
-	err := ws.conn.WriteJSON(req)
-	ws.mu.Unlock()
+	ws.writeMu.Lock()
+	err := conn.WriteJSON(req)
+	ws.writeMu.Unlock()
 	if err != nil {
+		ws.drop(conn)
 		return nil, fmt.Errorf("transport/ws: write: %w", err)
 	}
 
@@ -102,18 +148,28 @@ func (ws *WebSocket) Call(ctx context.Context, method string, params ...interfac
 			return nil, rpcResp.Error
 		}
 		return rpcResp.Result, nil
+	case <-done:
+		return nil, fmt.Errorf("transport/ws: connection lost")
 	case <-ws.closed:
 		return nil, fmt.Errorf("transport/ws: connection closed")
 	}
 }
 
-// Subscribe sends a subscription request and returns a channel for incoming messages.
+// Subscribe sends a subscription request and returns a channel for incoming
+// notifications. The channel is closed on unsubscribe or when the connection
+// drops. Errors are *CallError values.
 func (ws *WebSocket) Subscribe(ctx context.Context, method string, params ...interface{}) (<-chan []byte, func(), error) {
-	if err := ws.connect(ctx); err != nil {
+	ch, unsub, err := ws.subscribe(ctx, method, params...)
+	return ch, unsub, callError(method, err)
+}
+
+func (ws *WebSocket) subscribe(ctx context.Context, method string, params ...interface{}) (<-chan []byte, func(), error) {
+	conn, done, err := ws.connect(ctx)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	result, err := ws.Call(ctx, method, params...)
+	result, err := ws.call(ctx, conn, done, method, params...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -124,22 +180,39 @@ func (ws *WebSocket) Subscribe(ctx context.Context, method string, params ...int
 		return nil, nil, fmt.Errorf("transport/ws: parse subscription id: %w", err)
 	}
 
-	ch := make(chan []byte, 64)
+	sub := &wsSubscription{ch: make(chan []byte, wsSubscriptionBuffer)}
+	sub.cancel = func() {
+		// Best effort: tell the server to stop sending notifications.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, _ = ws.call(ctx, conn, done, unsubscribeMethod(method), subID)
+		}()
+	}
 
-	// Use a synthetic ID based on subscription string for routing
-	syntheticID := ws.nextID.Add(1)
-	ws.subMu.Lock()
-	ws.subs[syntheticID] = ch
-	ws.subMu.Unlock()
+	ws.mu.Lock()
+	select {
+	case <-done:
+		ws.mu.Unlock()
+		return nil, nil, fmt.Errorf("transport/ws: connection lost")
+	default:
+	}
+	ws.subs[subID] = sub
+	ws.mu.Unlock()
 
 	unsub := func() {
-		ws.subMu.Lock()
-		delete(ws.subs, syntheticID)
-		ws.subMu.Unlock()
-		close(ch)
+		ws.mu.Lock()
+		_, active := ws.subs[subID]
+		delete(ws.subs, subID)
+		ws.mu.Unlock()
+		sub.close()
+
+		if active {
+			sub.cancel()
+		}
 	}
 
-	return ch, unsub, nil
+	return sub.ch, unsub, nil
 }
 
 // Close terminates the WebSocket connection.
@@ -147,26 +220,42 @@ func (ws *WebSocket) Close() error {
 	ws.closeOnce.Do(func() {
 		close(ws.closed)
 	})
-	if ws.conn != nil {
-		return ws.conn.Close()
+
+	ws.mu.Lock()
+	conn := ws.conn
+	ws.mu.Unlock()
+	if conn != nil {
+		ws.drop(conn)
 	}
 	return nil
 }
 
+// drop tears down conn if it is still the current connection: pending calls
+// fail and subscription channels are closed.
+func (ws *WebSocket) drop(conn *websocket.Conn) {
+	ws.mu.Lock()
+	if ws.conn != conn {
+		ws.mu.Unlock()
+		return
+	}
+	ws.conn = nil
+	close(ws.done)
+	subs := ws.subs
+	ws.subs = make(map[string]*wsSubscription)
+	ws.mu.Unlock()
+
+	conn.Close()
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
 // readLoop reads messages from the WebSocket and routes them to waiting callers.
-func (ws *WebSocket) readLoop() {
+func (ws *WebSocket) readLoop(conn *websocket.Conn) {
 	for {
-		select {
-		case <-ws.closed:
-			return
-		default:
-		}
-
-		_, message, err := ws.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			ws.closeOnce.Do(func() {
-				close(ws.closed)
-			})
+			ws.drop(conn)
 			return
 		}
 
@@ -182,26 +271,48 @@ func (ws *WebSocket) readLoop() {
 
 		// Route response to the correct caller
 		if envelope.ID != 0 {
-			ws.subMu.Lock()
-			if ch, ok := ws.subs[envelope.ID]; ok {
+			ws.mu.Lock()
+			if ch, ok := ws.pending[envelope.ID]; ok {
 				select {
 				case ch <- message:
 				default:
 				}
 			}
-			ws.subMu.Unlock()
+			ws.mu.Unlock()
+			continue
 		}
 
-		// Handle subscription notifications (eth_subscription)
-		if envelope.Method == "eth_subscription" {
-			ws.subMu.Lock()
-			for _, ch := range ws.subs {
+		// Route subscription notifications (eth_subscription) by subscription ID.
+		// Sends never block: a stalled consumer must not hold up responses.
+		// A subscription whose buffer is full is ended instead, so that its
+		// consumer notices the lost notification and can catch up.
+		if strings.HasSuffix(envelope.Method, "_subscription") {
+			var params struct {
+				Subscription string `json:"subscription"`
+			}
+			if err := json.Unmarshal(envelope.Params, &params); err != nil {
+				continue
+			}
+			ws.mu.Lock()
+			if sub, ok := ws.subs[params.Subscription]; ok {
 				select {
-				case ch <- []byte(envelope.Params):
+				case sub.ch <- []byte(envelope.Params):
 				default:
+					delete(ws.subs, params.Subscription)
+					sub.close()
+					sub.cancel()
 				}
 			}
-			ws.subMu.Unlock()
+			ws.mu.Unlock()
 		}
 	}
 }
+
+// unsubscribeMethod derives the unsubscribe method from a subscribe method,
+// e.g. "eth_subscribe" -> "eth_unsubscribe".
+func unsubscribeMethod(method string) string {
+	if prefix, ok := strings.CutSuffix(method, "_subscribe"); ok {
+		return prefix + "_unsubscribe"
+	}
+	return "eth_unsubscribe"
+}
@@ -0,0 +1,211 @@
+package sonar
+
+import (
+	"fmt"
+
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+// UpdateQuery replaces the addresses and topics of the running watch with
+// the given ID; block bounds in q are ignored. It returns once the range or
+// log being delivered, if any, has been handled, with the boundary block:
+// blocks before it were scanned with the old query, blocks from it on are
+// scanned with the new one. Streaming watches resubscribe and return zero,
+// as they do not track a boundary; logs emitted meanwhile may be missed.
+//
+// A default cursor key, derived from the query, follows the update: the
+// watch's progress, coverage and dead letters are carried over to the key
+// of the new query, so that a restarted process that starts the watch with
+// the updated query resumes where it left off. A key set with
+// WithCursorKey does not change. UpdateQuery must not be called from a
+// handler. Returns ErrNotRunning if no such watch exists.
+func (s *Sonar) UpdateQuery(id string, q filter.Query) (uint64, error) {
+	return s.updateQuery(id, func(filter.Query) (filter.Query, error) {
+		return q, nil
+	})
+}
+
+// AddAddresses adds contract addresses to the running watch with the given
+// ID, as UpdateQuery does; logs of the added addresses are delivered from
+// the returned boundary block on. It fails if the watch matches every
+// address, since adding some would narrow it.
+func (s *Sonar) AddAddresses(id string, addrs ...event.Address) (uint64, error) {
+	return s.updateQuery(id, func(q filter.Query) (filter.Query, error) {
+		return addAddresses(q, addrs)
+	})
+}
+
+// AddAddressesFrom adds contract addresses like AddAddresses, and backfills
+// their logs from block from up to the boundary before the watch continues.
+// Backfilled logs are delivered to the handler like any others, but are not
+// tracked for reorgs and do not move the cursor; they are not backfilled
+// again if the process restarts before the backfill completes. Streaming
+// watches cannot backfill.
+func (s *Sonar) AddAddressesFrom(id string, from uint64, addrs ...event.Address) (uint64, error) {
+	return s.addAddressesFrom(id, from, addrs, nil)
+}
+
+// addAddressesFrom is AddAddressesFrom, calling done, if not nil, once the
+// backfill completes.
+func (s *Sonar) addAddressesFrom(id string, from uint64, addrs []event.Address, done func()) (uint64, error) {
+	h, err := s.handle(id)
+	if err != nil {
+		return 0, err
+	}
+	b, ok := h.w.(watcher.Backfiller)
+	if !ok {
+		return 0, fmt.Errorf("sonar: watch %s cannot backfill", id)
+	}
+
+	h.updating.Lock()
+	defer h.updating.Unlock()
+	q, err := addAddresses(h.Query(), addrs)
+	if err != nil {
+		return 0, err
+	}
+	boundary, err := s.applyQuery(h, q)
+	if err != nil {
+		return 0, err
+	}
+	if from >= boundary {
+		if done != nil {
+			done()
+		}
+		return boundary, nil
+	}
+	b.Backfill(filter.Query{Addresses: addrs, Topics: q.Topics}, from, boundary-1, done)
+	s.logger.Info("watch backfill scheduled", "chain", h.chain, "watch", id, "from_block", from, "to_block", boundary-1)
+	return boundary, nil
+}
+
+// RemoveAddresses removes contract addresses from the running watch with
+// the given ID, as UpdateQuery does; their logs are delivered up to the
+// block before the returned boundary. It fails if no address would remain,
+// since an empty address list matches every contract.
+func (s *Sonar) RemoveAddresses(id string, addrs ...event.Address) (uint64, error) {
+	return s.updateQuery(id, func(q filter.Query) (filter.Query, error) {
+		remove := make(map[event.Address]bool, len(addrs))
+		for _, a := range addrs {
+			remove[a] = true
+		}
+		var kept []event.Address
+		for _, a := range q.Addresses {
+			if !remove[a] {
+				kept = append(kept, a)
+			}
+		}
+		if len(kept) == 0 {
+			return q, fmt.Errorf("sonar: watch %s: cannot remove every address", id)
+		}
+		q.Addresses = kept
+		return q, nil
+	})
+}
+
+// SetTopics replaces the topic filters of the running watch with the given
+// ID, as UpdateQuery does.
+func (s *Sonar) SetTopics(id string, topics ...[]event.Hash) (uint64, error) {
+	return s.updateQuery(id, func(q filter.Query) (filter.Query, error) {
+		q.Topics = topics
+		return q, nil
+	})
+}
+
+// updateQuery applies the query returned by update, given the current one,
+// to the watch with the given ID.
+func (s *Sonar) updateQuery(id string, update func(filter.Query) (filter.Query, error)) (uint64, error) {
+	h, err := s.handle(id)
+	if err != nil {
+		return 0, err
+	}
+
+	h.updating.Lock()
+	defer h.updating.Unlock()
+	q, err := update(h.Query())
+	if err != nil {
+		return 0, err
+	}
+	return s.applyQuery(h, q)
+}
+
+// applyQuery passes the addresses and topics of q to the watcher of h and
+// records them. Callers hold h.updating.
+func (s *Sonar) applyQuery(h *Handle, q filter.Query) (uint64, error) {
+	if h.derived {
+		if key := CursorKey(h.chain, q); key != h.CursorKey() {
+			return s.applyQueryKey(h, q, key)
+		}
+	}
+	u, ok := h.w.(watcher.QueryUpdater)
+	if !ok {
+		return 0, fmt.Errorf("sonar: watch %s cannot update its query", h.id)
+	}
+	boundary := u.UpdateQuery(q)
+	s.queryUpdated(h, q, boundary)
+	return boundary, nil
+}
+
+// applyQueryKey is applyQuery for a watch whose cursor key is derived from
+// its query: the watch moves its progress, coverage and dead letters to key,
+// the default key of q, so that a restart with q resumes from them.
+func (s *Sonar) applyQueryKey(h *Handle, q filter.Query, key string) (uint64, error) {
+	u, ok := h.w.(watcher.CursorKeyUpdater)
+	if !ok {
+		return 0, fmt.Errorf("sonar: watch %s cannot update its query", h.id)
+	}
+	if err := s.loadCoverage(key); err != nil {
+		return 0, err
+	}
+
+	// Switch the key first, so that the coverage the watcher reports once
+	// it has moved is recorded under the new one.
+	old := h.CursorKey()
+	h.mu.Lock()
+	h.key = key
+	h.mu.Unlock()
+	boundary, err := u.UpdateQueryKey(q, key)
+	if err != nil {
+		h.mu.Lock()
+		h.key = old
+		h.mu.Unlock()
+		return 0, fmt.Errorf("sonar: watch %s: %w", h.id, err)
+	}
+	s.moveCoverage(h, old, key)
+	s.moveDeadLetters(h, old, key)
+	s.logger.Info("watch cursor key changed", "chain", h.chain, "watch", h.id, "from", old, "to", key)
+
+	s.queryUpdated(h, q, boundary)
+	return boundary, nil
+}
+
+// queryUpdated records the addresses and topics of q as the query of h.
+func (s *Sonar) queryUpdated(h *Handle, q filter.Query, boundary uint64) {
+	h.mu.Lock()
+	h.query.Addresses = q.Addresses
+	h.query.Topics = q.Topics
+	h.mu.Unlock()
+
+	s.logger.Info("watch query updated", "chain", h.chain, "watch", h.id, "addresses", len(q.Addresses), "boundary", boundary)
+}
+
+// addAddresses returns q with addrs appended, skipping those it has.
+func addAddresses(q filter.Query, addrs []event.Address) (filter.Query, error) {
+	if len(q.Addresses) == 0 {
+		return q, fmt.Errorf("sonar: query matches every address")
+	}
+	has := make(map[event.Address]bool, len(q.Addresses))
+	for _, a := range q.Addresses {
+		has[a] = true
+	}
+	merged := append([]event.Address(nil), q.Addresses...)
+	for _, a := range addrs {
+		if !has[a] {
+			has[a] = true
+			merged = append(merged, a)
+		}
+	}
+	q.Addresses = merged
+	return q, nil
+}
@@ -0,0 +1,92 @@
+package sonar
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/coverage"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/deadletter"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+func TestUpdateQueryCursorKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []WatchOption
+		wantMoved bool
+	}{
+		{name: "default key follows the query", wantMoved: true},
+		{name: "set key stays", opts: []WatchOption{WithCursorKey("fixed")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := cursor.NewMemory()
+			cov := coverage.NewMemory()
+			dl := deadletter.NewMemory()
+			c := &logChain{head: 10, logs: []event.Log{logAt(address(1), 3, 0)}}
+			newSonar := func() *Sonar {
+				s := newTestSonar(WithCursor(cur), WithCoverage(cov), WithDeadLetter(dl, 1), WithPollInterval(time.Millisecond))
+				if err := s.AddChain(c); err != nil {
+					t.Fatal(err)
+				}
+				return s
+			}
+
+			s := newSonar()
+			caughtUp := make(chan uint64, 10)
+			opts := append([]WatchOption{WithStartBlock(1), WithOnCaughtUp(func(b uint64) { caughtUp <- b })}, tt.opts...)
+			h, err := s.Watch("test", filter.Query{Addresses: []event.Address{address(1)}}, func(event.Log) {}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-caughtUp:
+			case <-time.After(5 * time.Second):
+				t.Fatal("watch did not catch up")
+			}
+			old := h.CursorKey()
+			dl.Put(deadletter.Entry{ID: "failed", Chain: "test", WatchID: h.ID(), CursorKey: old})
+
+			if _, err := s.AddAddresses(h.ID(), address(2)); err != nil {
+				t.Fatal(err)
+			}
+			q := h.Query()
+			want := old
+			if tt.wantMoved {
+				want = CursorKey("test", q)
+			}
+			if got := h.CursorKey(); got != want {
+				t.Fatalf("cursor key %s after the update, want %s", got, want)
+			}
+			if got, _ := cur.Load(want); got != 10 {
+				t.Errorf("progress under %s = %d, want 10", want, got)
+			}
+			if entries, _ := dl.List(); len(entries) != 1 || entries[0].CursorKey != want {
+				t.Errorf("dead letters %+v, want one under %s", entries, want)
+			}
+			s.Shutdown(context.Background())
+			if got, _ := cov.Load(want); !slices.Equal(got, []coverage.Range{{From: 1, To: 10}}) {
+				t.Errorf("coverage under %s = %v, want [1, 10]", want, got)
+			}
+
+			// A restart with the updated query resumes after block 10.
+			c.mu.Lock()
+			c.head = 15
+			c.logs = append(c.logs, logAt(address(2), 12, 0))
+			c.mu.Unlock()
+			s = newSonar()
+			defer s.Shutdown(context.Background())
+			got := newCollector()
+			if _, err := s.WatchE("test", q, got.handle, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			if blocks := got.wait(t, 1); !slices.Equal(blocks, []uint64{12}) {
+				t.Errorf("delivered blocks %v after the restart, want [12]", blocks)
+			}
+		})
+	}
+}
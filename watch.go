@@ -0,0 +1,379 @@
+package sonar
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/coverage"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/watcher"
+)
+
+// State is the lifecycle state of a watch.
+type State = watcher.State
+
+// Watch lifecycle states reported by Status.
+const (
+	StateStarting   = watcher.StateStarting
+	StateCatchingUp = watcher.StateCatchingUp
+	StateLive       = watcher.StateLive
+	StateStopped    = watcher.StateStopped
+	StateFailed     = watcher.StateFailed
+	StatePaused     = watcher.StatePaused
+)
+
+// Start block sentinels for WithStartBlock.
+const (
+	// StartEarliest starts a watch at the genesis block.
+	StartEarliest = watcher.StartEarliest
+
+	// StartLatest starts a watch at the safe head. This is the default.
+	StartLatest = watcher.StartLatest
+)
+
+// CursorKey returns the default cursor key of a watch on chainID with query q.
+// Watches with the same addresses and topics on the same chain share it and
+// therefore resume from the same point.
+func CursorKey(chainID string, q filter.Query) string {
+	return chainID + ":" + q.Fingerprint()
+}
+
+// WatchOptions holds the settings of a single watch.
+type WatchOptions struct {
+	// ID names the watch. It must be unique within a Sonar instance.
+	// Defaults to "<chain>-<n>".
+	ID string
+
+	// CursorKey is the key the watch saves its progress under.
+	// Defaults to CursorKey(chain, query).
+	CursorKey string
+
+	// Confirmations overrides the number of confirmation blocks.
+	// Nil keeps the chain default or global setting.
+	Confirmations *uint64
+
+	// Finality overrides the finality mode. Empty keeps the chain default or
+	// global setting.
+	Finality chain.BlockTag
+
+	// BatchSize overrides the number of blocks per eth_getLogs query, within
+	// the limits set with WithBatchSizeLimits. Zero keeps the chain default or
+	// global setting.
+	BatchSize uint64
+
+	// Interval overrides the polling interval. Zero keeps the chain default or
+	// global setting.
+	Interval time.Duration
+
+	// StartBlock is the first block scanned when the watch has no saved
+	// progress. Nil starts at the safe head.
+	StartBlock *uint64
+
+	// EmptyBatches makes a batch watch deliver ranges without logs.
+	EmptyBatches bool
+
+	// OnCaughtUp is called with the safe head each time the watch catches up
+	// with it, starting with the first time. It is not called for streaming
+	// watches.
+	OnCaughtUp func(block uint64)
+}
+
+// WatchOption configures a single watch.
+type WatchOption func(*WatchOptions)
+
+// WithWatchID sets the ID of a watch instead of generating one.
+func WithWatchID(id string) WatchOption {
+	return func(o *WatchOptions) {
+		o.ID = id
+	}
+}
+
+// WithCursorKey names the cursor entry of a watch, so that its progress
+// survives changes to the query. Watches sharing a key share progress.
+func WithCursorKey(key string) WatchOption {
+	return func(o *WatchOptions) {
+		o.CursorKey = key
+	}
+}
+
+// WithWatchConfirmations sets the number of confirmation blocks of a watch.
+func WithWatchConfirmations(n uint64) WatchOption {
+	return func(o *WatchOptions) {
+		o.Confirmations = &n
+	}
+}
+
+// WithWatchFinality sets the finality mode of a watch, e.g. chain.TagFinalized
+// for processing that must never see a reorganization.
+func WithWatchFinality(tag chain.BlockTag) WatchOption {
+	return func(o *WatchOptions) {
+		o.Finality = tag
+	}
+}
+
+// WithWatchBatchSize sets the number of blocks per query of a watch.
+func WithWatchBatchSize(size uint64) WatchOption {
+	return func(o *WatchOptions) {
+		o.BatchSize = size
+	}
+}
+
+// WithWatchInterval sets the polling interval of a watch.
+func WithWatchInterval(d time.Duration) WatchOption {
+	return func(o *WatchOptions) {
+		o.Interval = d
+	}
+}
+
+// WithStartBlock sets the block a watch starts scanning at when it has no
+// saved progress: a block number, StartEarliest or StartLatest. Blocks behind
+// the safe head are caught up with back-to-back queries of the catch-up batch
+// size before the watch settles into regular polling.
+func WithStartBlock(block uint64) WatchOption {
+	return func(o *WatchOptions) {
+		o.StartBlock = &block
+	}
+}
+
+// WithOnCaughtUp registers a callback invoked when a watch catches up with the
+// safe head, e.g. to report readiness.
+func WithOnCaughtUp(fn func(block uint64)) WatchOption {
+	return func(o *WatchOptions) {
+		o.OnCaughtUp = fn
+	}
+}
+
+// WithEmptyBatches makes a WatchBatch watch deliver every scanned range,
+// including those without logs, e.g. to commit progress per range.
+func WithEmptyBatches() WatchOption {
+	return func(o *WatchOptions) {
+		o.EmptyBatches = true
+	}
+}
+
+// apply overrides the polling settings of cfg with those set on o.
+func (o WatchOptions) apply(cfg *watcher.PollerConfig) {
+	if o.Confirmations != nil {
+		cfg.Confirmations = *o.Confirmations
+	}
+	if o.Finality != "" {
+		cfg.Finality = o.Finality
+	}
+	if o.BatchSize > 0 {
+		cfg.BatchSize = o.BatchSize
+	}
+	if o.Interval > 0 {
+		cfg.Interval = o.Interval
+	}
+	if o.StartBlock != nil {
+		cfg.StartBlock = o.StartBlock
+	}
+	if o.CursorKey != "" {
+		cfg.CursorKey = o.CursorKey
+	}
+	if o.EmptyBatches {
+		cfg.EmptyBatches = true
+	}
+}
+
+// runner is a watcher as run by a Handle: log watchers, and block watchers,
+// which do not deliver logs.
+type runner interface {
+	Watch() error
+	Stop() error
+}
+
+// Handle refers to a running watch.
+type Handle struct {
+	id    string
+	seq   uint64
+	chain string
+	mode  WatchMode
+	named bool // the ID was set with WithWatchID
+	w     runner
+	s     *Sonar
+
+	// derived is set if the cursor key is derived from the query, so that
+	// it follows query updates.
+	derived bool
+
+	// updating serializes query updates; mu guards query and key.
+	updating sync.Mutex
+	mu       sync.Mutex
+	query    filter.Query
+	key      string
+
+	// handler is the user handler, kept for re-driving dead letters.
+	handler func(event.Log) error
+
+	// done is closed when the watcher has exited.
+	done chan struct{}
+}
+
+// ID returns the watch ID.
+func (h *Handle) ID() string {
+	return h.id
+}
+
+// Chain returns the ID of the watched chain.
+func (h *Handle) Chain() string {
+	return h.chain
+}
+
+// CursorKey returns the key the watch saves its progress under. It is empty
+// for streaming watches, which do not track progress. A key derived from the
+// query changes with it.
+func (h *Handle) CursorKey() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.key
+}
+
+// Unwatch stops the watch. It is equivalent to calling Sonar.Unwatch with the
+// handle's ID.
+func (h *Handle) Unwatch() error {
+	return h.s.Unwatch(h.id)
+}
+
+// Pause halts the watch until Resume. It is equivalent to calling
+// Sonar.Pause with the handle's ID.
+func (h *Handle) Pause() error {
+	return h.s.Pause(h.id)
+}
+
+// Resume continues the watch after Pause. It is equivalent to calling
+// Sonar.Resume with the handle's ID.
+func (h *Handle) Resume() error {
+	return h.s.Resume(h.id)
+}
+
+// UpdateQuery replaces the addresses and topics of the watch. It is
+// equivalent to calling Sonar.UpdateQuery with the handle's ID.
+func (h *Handle) UpdateQuery(q filter.Query) (uint64, error) {
+	return h.s.UpdateQuery(h.id, q)
+}
+
+// AddAddresses adds contract addresses to the watch. It is equivalent to
+// calling Sonar.AddAddresses with the handle's ID.
+func (h *Handle) AddAddresses(addrs ...event.Address) (uint64, error) {
+	return h.s.AddAddresses(h.id, addrs...)
+}
+
+// AddAddressesFrom adds contract addresses to the watch and backfills them
+// from a past block. It is equivalent to calling Sonar.AddAddressesFrom with
+// the handle's ID.
+func (h *Handle) AddAddressesFrom(from uint64, addrs ...event.Address) (uint64, error) {
+	return h.s.AddAddressesFrom(h.id, from, addrs...)
+}
+
+// RemoveAddresses removes contract addresses from the watch. It is
+// equivalent to calling Sonar.RemoveAddresses with the handle's ID.
+func (h *Handle) RemoveAddresses(addrs ...event.Address) (uint64, error) {
+	return h.s.RemoveAddresses(h.id, addrs...)
+}
+
+// SetTopics replaces the topic filters of the watch. It is equivalent to
+// calling Sonar.SetTopics with the handle's ID.
+func (h *Handle) SetTopics(topics ...[]event.Hash) (uint64, error) {
+	return h.s.SetTopics(h.id, topics...)
+}
+
+// cursor returns the last block the watch has saved progress at, or zero if
+// it does not track progress.
+func (h *Handle) cursor() uint64 {
+	if sr, ok := h.w.(watcher.StatusReporter); ok {
+		return sr.Status().Cursor
+	}
+	return 0
+}
+
+// Query returns the current query of the watch.
+func (h *Handle) Query() filter.Query {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.query
+}
+
+// Status reports the progress of the watch.
+func (h *Handle) Status() WatchStatus {
+	st := WatchStatus{WatchInfo: h.info()}
+	if key := h.CursorKey(); key != "" {
+		st.Gaps, _ = h.s.Gaps(key)
+	}
+	sr, ok := h.w.(watcher.StatusReporter)
+	if !ok {
+		return st
+	}
+	ws := sr.Status()
+	st.State = ws.State
+	st.Head = ws.Head
+	st.SafeHead = ws.SafeHead
+	st.Cursor = ws.Cursor
+	st.Delivered = ws.Delivered
+	st.LastError = ws.LastError
+	st.LastErrorAt = ws.LastErrorAt
+	if h.mode != ModeStream {
+		st.LagBlocks = ws.Lag()
+		if !ws.CursorTime.IsZero() {
+			st.Lag = time.Since(ws.CursorTime)
+		}
+	}
+	return st
+}
+
+// WatchStatus reports the progress of a running watch.
+type WatchStatus struct {
+	WatchInfo
+
+	// State is the lifecycle state of the watch.
+	State State
+
+	// Head is the latest block seen on the chain, and SafeHead the newest
+	// block the watch may process under its finality mode.
+	Head     uint64
+	SafeHead uint64
+
+	// Cursor is the last block whose logs have all been delivered. Streaming
+	// watches do not track it.
+	Cursor uint64
+
+	// LagBlocks is the number of blocks between the cursor and the head.
+	LagBlocks uint64
+
+	// Lag is the age of the cursor block. Zero if the block time is unknown,
+	// which is the case for chains without header lookups and for hybrid and
+	// streaming watches.
+	Lag time.Duration
+
+	// Delivered is the number of logs the handler acknowledged.
+	Delivered uint64
+
+	// Gaps are the block ranges missing from the coverage recorded under the
+	// cursor key, in block order. Streaming watches do not record coverage.
+	Gaps []coverage.Range
+
+	// LastError is the most recent error of the watch, reported at LastErrorAt.
+	LastError   error
+	LastErrorAt time.Time
+}
+
+// WatchInfo describes a running watch.
+type WatchInfo struct {
+	ID        string
+	Chain     string
+	Mode      WatchMode
+	Query     filter.Query
+	CursorKey string
+}
+
+func (h *Handle) info() WatchInfo {
+	return WatchInfo{
+		ID:        h.id,
+		Chain:     h.chain,
+		Mode:      h.mode,
+		Query:     h.Query(),
+		CursorKey: h.CursorKey(),
+	}
+}
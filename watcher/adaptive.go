@@ -0,0 +1,108 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// growAfter is the number of consecutive successful fetches after which the
+// block window is doubled again.
+const growAfter = 4
+
+// rangeSizer adapts the eth_getLogs block window to provider limits. The
+// window is halved whenever a query is rejected as too large and doubled
+// after a run of successful queries, always staying within [min, max].
+type rangeSizer struct {
+	size      uint64
+	min       uint64
+	max       uint64
+	successes int
+}
+
+// newRangeSizer creates a sizer starting at initial. A zero minSize defaults
+// to 1 and a zero maxSize defaults to initial.
+func newRangeSizer(initial, minSize, maxSize uint64) *rangeSizer {
+	if minSize == 0 {
+		minSize = 1
+	}
+	if maxSize == 0 {
+		maxSize = initial
+	}
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	if initial < minSize {
+		initial = minSize
+	}
+	if initial > maxSize {
+		initial = maxSize
+	}
+	return &rangeSizer{size: initial, min: minSize, max: maxSize}
+}
+
+// shrink halves the window relative to the span that was just rejected.
+// It returns false when the span is already at the minimum.
+func (r *rangeSizer) shrink(span uint64) bool {
+	r.successes = 0
+	if span <= r.min {
+		return false
+	}
+	r.size = span / 2
+	if r.size < r.min {
+		r.size = r.min
+	}
+	return true
+}
+
+// succeed records a successful fetch and grows the window after enough of them.
+func (r *rangeSizer) succeed() {
+	r.successes++
+	if r.successes < growAfter || r.size >= r.max {
+		return
+	}
+	r.successes = 0
+	if r.size > r.max/2 {
+		r.size = r.max
+	} else {
+		r.size *= 2
+	}
+}
+
+// fetchRange fetches logs from block from onwards, covering at most the
+// sizer's window and never going past to. When the provider rejects a range as
+// too large, the range is bisected and fetched again. It returns the logs and
+// the last block the fetch covered. Each fetch is logged at debug level.
+func fetchRange(ctx context.Context, logger *slog.Logger, c chain.Chain, query filter.Query, sizer *rangeSizer, from, to uint64) ([]event.Log, uint64, error) {
+	for {
+		end := from + sizer.size - 1
+		if end > to || end < from {
+			end = to
+		}
+
+		q := query
+		q.FromBlock = &from
+		q.ToBlock = &end
+
+		start := time.Now()
+		logs, err := c.FetchLogs(ctx, q)
+		if err == nil {
+			sizer.succeed()
+			logger.Debug("fetched logs", "from_block", from, "to_block", end,
+				"logs", len(logs), "duration", time.Since(start))
+			return logs, end, nil
+		}
+		if errors.Is(err, chain.ErrRangeTooLarge) && sizer.shrink(end-from+1) {
+			logger.Debug("range too large, shrinking", "from_block", from, "to_block", end,
+				"size", sizer.size)
+			continue
+		}
+		return nil, end, &RangeError{FromBlock: from, ToBlock: end, Err: fmt.Errorf("fetch logs [%d, %d]: %w", from, end, err)}
+	}
+}
@@ -0,0 +1,207 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+func TestNewRangeSizer(t *testing.T) {
+	tests := []struct {
+		name                       string
+		initial, minSize, max      uint64
+		wantSize, wantMin, wantMax uint64
+	}{
+		{name: "defaults", initial: 100, wantSize: 100, wantMin: 1, wantMax: 100},
+		{name: "explicit limits", initial: 100, minSize: 10, max: 1000, wantSize: 100, wantMin: 10, wantMax: 1000},
+		{name: "initial below min", initial: 5, minSize: 10, max: 1000, wantSize: 10, wantMin: 10, wantMax: 1000},
+		{name: "initial above max", initial: 5000, minSize: 10, max: 1000, wantSize: 1000, wantMin: 10, wantMax: 1000},
+		{name: "max below min", initial: 50, minSize: 100, max: 10, wantSize: 100, wantMin: 100, wantMax: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRangeSizer(tt.initial, tt.minSize, tt.max)
+			if r.size != tt.wantSize || r.min != tt.wantMin || r.max != tt.wantMax {
+				t.Errorf("sizer = {size %d, min %d, max %d}, want {size %d, min %d, max %d}",
+					r.size, r.min, r.max, tt.wantSize, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRangeSizerShrink(t *testing.T) {
+	tests := []struct {
+		name      string
+		initial   uint64
+		minSize   uint64
+		spans     []uint64 // rejected spans, in order
+		wantSizes []uint64
+		wantOK    []bool
+	}{
+		{
+			name:      "halves down to a single block",
+			initial:   8,
+			spans:     []uint64{8, 4, 2, 1},
+			wantSizes: []uint64{4, 2, 1, 1},
+			wantOK:    []bool{true, true, true, false},
+		},
+		{
+			name:      "odd spans round down",
+			initial:   7,
+			spans:     []uint64{7, 3},
+			wantSizes: []uint64{3, 1},
+			wantOK:    []bool{true, true},
+		},
+		{
+			name:      "clamped to min",
+			initial:   100,
+			minSize:   30,
+			spans:     []uint64{100, 50, 30},
+			wantSizes: []uint64{50, 30, 30},
+			wantOK:    []bool{true, true, false},
+		},
+		{
+			name:      "relative to the rejected span",
+			initial:   100,
+			spans:     []uint64{10},
+			wantSizes: []uint64{5},
+			wantOK:    []bool{true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRangeSizer(tt.initial, tt.minSize, 0)
+			for i, span := range tt.spans {
+				ok := r.shrink(span)
+				if ok != tt.wantOK[i] || r.size != tt.wantSizes[i] {
+					t.Fatalf("shrink(%d) = %v with size %d, want %v with size %d",
+						span, ok, r.size, tt.wantOK[i], tt.wantSizes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRangeSizerGrow(t *testing.T) {
+	tests := []struct {
+		name      string
+		size, max uint64
+		successes int
+		want      uint64
+	}{
+		{name: "too few successes", size: 10, max: 100, successes: growAfter - 1, want: 10},
+		{name: "doubles", size: 10, max: 100, successes: growAfter, want: 20},
+		{name: "doubles again", size: 10, max: 100, successes: 2 * growAfter, want: 40},
+		{name: "capped at max", size: 60, max: 100, successes: growAfter, want: 100},
+		{name: "stays at max", size: 100, max: 100, successes: 3 * growAfter, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRangeSizer(tt.max, 1, tt.max)
+			r.size = tt.size
+			for range tt.successes {
+				r.succeed()
+			}
+			if r.size != tt.want {
+				t.Errorf("size after %d successes = %d, want %d", tt.successes, r.size, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeSizerShrinkResetsGrowth(t *testing.T) {
+	r := newRangeSizer(100, 1, 100)
+	r.shrink(100)
+	for range growAfter - 1 {
+		r.succeed()
+	}
+	r.shrink(50)
+	for range growAfter - 1 {
+		r.succeed()
+	}
+	if r.size != 25 {
+		t.Errorf("size = %d, want 25: successes before a shrink must not count", r.size)
+	}
+}
+
+// limitedChain rejects log queries spanning more than limit blocks and
+// returns one log per block of the others.
+type limitedChain struct {
+	limit uint64
+	spans []uint64
+}
+
+func (c *limitedChain) ID() string { return "test" }
+
+func (c *limitedChain) LatestBlock(ctx context.Context) (uint64, error) { return 0, nil }
+
+func (c *limitedChain) FetchLogs(ctx context.Context, q filter.Query) ([]event.Log, error) {
+	span := *q.ToBlock - *q.FromBlock + 1
+	c.spans = append(c.spans, span)
+	if span > c.limit {
+		return nil, fmt.Errorf("test: %w", chain.ErrRangeTooLarge)
+	}
+	var logs []event.Log
+	for n := *q.FromBlock; n <= *q.ToBlock; n++ {
+		logs = append(logs, event.Log{BlockNumber: n})
+	}
+	return logs, nil
+}
+
+func (c *limitedChain) Subscribe(ctx context.Context, q filter.Query) (chain.Subscription, error) {
+	return nil, errors.New("test: not supported")
+}
+
+func TestFetchRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     uint64
+		size      uint64
+		from, to  uint64
+		wantEnd   uint64
+		wantSpans []uint64
+		wantErr   bool
+	}{
+		{name: "within limit", limit: 100, size: 10, from: 1, to: 100, wantEnd: 10, wantSpans: []uint64{10}},
+		{name: "clipped to the last block", limit: 100, size: 10, from: 95, to: 100, wantEnd: 100, wantSpans: []uint64{6}},
+		{name: "bisects once", limit: 5, size: 10, from: 1, to: 100, wantEnd: 5, wantSpans: []uint64{10, 5}},
+		{name: "bisects to a single block", limit: 1, size: 16, from: 1, to: 100, wantEnd: 1, wantSpans: []uint64{16, 8, 4, 2, 1}},
+		{name: "single block rejected", limit: 0, size: 4, from: 7, to: 100, wantEnd: 7, wantSpans: []uint64{4, 2, 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &limitedChain{limit: tt.limit}
+			sizer := newRangeSizer(tt.size, 1, tt.size)
+
+			logs, end, err := fetchRange(context.Background(), orDiscard(nil), c, filter.Query{}, sizer, tt.from, tt.to)
+			if tt.wantErr {
+				var re *RangeError
+				if !errors.As(err, &re) || !errors.Is(err, chain.ErrRangeTooLarge) {
+					t.Fatalf("error = %v, want a RangeError wrapping chain.ErrRangeTooLarge", err)
+				}
+				if re.FromBlock != tt.from || re.ToBlock != tt.wantEnd {
+					t.Errorf("RangeError = [%d, %d], want [%d, %d]", re.FromBlock, re.ToBlock, tt.from, tt.wantEnd)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("fetchRange: %v", err)
+				}
+				if got := uint64(len(logs)); got != end-tt.from+1 {
+					t.Errorf("got %d logs for [%d, %d]", got, tt.from, end)
+				}
+			}
+			if end != tt.wantEnd {
+				t.Errorf("end = %d, want %d", end, tt.wantEnd)
+			}
+			if !slices.Equal(c.spans, tt.wantSpans) {
+				t.Errorf("fetched spans %v, want %v", c.spans, tt.wantSpans)
+			}
+		})
+	}
+}
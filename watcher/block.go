@@ -0,0 +1,353 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// ErrHeadersUnsupported is returned by BlockWatcher.Watch for chains that do
+// not implement chain.HeaderReader.
+var ErrHeadersUnsupported = errors.New("watcher: chain cannot look up block headers")
+
+// BlockConfig configures a BlockWatcher.
+type BlockConfig struct {
+	// PollerConfig sets the interval, confirmations, finality, reorg depth,
+	// retry strategy, start block and cursor key as for Poller. BatchSize and
+	// CatchUpBatchSize are the number of headers fetched per cycle.
+	PollerConfig
+
+	// Subscribe wakes the watcher on every new head pushed by chains that
+	// implement chain.HeadSubscriber, instead of waiting for the next
+	// interval. Polling continues while the subscription is unavailable.
+	Subscribe bool
+}
+
+// BlockWatcher delivers the header of every block in order, including blocks
+// without logs, following the chain like Poller does: progress is saved to
+// the cursor, blocks are only delivered once the finality mode considers
+// them safe, and with reorg detection enabled, blocks orphaned by a
+// reorganization are delivered again with Removed set, newest first, before
+// the canonical chain is delivered from the common ancestor. Its status
+// counts delivered blocks.
+type BlockWatcher struct {
+	pollLoop
+
+	chain   chain.Chain
+	headers chain.HeaderReader
+	ranges  chain.HeaderRangeReader // nil if headers are fetched one by one
+	heads   chain.HeadSubscriber    // nil unless subscribing
+	tracker *blockTracker
+
+	// guarded by mu
+	onBlock func(event.Block) error
+}
+
+// NewBlockWatcher creates a block watcher for the given chain. The chain must
+// implement chain.HeaderReader; Watch fails otherwise.
+func NewBlockWatcher(c chain.Chain, cur cursor.Cursor, cfg BlockConfig) *BlockWatcher {
+	b := &BlockWatcher{
+		pollLoop: newPollLoop("blocks", "block watcher started", c, cur, cfg.PollerConfig),
+		chain:    withRetry(c, cfg.Retry),
+	}
+	if hr, ok := c.(chain.HeaderReader); ok {
+		b.headers = withHeaderRetry(hr, cfg.Retry)
+		if cfg.ReorgDepth > 0 {
+			b.tracker = newBlockTracker(cfg.ReorgDepth)
+		}
+	}
+	if hr, ok := c.(chain.HeaderRangeReader); ok {
+		b.ranges = withHeaderRangeRetry(hr, cfg.Retry)
+	}
+	if hs, ok := c.(chain.HeadSubscriber); ok && cfg.Subscribe {
+		b.heads = hs
+	}
+	return b
+}
+
+// OnBlock registers a callback that acknowledges each block. A block the
+// callback fails on is retried under the retry strategy; if it still fails,
+// the cursor is saved at the block before it and delivery resumes from it on
+// the next cycle.
+func (b *BlockWatcher) OnBlock(fn func(event.Block) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onBlock = fn
+}
+
+// OnError registers a callback for errors.
+func (b *BlockWatcher) OnError(fn func(error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onError = fn
+}
+
+// OnCaughtUp registers a callback invoked with the safe head each time the
+// watcher reaches it after being behind, starting with the first time.
+func (b *BlockWatcher) OnCaughtUp(fn func(block uint64)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onCaughtUp = fn
+}
+
+// OnCovered registers a callback invoked with each range of blocks the
+// watcher has delivered, once the cursor is saved past it.
+func (b *BlockWatcher) OnCovered(fn func(from, to uint64)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onCovered = fn
+}
+
+// Watch begins delivering blocks. Blocks until Stop is called or an
+// unrecoverable error occurs.
+func (b *BlockWatcher) Watch() error {
+	wake := make(chan struct{}, 1)
+	begin := func(ctx context.Context) error {
+		if b.headers == nil {
+			return fmt.Errorf("blocks: %s: %w", b.chain.ID(), ErrHeadersUnsupported)
+		}
+		if b.heads != nil {
+			go b.follow(ctx, wake)
+		}
+		return nil
+	}
+	return b.run(begin, b.poll, wake)
+}
+
+// poll delivers the headers from the next block up to the safe head, at most
+// one batch of them, and saves the cursor at the last one delivered. The
+// headers are fetched in one round trip if the chain implements
+// chain.HeaderRangeReader.
+func (b *BlockWatcher) poll(ctx context.Context) (err error) {
+	safe, ok, err := b.safeBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok || b.next > safe {
+		return nil // no final block yet, or already caught up
+	}
+
+	size := b.config.BatchSize
+	if !b.caughtUp && b.config.CatchUpBatchSize > 0 {
+		size = b.config.CatchUpBatchSize
+	}
+	if size == 0 {
+		size = 1
+	}
+	to := safe
+	if b.next+size-1 < to {
+		to = b.next + size - 1
+	}
+	headers, err := b.fetchHeaders(ctx, b.next, to)
+	if err != nil {
+		return err
+	}
+
+	first := b.next
+	var last *chain.Header
+	defer func() {
+		if serr := b.commit(first, last); serr != nil && err == nil {
+			err = serr
+		}
+	}()
+	for _, h := range headers {
+		n := h.Number
+		if prev, ok := b.lastTracked(); ok && prev.number+1 == n && h.ParentHash != prev.hash {
+			if err := b.commit(first, last); err != nil {
+				return err
+			}
+			last = nil
+			if err := b.rewind(ctx, prev); err != nil {
+				return err
+			}
+			b.behind = true // deliver the canonical chain right away
+			return nil
+		}
+
+		if err := b.emitBlock(ctx, b.toBlock(h, false)); err != nil {
+			return handlerError(n, n, fmt.Errorf("handle block %d: %w", n, err))
+		}
+		if b.tracker != nil {
+			b.tracker.add(trackedBlock{number: n, hash: h.Hash, time: h.Timestamp, header: h})
+		}
+		last = h
+		b.next = n + 1
+	}
+	b.behind = to < safe
+	return nil
+}
+
+// fetchHeaders returns the headers of the blocks from through to, in block
+// order.
+func (b *BlockWatcher) fetchHeaders(ctx context.Context, from, to uint64) ([]*chain.Header, error) {
+	if b.ranges != nil {
+		headers, err := b.ranges.HeadersByRange(ctx, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("get headers [%d, %d]: %w", from, to, err)
+		}
+		for i, h := range headers {
+			if h.Number != from+uint64(i) {
+				return nil, fmt.Errorf("get headers [%d, %d]: got block %d at position %d", from, to, h.Number, i)
+			}
+		}
+		return headers, nil
+	}
+	headers := make([]*chain.Header, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		h, err := b.headers.HeaderByNumber(ctx, n)
+		if err != nil {
+			return nil, fmt.Errorf("get header %d: %w", n, err)
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+// lastTracked returns the last delivered block if reorg detection is enabled.
+func (b *BlockWatcher) lastTracked() (trackedBlock, bool) {
+	if b.tracker == nil {
+		return trackedBlock{}, false
+	}
+	return b.tracker.last()
+}
+
+// commit saves the cursor at h, the last delivered block, if any, of those
+// delivered from block first on.
+func (b *BlockWatcher) commit(first uint64, h *chain.Header) error {
+	if h == nil {
+		return nil
+	}
+	if err := b.cursor.Save(b.key, h.Number); err != nil {
+		return cursorSaveError(err)
+	}
+	b.status.progress(h.Number, h.Timestamp)
+	b.emitCovered(first, h.Number)
+	return nil
+}
+
+// rewind undoes the blocks orphaned by a reorganization detected above last:
+// it delivers them again with Removed set, newest first, and moves the
+// cursor back to the common ancestor.
+func (b *BlockWatcher) rewind(ctx context.Context, last trackedBlock) error {
+	ancestor, found, err := b.tracker.ancestor(ctx, b.headers)
+	if err != nil {
+		return fmt.Errorf("find reorg ancestor: %w", err)
+	}
+	if !found {
+		oldest := b.tracker.blocks[0].number
+		if oldest > 0 {
+			ancestor = oldest - 1
+		}
+	}
+
+	b.log.Warn("reorg detected", "block", last.number, "ancestor", ancestor, "found", found)
+
+	// The tracker is only rewound once every removal is acknowledged, so a
+	// failed removal is detected and delivered again on the next cycle.
+	for _, tb := range b.tracker.above(ancestor) {
+		if err := b.emitBlock(ctx, b.toBlock(tb.header, true)); err != nil {
+			return handlerError(tb.number, tb.number, fmt.Errorf("handle removed block %d: %w", tb.number, err))
+		}
+	}
+	b.tracker.rewind(ancestor)
+
+	if err := b.cursor.Save(b.key, ancestor); err != nil {
+		return cursorSaveError(err)
+	}
+	b.next = ancestor + 1
+	b.status.progress(ancestor, time.Time{})
+
+	if !found {
+		b.emitError(fmt.Errorf("reorg at block %d: %w", last.number, ErrReorgTooDeep))
+	}
+	return nil
+}
+
+// follow subscribes to new heads and signals wake for each one, subscribing
+// again with a growing backoff when the subscription fails or ends.
+func (b *BlockWatcher) follow(ctx context.Context, wake chan<- struct{}) {
+	backoff := expBackoff{base: b.config.Interval}
+	for {
+		err := b.subscribe(ctx, wake, &backoff)
+		if ctx.Err() != nil {
+			return
+		}
+		if backoff.streak == 0 {
+			b.log.Warn("head subscription failed, polling", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff.next()):
+		}
+	}
+}
+
+// subscribe signals wake for every head received until the subscription
+// fails or ends.
+func (b *BlockWatcher) subscribe(ctx context.Context, wake chan<- struct{}, backoff *expBackoff) error {
+	sub, err := b.heads.SubscribeHeads(ctx)
+	if err != nil {
+		return fmt.Errorf("blocks: subscribe heads: %w", err)
+	}
+	defer sub.Unsubscribe()
+	backoff.reset()
+	b.log.Info("subscribed to heads")
+
+	errs := sub.Err()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-sub.Heads():
+			if !ok {
+				return fmt.Errorf("blocks: head subscription closed")
+			}
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return fmt.Errorf("blocks: head subscription: %w", err)
+		}
+	}
+}
+
+func (b *BlockWatcher) toBlock(h *chain.Header, removed bool) event.Block {
+	return event.Block{
+		Chain:      b.chain.ID(),
+		Number:     h.Number,
+		Hash:       h.Hash,
+		ParentHash: h.ParentHash,
+		Timestamp:  h.Timestamp,
+		BaseFee:    h.BaseFee,
+		Removed:    removed,
+	}
+}
+
+func (b *BlockWatcher) emitBlock(ctx context.Context, block event.Block) error {
+	b.mu.Lock()
+	fn := b.onBlock
+	b.mu.Unlock()
+	if fn == nil {
+		return nil
+	}
+	err := retry.Do(ctx, b.config.Retry, func(context.Context) error {
+		return fn(block)
+	})
+	if err != nil {
+		return err
+	}
+	b.status.delivered(1)
+	return nil
+}
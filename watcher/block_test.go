@@ -0,0 +1,166 @@
+package watcher
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+)
+
+// rangeChain is a forkChain that also looks up headers by range, counting
+// the lookups of each kind.
+type rangeChain struct {
+	*forkChain
+
+	mu              sync.Mutex
+	ranges, singles int
+}
+
+func (c *rangeChain) HeaderByNumber(ctx context.Context, n uint64) (*chain.Header, error) {
+	c.mu.Lock()
+	c.singles++
+	c.mu.Unlock()
+	return c.forkChain.HeaderByNumber(ctx, n)
+}
+
+func (c *rangeChain) HeadersByRange(ctx context.Context, from, to uint64) ([]*chain.Header, error) {
+	c.mu.Lock()
+	c.ranges++
+	c.mu.Unlock()
+	c.forkChain.mu.Lock()
+	defer c.forkChain.mu.Unlock()
+	var hs []*chain.Header
+	for n := from; n <= to; n++ {
+		hs = append(hs, c.header(n))
+	}
+	return hs, nil
+}
+
+// runBlocks runs b until it has delivered n blocks and returns them.
+func runBlocks(t *testing.T, b *BlockWatcher, n int) []delivery {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		got  []delivery
+		done = make(chan struct{})
+	)
+	b.OnBlock(func(block event.Block) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, delivery{block: block.Number, removed: block.Removed})
+		if len(got) == n {
+			close(done)
+		}
+		return nil
+	})
+	exited := make(chan error, 1)
+	go func() { exited <- b.Watch() }()
+
+	select {
+	case <-done:
+	case err := <-exited:
+		t.Fatalf("Watch returned %v", err)
+	case <-time.After(5 * time.Second):
+		mu.Lock()
+		t.Fatalf("timed out with deliveries %v", got)
+	}
+	b.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Clone(got)
+}
+
+func testBlockWatcher(c chain.Chain, batch uint64) *BlockWatcher {
+	start := uint64(1)
+	cfg := DefaultPollerConfig()
+	cfg.Interval = time.Millisecond
+	cfg.BatchSize = batch
+	cfg.StartBlock = &start
+	return NewBlockWatcher(c, cursor.NewMemory(), BlockConfig{PollerConfig: cfg})
+}
+
+func TestBlockWatcherFetchesRanges(t *testing.T) {
+	c := &rangeChain{forkChain: newForkChain(10)}
+	got := runBlocks(t, testBlockWatcher(c, 5), 10)
+
+	var want []delivery
+	for n := uint64(1); n <= 10; n++ {
+		want = append(want, delivery{block: n})
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("deliveries %v, want %v", got, want)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ranges != 2 || c.singles != 0 {
+		t.Errorf("looked up %d ranges and %d single headers, want 2 ranges and none", c.ranges, c.singles)
+	}
+}
+
+func TestBlockWatcherReorg(t *testing.T) {
+	c := newForkChain(5)
+	b := testBlockWatcher(c, 10)
+	b.OnCaughtUp(func(uint64) {
+		c.reorg(4, 1)
+		c.extend(6)
+	})
+	got := runBlocks(t, b, 10)
+
+	want := []delivery{
+		{block: 1}, {block: 2}, {block: 3}, {block: 4}, {block: 5},
+		{block: 5, removed: true}, {block: 4, removed: true},
+		{block: 4}, {block: 5}, {block: 6},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("deliveries %v, want %v", got, want)
+	}
+}
+
+func TestBlockWatcherPause(t *testing.T) {
+	c := newForkChain(3)
+	b := testBlockWatcher(c, 10)
+	delivered := make(chan uint64, 10)
+	b.OnBlock(func(block event.Block) error {
+		delivered <- block.Number
+		return nil
+	})
+	caughtUp := make(chan struct{}, 10)
+	b.OnCaughtUp(func(uint64) { caughtUp <- struct{}{} })
+	done := make(chan error, 1)
+	go func() { done <- b.Watch() }()
+	defer func() {
+		b.Stop()
+		<-done
+	}()
+
+	<-caughtUp
+	b.Pause()
+	for len(delivered) > 0 {
+		<-delivered
+	}
+	c.extend(5)
+	time.Sleep(20 * time.Millisecond)
+	if n := len(delivered); n != 0 {
+		t.Fatalf("delivered %d blocks while paused", n)
+	}
+	if st := b.Status(); st.State != StatePaused || st.Head != 5 {
+		t.Errorf("status while paused = %v at head %d, want %v at head 5", st.State, st.Head, StatePaused)
+	}
+
+	b.Resume()
+	for _, want := range []uint64{4, 5} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Fatalf("delivered block %d after Resume, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no delivery after Resume")
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package watcher
+
+// CoverageReporter is implemented by watchers that report the block ranges
+// they have fully processed.
+type CoverageReporter interface {
+	// OnCovered registers a callback invoked with each inclusive block range
+	// whose logs, or blocks, have all been delivered with the watcher's
+	// query, once its progress is saved. Ranges may repeat, e.g. after a
+	// reorg, and backfills with another query are not reported.
+	OnCovered(fn func(from, to uint64))
+}
@@ -0,0 +1,38 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCursorSave is wrapped by the errors reported when a watcher cannot save
+// its progress to the cursor. The watcher carries on, and delivers the
+// blocks after the last saved one again after a restart.
+var ErrCursorSave = errors.New("watcher: save cursor failed")
+
+// RangeError is reported for a failure concerning a block range: a fetch
+// that failed, or a handler that failed on a log or batch in the range. Its
+// message is that of the underlying error.
+type RangeError struct {
+	FromBlock uint64
+	ToBlock   uint64
+
+	// Handler is set if the handler failed rather than the chain.
+	Handler bool
+
+	Err error
+}
+
+func (e *RangeError) Error() string { return e.Err.Error() }
+
+func (e *RangeError) Unwrap() error { return e.Err }
+
+// handlerError wraps err, a handler failure on the logs of [from, to].
+func handlerError(from, to uint64, err error) error {
+	return &RangeError{FromBlock: from, ToBlock: to, Handler: true, Err: err}
+}
+
+// cursorSaveError wraps err, a failure to save the cursor.
+func cursorSaveError(err error) error {
+	return fmt.Errorf("%w: %w", ErrCursorSave, err)
+}
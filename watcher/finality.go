@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+)
+
+// safeHead resolves the newest block a watcher may process under its
+// finality mode. It is shared by Poller and BlockWatcher.
+type safeHead struct {
+	chain         chain.Chain
+	tags          chain.TagReader // nil if the chain cannot resolve tags
+	tag           chain.BlockTag  // falls back to chain.TagLatest, see get
+	confirmations uint64
+}
+
+func newSafeHead(c chain.Chain, cfg PollerConfig) *safeHead {
+	h := &safeHead{
+		chain:         withRetry(c, cfg.Retry),
+		tag:           cfg.finality(c),
+		confirmations: cfg.Confirmations,
+	}
+	if tr, ok := c.(chain.TagReader); ok {
+		h.tags = withTagRetry(tr, cfg.Retry)
+	}
+	return h
+}
+
+// get returns the latest block and the safe head, and false if no block is
+// final yet.
+//
+// A node that has no block for the tag yet, e.g. while it starts up or
+// syncs, yields an ordinary error, so that the cycle is retried. Only a node
+// that rejects the tag outright makes the head fall back to latest minus
+// confirmations, reported through fallback, and only if confirmations are
+// configured: a watch that asked for safe or finalized blocks never
+// processes unconfirmed ones. Without confirmations, the returned error wraps
+// chain.ErrTagUnsupported and the watch should fail.
+func (h *safeHead) get(ctx context.Context, fallback func(error)) (latest, safe uint64, ok bool, err error) {
+	latest, err = h.chain.LatestBlock(ctx)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("get latest block: %w", err)
+	}
+
+	if h.tag != chain.TagLatest {
+		hdr, err := h.headerByTag(ctx)
+		switch {
+		case err == nil:
+			return latest, hdr.Number, true, nil
+		case errors.Is(err, chain.ErrTagUnsupported) && h.confirmations > 0:
+			fallback(fmt.Errorf("%w; falling back to %d confirmations", err, h.confirmations))
+			h.tag = chain.TagLatest
+		case errors.Is(err, chain.ErrTagUnsupported):
+			return latest, 0, false, fmt.Errorf("%w; set confirmations to fall back to, or use the latest block", err)
+		default:
+			return latest, 0, false, fmt.Errorf("get %s block: %w", h.tag, err)
+		}
+	}
+
+	if latest <= h.confirmations {
+		return latest, 0, false, nil
+	}
+	return latest, latest - h.confirmations, true, nil
+}
+
+// wait is like get, but retries errors other than a rejected tag with a
+// growing backoff from interval, reporting each, until the safe head is
+// known or ctx is done. Watchers call it at start when there is no progress
+// to resume from, so that a node still syncing does not fail the watch.
+func (h *safeHead) wait(ctx context.Context, interval time.Duration, fallback, report func(error)) (latest, safe uint64, ok bool, err error) {
+	backoff := expBackoff{base: interval}
+	for {
+		latest, safe, ok, err = h.get(ctx, fallback)
+		if err == nil || errors.Is(err, chain.ErrTagUnsupported) {
+			return latest, safe, ok, err
+		}
+		if ctx.Err() != nil {
+			return latest, safe, ok, ctx.Err()
+		}
+		report(err)
+		select {
+		case <-ctx.Done():
+			return latest, safe, ok, ctx.Err()
+		case <-time.After(backoff.next()):
+		}
+	}
+}
+
+// headerByTag resolves the tag, treating chains that cannot resolve tags
+// like nodes that reject them.
+func (h *safeHead) headerByTag(ctx context.Context) (*chain.Header, error) {
+	if h.tags == nil {
+		return nil, fmt.Errorf("%s: %s: %w", h.chain.ID(), h.tag, chain.ErrTagUnsupported)
+	}
+	return h.tags.HeaderByTag(ctx, h.tag)
+}
@@ -0,0 +1,204 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// tagChain is at block latest and resolves tags to safe, failing the first
+// failures lookups with err.
+type tagChain struct {
+	latest, safe uint64
+	err          error
+	failures     int
+	lookups      int
+}
+
+func (c *tagChain) ID() string { return "test" }
+
+func (c *tagChain) LatestBlock(ctx context.Context) (uint64, error) { return c.latest, nil }
+
+func (c *tagChain) FetchLogs(ctx context.Context, q filter.Query) ([]event.Log, error) {
+	return nil, nil
+}
+
+func (c *tagChain) Subscribe(ctx context.Context, q filter.Query) (chain.Subscription, error) {
+	return nil, errors.New("test: not supported")
+}
+
+func (c *tagChain) HeaderByTag(ctx context.Context, tag chain.BlockTag) (*chain.Header, error) {
+	c.lookups++
+	if c.lookups <= c.failures {
+		return nil, c.err
+	}
+	return &chain.Header{Number: c.safe}, nil
+}
+
+func TestSafeHeadGet(t *testing.T) {
+	errMissing := errors.New("test: finalized block not found")
+	errRejected := fmt.Errorf("test: %w", chain.ErrTagUnsupported)
+
+	tests := []struct {
+		name          string
+		tag           chain.BlockTag
+		confirmations uint64
+		err           error
+		wantSafe      uint64
+		wantOK        bool
+		wantErr       error // nil for no error, or the error it must wrap
+		wantFallback  bool
+	}{
+		{name: "latest", tag: chain.TagLatest, confirmations: 10, wantSafe: 90, wantOK: true},
+		{name: "latest without confirmations", tag: chain.TagLatest, wantSafe: 100, wantOK: true},
+		{name: "finalized", tag: chain.TagFinalized, wantSafe: 70, wantOK: true},
+		{name: "no block for the tag yet", tag: chain.TagFinalized, confirmations: 10, err: errMissing, wantErr: errMissing},
+		{name: "rejected tag with confirmations", tag: chain.TagSafe, confirmations: 10, err: errRejected, wantSafe: 90, wantOK: true, wantFallback: true},
+		{name: "rejected tag without confirmations", tag: chain.TagSafe, err: errRejected, wantErr: chain.ErrTagUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &tagChain{latest: 100, safe: 70, err: tt.err, failures: 1}
+			if tt.err == nil {
+				c.failures = 0
+			}
+			h := newSafeHead(c, PollerConfig{Finality: tt.tag, Confirmations: tt.confirmations})
+			h.tags = c // no retries
+
+			var fellBack bool
+			latest, safe, ok, err := h.get(context.Background(), func(error) { fellBack = true })
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("get error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if err == nil && (latest != 100 || safe != tt.wantSafe || ok != tt.wantOK) {
+				t.Errorf("get = %d, %d, %v; want 100, %d, %v", latest, safe, ok, tt.wantSafe, tt.wantOK)
+			}
+			if fellBack != tt.wantFallback {
+				t.Errorf("fell back = %v, want %v", fellBack, tt.wantFallback)
+			}
+			if tt.wantFallback && h.tag != chain.TagLatest {
+				t.Errorf("tag after falling back = %q, want %q", h.tag, chain.TagLatest)
+			}
+		})
+	}
+}
+
+func TestSafeHeadWait(t *testing.T) {
+	t.Run("retries a missing block", func(t *testing.T) {
+		c := &tagChain{latest: 100, safe: 70, err: errors.New("test: finalized block not found"), failures: 2}
+		h := newSafeHead(c, PollerConfig{Finality: chain.TagFinalized})
+		h.tags = c
+
+		var reported int
+		_, safe, ok, err := h.wait(context.Background(), time.Millisecond, func(error) {}, func(error) { reported++ })
+		if err != nil || !ok || safe != 70 {
+			t.Fatalf("wait = %d, %v, %v; want 70, true, nil", safe, ok, err)
+		}
+		if reported != 2 {
+			t.Errorf("reported %d errors, want 2", reported)
+		}
+	})
+
+	t.Run("fails on a rejected tag", func(t *testing.T) {
+		c := &tagChain{latest: 100, err: fmt.Errorf("test: %w", chain.ErrTagUnsupported), failures: 1}
+		h := newSafeHead(c, PollerConfig{Finality: chain.TagSafe})
+		h.tags = c
+
+		_, _, _, err := h.wait(context.Background(), time.Millisecond, func(error) {}, func(error) {})
+		if !errors.Is(err, chain.ErrTagUnsupported) {
+			t.Fatalf("wait error = %v, want chain.ErrTagUnsupported", err)
+		}
+		if c.lookups != 1 {
+			t.Errorf("wait made %d lookups, want 1", c.lookups)
+		}
+	})
+
+	t.Run("stops with the context", func(t *testing.T) {
+		c := &tagChain{latest: 100, err: errors.New("test: finalized block not found"), failures: 1 << 30}
+		h := newSafeHead(c, PollerConfig{Finality: chain.TagFinalized})
+		h.tags = c
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, _, _, err := h.wait(ctx, time.Millisecond, func(error) {}, func(error) {})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("wait error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestSafeHeadWithoutTagReader(t *testing.T) {
+	c := &limitedChain{}
+	h := newSafeHead(c, PollerConfig{Finality: chain.TagFinalized})
+
+	_, _, _, err := h.get(context.Background(), func(error) {})
+	if !errors.Is(err, chain.ErrTagUnsupported) {
+		t.Fatalf("get error = %v, want chain.ErrTagUnsupported", err)
+	}
+}
+
+func TestPollerRejectedTag(t *testing.T) {
+	rejected := fmt.Errorf("test: %w", chain.ErrTagUnsupported)
+
+	t.Run("without confirmations the watch fails", func(t *testing.T) {
+		c := &tagChain{latest: 100, err: rejected, failures: 1 << 30}
+		cfg := DefaultPollerConfig()
+		cfg.Finality = chain.TagSafe
+		cfg.Interval = time.Millisecond
+
+		err := NewPoller(c, filter.Query{}, cursor.NewMemory(), cfg).Watch()
+		if !errors.Is(err, chain.ErrTagUnsupported) {
+			t.Fatalf("Watch error = %v, want chain.ErrTagUnsupported", err)
+		}
+	})
+
+	t.Run("with confirmations the watch falls back", func(t *testing.T) {
+		c := &tagChain{latest: 100, err: rejected, failures: 1 << 30}
+		cfg := DefaultPollerConfig()
+		cfg.Finality = chain.TagSafe
+		cfg.Confirmations = 10
+		cfg.Interval = time.Millisecond
+
+		p := NewPoller(c, filter.Query{}, cursor.NewMemory(), cfg)
+		reported := make(chan error, 1)
+		p.OnError(func(err error) {
+			select {
+			case reported <- err:
+			default:
+			}
+		})
+		done := make(chan error, 1)
+		go func() { done <- p.Watch() }()
+
+		select {
+		case err := <-reported:
+			if !errors.Is(err, chain.ErrTagUnsupported) {
+				t.Errorf("reported error = %v, want chain.ErrTagUnsupported", err)
+			}
+		case err := <-done:
+			t.Fatalf("Watch returned %v before falling back", err)
+		case <-time.After(time.Second):
+			t.Fatal("no fallback reported")
+		}
+		if err := p.Stop(); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		if got := p.Status().SafeHead; got != 90 {
+			t.Errorf("safe head = %d, want 90", got)
+		}
+	})
+}
@@ -0,0 +1,527 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// hybridWindow is the number of recent blocks whose logs are remembered to
+// suppress duplicates between the streaming and backfill paths.
+const hybridWindow = 256
+
+// Hybrid monitors a chain through a real-time subscription and fills gaps
+// over RPC. Each time it (re)subscribes, it first backfills every block since
+// the last fully processed one with FetchLogs, up to the head and to the
+// first log the subscription buffered meanwhile, then switches to live
+// delivery. Logs that arrive on both paths are delivered once. A subscription
+// that ends, including one the transport ends because it overflowed, is
+// followed by a reconnect and another backfill, so a dropped notification is
+// fetched over RPC instead of being skipped.
+//
+// Progress is saved to the cursor like Poller does: the saved block is the
+// last one whose logs have all been delivered, so a restart resumes with a
+// backfill from the following block. Confirmations do not apply; logs are
+// delivered as soon as they are streamed.
+type Hybrid struct {
+	chain  chain.Chain
+	query  filter.Query
+	cursor cursor.Cursor
+	key    string
+	config PollerConfig
+	sizer  *rangeSizer
+	seen   *logSet
+	log    *slog.Logger
+
+	// next is the first block not yet fully processed, and fetched the last
+	// block fetched over RPC in the current session; live is set once the
+	// subscription covers every block after fetched. Owned by the watch
+	// goroutine and guarded by the gate.
+	next      uint64
+	fetched   uint64
+	live      bool
+	caughtUp  bool
+	backfills []backfill
+
+	status statusTracker
+	gate   gate
+
+	mu         sync.Mutex
+	onEvent    func(event.Log) error
+	onError    func(error)
+	onCaughtUp func(uint64)
+	onCovered  func(from, to uint64)
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+	halted     bool // Stop was called before Watch
+}
+
+// NewHybrid creates a hybrid watcher for the given chain. Interval is used as
+// the base delay between reconnection attempts; the batch size settings,
+// including CatchUpBatchSize, and the retry strategy apply to backfills.
+// StartBlock applies as for Poller, with the latest block as the safe head.
+func NewHybrid(c chain.Chain, query filter.Query, cur cursor.Cursor, cfg PollerConfig) *Hybrid {
+	sizer := cfg.catchUpSizer()
+	if sizer == nil {
+		sizer = newRangeSizer(cfg.BatchSize, cfg.MinBatchSize, cfg.MaxBatchSize)
+	}
+	return &Hybrid{
+		chain:   withRetry(c, cfg.Retry),
+		query:   query,
+		cursor:  cur,
+		key:     cfg.cursorKey(c.ID()),
+		config:  cfg,
+		sizer:   sizer,
+		seen:    newLogSet(hybridWindow),
+		log:     orDiscard(cfg.Logger),
+		stopped: make(chan struct{}),
+	}
+}
+
+// OnEvent registers a callback for received events.
+func (h *Hybrid) OnEvent(fn func(event.Log)) {
+	h.OnEventE(acked(fn))
+}
+
+// OnEventE registers a callback that acknowledges received events. A log the
+// callback still fails on after retries ends the session: progress stays
+// before its block, and the log is delivered again by the backfill that
+// follows the reconnect.
+func (h *Hybrid) OnEventE(fn func(event.Log) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onEvent = fn
+}
+
+// OnError registers a callback for errors.
+func (h *Hybrid) OnError(fn func(error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onError = fn
+}
+
+// OnCaughtUp registers a callback invoked with the last backfilled block each
+// time a backfill completes after (re)subscribing, starting with the first.
+func (h *Hybrid) OnCaughtUp(fn func(block uint64)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onCaughtUp = fn
+}
+
+// OnCovered registers a callback invoked with each block range the watcher
+// has processed, once the cursor is saved past it, and with each completed
+// backfill window scanned with the watcher's query.
+func (h *Hybrid) OnCovered(fn func(from, to uint64)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onCovered = fn
+}
+
+// Status returns a snapshot of the watcher's progress. The head is the
+// newest block seen by a backfill or on the subscription.
+func (h *Hybrid) Status() Status {
+	return h.status.get()
+}
+
+// Watch starts streaming. Blocks until Stop is called. Disconnects are
+// reported through OnError and followed by a reconnect and backfill.
+func (h *Hybrid) Watch() (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.cancel = cancel
+	halted := h.halted
+	h.mu.Unlock()
+
+	defer close(h.stopped)
+	defer func() { h.status.exited(err) }()
+	defer cancel()
+
+	if halted {
+		return nil
+	}
+	if err := h.start(ctx); err != nil {
+		return err
+	}
+
+	backoff := expBackoff{base: h.config.Interval}
+	for {
+		pausing, ok := h.gate.enter()
+		if !ok {
+			if !h.whilePaused(ctx) {
+				return nil
+			}
+			continue
+		}
+		sctx, cancelSession := cancelOnPause(ctx, pausing)
+		err := h.session(sctx, &backoff)
+		interrupted := sctx.Err() != nil
+		cancelSession()
+		h.gate.leave()
+		if ctx.Err() != nil {
+			return nil
+		}
+		h.caughtUp = false
+		if interrupted {
+			continue // paused or interrupted
+		}
+		h.status.setState(StateCatchingUp)
+		h.emitError(err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff.next()):
+		}
+	}
+}
+
+// start determines the first block to backfill. It holds the gate, so that a
+// query update waits for the starting block to be known.
+func (h *Hybrid) start(ctx context.Context) error {
+	h.gate.hold()
+	defer h.gate.release()
+
+	lastBlock, err := h.cursor.Load(h.key)
+	if err != nil {
+		return fmt.Errorf("hybrid: load cursor: %w", err)
+	}
+	if lastBlock > 0 {
+		h.status.progress(lastBlock, time.Time{})
+		h.next = lastBlock + 1
+		return nil
+	}
+	latest, err := h.chain.LatestBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("hybrid: get latest block: %w", err)
+	}
+	h.next = h.config.startBlock(latest)
+	return nil
+}
+
+// Pause ends the subscription after the log being delivered, if any, and
+// halts delivery. On Resume, the watcher subscribes again and backfills
+// every block since the last processed one. While paused, it still follows
+// the chain head so that its status shows the growing lag. Pause must not be
+// called from the watcher's callbacks.
+func (h *Hybrid) Pause() {
+	h.gate.pause()
+	h.status.paused()
+}
+
+// Resume continues delivery after Pause.
+func (h *Hybrid) Resume() {
+	h.gate.resume()
+}
+
+// Paused reports whether the watcher is paused.
+func (h *Hybrid) Paused() bool {
+	return h.gate.isPaused()
+}
+
+// UpdateQuery ends the subscription after the log being delivered, if any,
+// replaces the addresses and topics of the query and subscribes again with
+// it, backfilling from the returned block. That block may already have been
+// partly delivered with the old query; logs delivered before are not
+// delivered again.
+func (h *Hybrid) UpdateQuery(q filter.Query) uint64 {
+	var boundary uint64
+	h.gate.interrupt(func() {
+		h.query = withFilter(h.query, q)
+		boundary = h.next
+	})
+	return boundary
+}
+
+// UpdateQueryKey is UpdateQuery, also saving progress under key from the
+// returned block on, with the progress saved so far carried over to it.
+func (h *Hybrid) UpdateQueryKey(q filter.Query, key string) (uint64, error) {
+	var (
+		boundary uint64
+		err      error
+	)
+	h.gate.interrupt(func() {
+		if err = carryProgress(h.cursor, h.key, key); err != nil {
+			err = fmt.Errorf("hybrid: %w", err)
+			return
+		}
+		h.key = key
+		h.query = withFilter(h.query, q)
+		boundary = h.next
+	})
+	return boundary, err
+}
+
+// Backfill ends the subscription after the log being delivered, if any, and
+// scans blocks from through to with q before subscribing again. Logs are
+// delivered to the same callback without moving the cursor.
+func (h *Hybrid) Backfill(q filter.Query, from, to uint64, done func()) {
+	b := backfill{query: q, from: from, to: to, done: done}
+	if from > to {
+		b.complete()
+		return
+	}
+	h.gate.interrupt(func() {
+		h.backfills = append(h.backfills, b)
+	})
+}
+
+// runBackfills completes the pending backfills, oldest first. A backfill that
+// fails resumes from the failed window or log in the next session.
+func (h *Hybrid) runBackfills(ctx context.Context) error {
+	for len(h.backfills) > 0 {
+		b := &h.backfills[0]
+		h.log.Info("backfilling", "from_block", b.from, "to_block", b.to)
+		whole := b.covers(h.query)
+		err := b.scan(ctx, h.log, h.chain, h.sizer, func(logs []event.Log, from, to uint64) error {
+			for _, log := range logs {
+				if err := h.emitEvent(ctx, log); err != nil {
+					b.from = log.BlockNumber
+					return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("hybrid: handle backfill log in block %d: %w", log.BlockNumber, err))
+				}
+				h.status.delivered(1)
+			}
+			if whole {
+				h.emitCovered(from, to)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("hybrid: backfill: %w", err)
+		}
+		b.complete()
+		h.backfills = h.backfills[1:]
+	}
+	return nil
+}
+
+// whilePaused waits for Resume, polling the head every interval. It returns
+// false if ctx is done first.
+func (h *Hybrid) whilePaused(ctx context.Context) bool {
+	h.status.paused()
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	return h.gate.wait(ctx, ticker.C, func() {
+		if latest, err := h.chain.LatestBlock(ctx); err == nil {
+			h.status.observed(latest)
+		}
+	})
+}
+
+// Stop terminates the subscription and the watch loop.
+func (h *Hybrid) Stop() error {
+	h.mu.Lock()
+	cancel := h.cancel
+	h.halted = cancel == nil
+	h.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-h.stopped
+	}
+	return nil
+}
+
+// session subscribes, backfills the gap since the last processed block and
+// then delivers live logs until the subscription ends.
+func (h *Hybrid) session(ctx context.Context, backoff *expBackoff) error {
+	if err := h.runBackfills(ctx); err != nil {
+		return err
+	}
+
+	// Subscribe before backfilling so that logs emitted during the backfill
+	// are buffered by the subscription rather than lost.
+	h.live = false
+	if h.next > 0 {
+		h.fetched = h.next - 1
+	}
+	sub, err := h.chain.Subscribe(ctx, h.query)
+	if err != nil {
+		return fmt.Errorf("hybrid: subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+	h.log.Info("subscribed", "from_block", h.next)
+
+	var pending []event.Log
+	if err := h.backfill(ctx, sub, &pending); err != nil {
+		return err
+	}
+	backoff.reset()
+
+	// Every block up to the head and up to the first buffered log has been
+	// fetched; the subscription, opened before, covers the blocks after.
+	h.live = true
+
+	for _, log := range pending {
+		if err := h.deliver(ctx, log); err != nil {
+			return err
+		}
+	}
+	h.status.setState(StateLive)
+	if !h.caughtUp && h.next > 0 {
+		h.caughtUp = true
+		h.log.Info("caught up", "block", h.next-1)
+		h.emitCaughtUp(h.next - 1)
+	}
+
+	errs := sub.Err()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case log, ok := <-sub.Logs():
+			if !ok {
+				return fmt.Errorf("hybrid: subscription closed")
+			}
+			if err := h.deliver(ctx, log); err != nil {
+				return err
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			h.emitError(err)
+		}
+	}
+}
+
+// backfill fetches logs from the next unprocessed block up to the chain head,
+// reading the head again until it has not moved, and at least up to the
+// block before the first live log received meanwhile, which are collected
+// into pending. Blocks in between would otherwise be skipped by the first
+// live log if the subscription missed their logs.
+func (h *Hybrid) backfill(ctx context.Context, sub chain.Subscription, pending *[]event.Log) error {
+	for {
+		latest, err := h.chain.LatestBlock(ctx)
+		if err != nil {
+			return fmt.Errorf("hybrid: get latest block: %w", err)
+		}
+		h.status.observed(latest)
+		target := latest
+		if len(*pending) > 0 {
+			if first := (*pending)[0].BlockNumber; first > 0 && first-1 > target {
+				target = first - 1
+			}
+		}
+		if h.next > target {
+			return nil
+		}
+		h.status.setState(StateCatchingUp)
+
+		for h.next <= target {
+			logs, end, err := fetchRange(ctx, h.log, h.chain, h.query, h.sizer, h.next, target)
+			if err != nil {
+				return fmt.Errorf("hybrid: backfill: %w", err)
+			}
+			h.fetched = end
+			for _, log := range logs {
+				if err := h.deliver(ctx, log); err != nil {
+					return err
+				}
+			}
+			h.advance(end + 1)
+
+			if !drain(sub, pending) {
+				return fmt.Errorf("hybrid: subscription closed")
+			}
+		}
+	}
+}
+
+// drain moves buffered subscription logs into pending without blocking.
+// It returns false if the subscription has ended.
+func drain(sub chain.Subscription, pending *[]event.Log) bool {
+	for {
+		select {
+		case log, ok := <-sub.Logs():
+			if !ok {
+				return false
+			}
+			*pending = append(*pending, log)
+		default:
+			return true
+		}
+	}
+}
+
+// deliver emits log unless it was already delivered, and advances progress:
+// logs arrive in block order, so a log from a later block means every block
+// before it is complete. Progress only moves past blocks that were fetched
+// over RPC, or that the subscription covers once live.
+func (h *Hybrid) deliver(ctx context.Context, log event.Log) error {
+	if !log.Removed && log.BlockNumber+hybridWindow < h.next {
+		return nil // covered long ago
+	}
+	if !h.seen.add(log) {
+		return nil
+	}
+	h.status.observed(log.BlockNumber)
+	if !log.Removed && log.BlockNumber > h.next && (h.live || log.BlockNumber <= h.fetched+1) {
+		h.advance(log.BlockNumber)
+	}
+	if err := h.emitEvent(ctx, log); err != nil {
+		h.seen.remove(log)
+		return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("hybrid: handle log in block %d: %w", log.BlockNumber, err))
+	}
+	h.status.delivered(1)
+	return nil
+}
+
+// advance marks every block before next as processed and saves the cursor.
+func (h *Hybrid) advance(next uint64) {
+	prev := h.next
+	h.next = next
+	if next == 0 {
+		return
+	}
+	if err := h.cursor.Save(h.key, next-1); err != nil {
+		h.emitError(fmt.Errorf("hybrid: %w", cursorSaveError(err)))
+		return
+	}
+	h.status.progress(next-1, time.Time{})
+	if next > prev {
+		h.emitCovered(prev, next-1)
+	}
+}
+
+func (h *Hybrid) emitEvent(ctx context.Context, log event.Log) error {
+	h.mu.Lock()
+	fn := h.onEvent
+	h.mu.Unlock()
+	return handle(ctx, h.config.Retry, fn, log)
+}
+
+func (h *Hybrid) emitCaughtUp(block uint64) {
+	h.mu.Lock()
+	fn := h.onCaughtUp
+	h.mu.Unlock()
+	if fn != nil {
+		fn(block)
+	}
+}
+
+func (h *Hybrid) emitCovered(from, to uint64) {
+	h.mu.Lock()
+	fn := h.onCovered
+	h.mu.Unlock()
+	if fn != nil {
+		fn(from, to)
+	}
+}
+
+func (h *Hybrid) emitError(err error) {
+	h.status.failed(err)
+	h.mu.Lock()
+	fn := h.onError
+	h.mu.Unlock()
+	if fn != nil {
+		fn(err)
+	}
+}
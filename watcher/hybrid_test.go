@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// startHybrid runs a hybrid watcher on c, returning channels of its
+// delivered blocks, reported errors and Watch result.
+func startHybrid(t *testing.T, c *subChain) (*Hybrid, chan uint64, chan error, chan error) {
+	t.Helper()
+	cfg := DefaultPollerConfig()
+	cfg.Interval = time.Millisecond
+	h := NewHybrid(c, filter.Query{}, cursor.NewMemory(), cfg)
+
+	logs := make(chan uint64, 10)
+	errs := make(chan error, 10)
+	h.OnEvent(func(log event.Log) { logs <- log.BlockNumber })
+	h.OnError(func(err error) { errs <- err })
+	done := make(chan error, 1)
+	go func() { done <- h.Watch() }()
+	t.Cleanup(func() {
+		h.Stop()
+		<-done
+	})
+	return h, logs, errs, done
+}
+
+func TestHybridResubscribes(t *testing.T) {
+	c := &subChain{subs: make(chan *testSubscription)}
+	_, logs, errs, done := startHybrid(t, c)
+
+	for _, block := range []uint64{1, 2} {
+		sub := newTestSubscription()
+		c.subs <- sub
+		sub.logs <- streamedLog(block)
+		if got := <-logs; got != block {
+			t.Fatalf("delivered block %d, want %d", got, block)
+		}
+		sub.end()
+
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Fatal("reported a nil error for the closed subscription")
+			}
+		case err := <-done:
+			t.Fatalf("Watch returned %v after the subscription closed, want a resubscription", err)
+		case <-time.After(time.Second):
+			t.Fatal("closed subscription not reported")
+		}
+	}
+}
+
+func TestHybridPauseResume(t *testing.T) {
+	c := &subChain{subs: make(chan *testSubscription)}
+	h, logs, errs, _ := startHybrid(t, c)
+
+	sub := newTestSubscription()
+	c.subs <- sub
+	sub.logs <- streamedLog(1)
+	<-logs
+
+	h.Pause()
+	if !h.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	if got := h.Status().State; got != StatePaused {
+		t.Errorf("state = %v, want %v", got, StatePaused)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("pausing reported %v, want no error", err)
+	default:
+	}
+
+	// Resuming subscribes again.
+	h.Resume()
+	sub = newTestSubscription()
+	select {
+	case c.subs <- sub:
+	case <-time.After(time.Second):
+		t.Fatal("no new subscription after Resume")
+	}
+	sub.logs <- streamedLog(2)
+	if got := <-logs; got != 2 {
+		t.Errorf("delivered block %d after Resume, want 2", got)
+	}
+}
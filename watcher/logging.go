@@ -0,0 +1,11 @@
+package watcher
+
+import "log/slog"
+
+// orDiscard returns l, or a logger that drops every record if l is nil.
+func orDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return l
+}
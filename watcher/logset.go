@@ -0,0 +1,75 @@
+package watcher
+
+import "github.com/hedeqiang/sonar/event"
+
+// logKey identifies a delivered log. Removed logs are keyed separately so
+// that undoing a log is not mistaken for a duplicate of its delivery.
+type logKey struct {
+	blockHash event.Hash
+	txHash    event.Hash
+	logIndex  uint
+	removed   bool
+}
+
+func keyOf(log event.Log) logKey {
+	return logKey{
+		blockHash: log.BlockHash,
+		txHash:    log.TxHash,
+		logIndex:  log.LogIndex,
+		removed:   log.Removed,
+	}
+}
+
+// logSet remembers the logs delivered within the most recent window of blocks
+// so that a log arriving on more than one path is delivered only once.
+type logSet struct {
+	window  uint64
+	keys    map[logKey]uint64 // key -> block number
+	head    uint64
+	pruneAt uint64
+}
+
+func newLogSet(window uint64) *logSet {
+	return &logSet{
+		window: window,
+		keys:   make(map[logKey]uint64),
+	}
+}
+
+// add records log and reports whether it was not seen before.
+func (s *logSet) add(log event.Log) bool {
+	k := keyOf(log)
+	if _, ok := s.keys[k]; ok {
+		return false
+	}
+	s.keys[k] = log.BlockNumber
+
+	if log.BlockNumber > s.head {
+		s.head = log.BlockNumber
+		if s.head >= s.pruneAt {
+			s.prune()
+		}
+	}
+	return true
+}
+
+// remove forgets log, e.g. because its delivery failed and it must be
+// accepted again when it is next received.
+func (s *logSet) remove(log event.Log) {
+	delete(s.keys, keyOf(log))
+}
+
+// prune forgets logs that fell out of the window. It runs at most once per
+// quarter window to keep the amortized cost low.
+func (s *logSet) prune() {
+	s.pruneAt = s.head + s.window/4 + 1
+	if s.head <= s.window {
+		return
+	}
+	floor := s.head - s.window
+	for k, block := range s.keys {
+		if block < floor {
+			delete(s.keys, k)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// pollLoop is the polling loop shared by Poller and BlockWatcher. It finds
+// the first block from the cursor or the safe head, then runs a polling
+// cycle once per interval, right away while behind the safe head, and
+// between cycles only while not paused. The poll function of the watcher
+// moves next, safeHead and behind.
+type pollLoop struct {
+	name    string // prefixes errors, e.g. "poller"
+	started string // logged once the first block is known
+	cursor  cursor.Cursor
+	key     string
+	config  PollerConfig
+	head    *safeHead
+	log     *slog.Logger
+
+	// polling state, owned by the polling goroutine and guarded by the gate
+	next     uint64 // first block not yet processed
+	backoff  expBackoff
+	resumeAt time.Time
+	safeHead uint64
+	behind   bool // the last poll stopped short of the safe head
+	caughtUp bool
+
+	status statusTracker
+	gate   gate
+
+	mu         sync.Mutex
+	onError    func(error)
+	onCaughtUp func(uint64)
+	onCovered  func(from, to uint64)
+	cancel     context.CancelFunc
+	stopped    chan struct{}
+	halted     bool // Stop was called before Watch
+}
+
+func newPollLoop(name, started string, c chain.Chain, cur cursor.Cursor, cfg PollerConfig) pollLoop {
+	return pollLoop{
+		name:    name,
+		started: started,
+		cursor:  cur,
+		key:     cfg.cursorKey(c.ID()),
+		config:  cfg,
+		head:    newSafeHead(c, cfg),
+		log:     orDiscard(cfg.Logger),
+		backoff: expBackoff{base: cfg.Interval},
+		stopped: make(chan struct{}),
+	}
+}
+
+// run polls until Stop is called or a cycle fails for good. Before the first
+// block is determined, it calls begin, if set, which may end the watch with
+// an error or start work bound to the watch context. Receiving from wake
+// starts the next cycle before the interval has passed.
+func (l *pollLoop) run(begin func(context.Context) error, poll func(context.Context) error, wake <-chan struct{}) (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.mu.Lock()
+	l.cancel = cancel
+	halted := l.halted
+	l.mu.Unlock()
+
+	defer close(l.stopped)
+	defer func() { l.status.exited(err) }()
+	defer cancel()
+
+	if halted {
+		return nil
+	}
+	if begin != nil {
+		if err := begin(ctx); err != nil {
+			return err
+		}
+	}
+	if err := l.start(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	l.log.Info(l.started, "from_block", l.next, "finality", l.head.tag)
+
+	ticker := time.NewTicker(l.config.Interval)
+	defer ticker.Stop()
+
+	// Run the first poll immediately instead of waiting for the first tick,
+	// and keep polling without waiting while behind the safe head
+	for {
+		if _, ok := l.gate.enter(); !ok {
+			// Keep following the head while paused, so that lag shows.
+			l.status.paused()
+			if !l.gate.wait(ctx, ticker.C, func() { l.safeBlock(ctx) }) {
+				return nil
+			}
+			continue
+		}
+		behind, err := l.cycle(ctx, poll)
+		l.gate.leave()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if behind {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// start determines the first block to poll. It holds the gate, so that a
+// query update waits for the starting block to be known.
+func (l *pollLoop) start(ctx context.Context) error {
+	l.gate.hold()
+	defer l.gate.release()
+
+	lastBlock, err := l.cursor.Load(l.key)
+	if err != nil {
+		return fmt.Errorf("%s: load cursor: %w", l.name, err)
+	}
+	if lastBlock > 0 {
+		l.status.progress(lastBlock, time.Time{})
+		l.next = lastBlock + 1 // resume after last processed block
+		return nil
+	}
+
+	// No cursor — start from the configured block, or from the chain's
+	// safe head so we immediately pick up events
+	latest, safe, _, err := l.head.wait(ctx, l.config.Interval, l.reportFallback, l.emitError)
+	if err != nil {
+		return fmt.Errorf("%s: %w", l.name, err)
+	}
+	l.status.heads(latest, safe)
+	l.next = l.config.startBlock(safe)
+	return nil
+}
+
+// cycle runs one polling cycle and reports whether the watcher is still
+// behind the safe head. While the chain's circuit breaker is open, cycles are
+// skipped with a growing backoff and the outage is reported once. It returns
+// an error only if the watch cannot go on: the node rejects the finality tag
+// and no confirmations are configured to fall back to.
+func (l *pollLoop) cycle(ctx context.Context, poll func(context.Context) error) (bool, error) {
+	if time.Now().Before(l.resumeAt) {
+		return false, nil
+	}
+
+	l.behind = false
+	err := poll(ctx)
+	switch {
+	case err == nil:
+		l.backoff.reset()
+		if l.behind {
+			l.caughtUp = false
+			l.status.setState(StateCatchingUp)
+			return true, nil
+		}
+		l.status.setState(StateLive)
+		if !l.caughtUp {
+			l.caughtUp = true
+			l.log.Info("caught up", "block", l.safeHead)
+			l.emitCaughtUp(l.safeHead)
+		}
+	case errors.Is(err, retry.ErrCircuitOpen):
+		if l.backoff.streak == 0 {
+			l.emitError(err)
+		}
+		l.resumeAt = time.Now().Add(l.backoff.next())
+	case ctx.Err() != nil:
+		// stopping; the error is a consequence of cancellation
+	case errors.Is(err, chain.ErrTagUnsupported):
+		return false, fmt.Errorf("%s: %w", l.name, err)
+	default:
+		l.emitError(err)
+	}
+	return false, nil
+}
+
+// Status returns a snapshot of the watcher's progress.
+func (l *pollLoop) Status() Status {
+	return l.status.get()
+}
+
+// Pause halts polling after the cycle in progress, if any, has completed;
+// the watcher keeps its position and resumes from it. While paused, the
+// watcher still follows the safe head so that its status shows the growing
+// lag. Pause must not be called from the watcher's callbacks.
+func (l *pollLoop) Pause() {
+	l.gate.pause()
+	l.status.paused()
+}
+
+// Resume continues polling after Pause.
+func (l *pollLoop) Resume() {
+	l.gate.resume()
+}
+
+// Paused reports whether the watcher is paused.
+func (l *pollLoop) Paused() bool {
+	return l.gate.isPaused()
+}
+
+// Stop terminates the polling loop.
+func (l *pollLoop) Stop() error {
+	l.mu.Lock()
+	cancel := l.cancel
+	l.halted = cancel == nil
+	l.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-l.stopped
+	}
+	return nil
+}
+
+// safeBlock returns the newest block the finality mode lets the watcher
+// process, and false if no block is final yet. It records the safe head for
+// the cycle in progress.
+func (l *pollLoop) safeBlock(ctx context.Context) (uint64, bool, error) {
+	latest, safe, ok, err := l.head.get(ctx, l.reportFallback)
+	if err != nil {
+		return 0, false, err
+	}
+	l.status.heads(latest, safe)
+	if ok {
+		l.safeHead = safe
+	}
+	return safe, ok, nil
+}
+
+// reportFallback reports that the finality tag fell back to confirmations.
+func (l *pollLoop) reportFallback(err error) {
+	l.emitError(fmt.Errorf("%s: %w", l.name, err))
+}
+
+func (l *pollLoop) emitCaughtUp(block uint64) {
+	l.mu.Lock()
+	fn := l.onCaughtUp
+	l.mu.Unlock()
+	if fn != nil {
+		fn(block)
+	}
+}
+
+func (l *pollLoop) emitCovered(from, to uint64) {
+	l.mu.Lock()
+	fn := l.onCovered
+	l.mu.Unlock()
+	if fn != nil {
+		fn(from, to)
+	}
+}
+
+func (l *pollLoop) emitError(err error) {
+	l.status.failed(err)
+	l.mu.Lock()
+	fn := l.onError
+	l.mu.Unlock()
+	if fn != nil {
+		fn(err)
+	}
+}
@@ -0,0 +1,160 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Pauser is implemented by watchers that can be paused without losing their
+// position.
+type Pauser interface {
+	// Pause halts delivery and waits for a delivery in progress to finish.
+	// It must not be called from the watcher's callbacks.
+	Pause()
+
+	// Resume continues delivery after Pause.
+	Resume()
+
+	// Paused reports whether the watcher is paused.
+	Paused() bool
+}
+
+// gate pauses a watcher between units of work: polling cycles, or
+// subscription sessions, which are cut short when the gate is paused or
+// interrupted.
+type gate struct {
+	busy sync.Mutex // held during a unit of work
+
+	mu      sync.Mutex
+	paused  bool
+	pausing chan struct{} // closed when paused or interrupted
+	resumed chan struct{} // closed when resumed
+}
+
+// pause stops new work and waits for work in progress to finish.
+func (g *gate) pause() {
+	g.mu.Lock()
+	if !g.paused {
+		g.paused = true
+		close(g.pausingCh())
+		g.resumed = make(chan struct{})
+	}
+	g.mu.Unlock()
+
+	// Wait for work in progress to finish.
+	g.busy.Lock()
+	g.busy.Unlock()
+}
+
+// resume lets work start again.
+func (g *gate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.resumed)
+		g.pausing = make(chan struct{})
+	}
+}
+
+func (g *gate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// enter starts a unit of work, which must be ended with leave. It returns a
+// channel closed if the gate is paused or interrupted meanwhile, and false if
+// the gate is paused already.
+func (g *gate) enter() (<-chan struct{}, bool) {
+	g.busy.Lock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.busy.Unlock()
+		return nil, false
+	}
+	return g.pausingCh(), true
+}
+
+// hold waits for the unit of work in progress, if any, to finish and keeps
+// others from starting, paused or not, until release.
+func (g *gate) hold() {
+	g.busy.Lock()
+}
+
+// release lets work start again after hold.
+func (g *gate) release() {
+	g.busy.Unlock()
+}
+
+// interrupt cuts a session in progress short and runs fn before the next
+// unit of work starts.
+func (g *gate) interrupt(fn func()) {
+	g.mu.Lock()
+	if !g.paused {
+		close(g.pausingCh())
+		g.pausing = nil
+	}
+	g.mu.Unlock()
+
+	g.hold()
+	defer g.release()
+	fn()
+}
+
+// leave ends a unit of work.
+func (g *gate) leave() {
+	g.busy.Unlock()
+}
+
+// wait blocks while the gate is paused, calling refresh on every tick so that
+// the watcher's status keeps following the chain. It returns false if ctx is
+// done first.
+func (g *gate) wait(ctx context.Context, tick <-chan time.Time, refresh func()) bool {
+	g.mu.Lock()
+	resumed := g.resumed
+	paused := g.paused
+	g.mu.Unlock()
+	if !paused {
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resumed:
+			return true
+		case <-tick:
+			if refresh != nil {
+				refresh()
+			}
+		}
+	}
+}
+
+// pausingCh returns the channel closed on the next pause or interruption.
+// Callers hold g.mu.
+func (g *gate) pausingCh() chan struct{} {
+	if g.pausing == nil {
+		g.pausing = make(chan struct{})
+	}
+	return g.pausing
+}
+
+// cancelOnPause returns a context derived from ctx that is cancelled when
+// pausing is closed, i.e. when the gate is paused or interrupted. The
+// returned function releases it.
+func cancelOnPause(ctx context.Context, pausing <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-pausing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -3,13 +3,25 @@ package watcher
 import (
 	"context"
 	"fmt"
-	"sync"
+	"log/slog"
+	"math"
 	"time"
 
 	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/cursor"
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// Start block sentinels for PollerConfig.StartBlock.
+const (
+	// StartEarliest starts scanning at the genesis block.
+	StartEarliest uint64 = 0
+
+	// StartLatest starts scanning at the safe head, i.e. the block the
+	// finality mode considers final.
+	StartLatest uint64 = math.MaxUint64
 )
 
 // PollerConfig configures a Poller.
@@ -17,11 +29,107 @@ type PollerConfig struct {
 	// Interval between polling cycles.
 	Interval time.Duration
 
-	// BatchSize is the maximum number of blocks to query per cycle.
+	// BatchSize is the number of blocks to query per cycle. When the provider
+	// rejects a range as too large, the window is bisected and grows back
+	// after successful queries, within [MinBatchSize, MaxBatchSize].
 	BatchSize uint64
 
-	// Confirmations is the number of blocks to wait for finality.
+	// MinBatchSize is the smallest window the poller shrinks to. Defaults to 1.
+	MinBatchSize uint64
+
+	// MaxBatchSize is the largest window the poller grows to. Defaults to BatchSize.
+	MaxBatchSize uint64
+
+	// Confirmations is the number of blocks to wait for finality when
+	// Finality is chain.TagLatest, or when the node rejects the configured
+	// tag. Without them, a watcher whose tag is rejected fails.
 	Confirmations uint64
+
+	// Finality selects the safe head: chain.TagLatest for the latest block
+	// minus Confirmations, or chain.TagSafe or chain.TagFinalized for the
+	// block the node reports under that tag. Empty uses chain.TagLatest if
+	// Confirmations is set, else the chain's default if it implements
+	// chain.FinalityDefaulter, and chain.TagLatest otherwise. Tags require the
+	// chain to implement chain.TagReader.
+	Finality chain.BlockTag
+
+	// ReorgDepth is how many recent blocks are remembered for reorganization
+	// detection. Zero disables detection. Detection also requires the chain
+	// to implement chain.HeaderReader.
+	ReorgDepth uint64
+
+	// Retry is the strategy applied to every RPC call and to handlers
+	// registered with OnEventE. Nil disables retries; a failed cycle is then
+	// retried on the next tick.
+	Retry retry.Strategy
+
+	// StartBlock is the first block scanned when no progress has been saved;
+	// saved progress always takes precedence. Nil or StartLatest starts at the
+	// safe head.
+	StartBlock *uint64
+
+	// CatchUpBatchSize is the block window used while the watcher is behind
+	// the safe head. Catch-up queries run back to back, without waiting for
+	// the next interval. Defaults to BatchSize.
+	CatchUpBatchSize uint64
+
+	// EmptyBatches makes a poller with a batch callback deliver ranges that
+	// contain no logs, so that every scanned range is seen.
+	EmptyBatches bool
+
+	// CursorKey is the key progress is saved under. Watchers on the same chain
+	// sharing a cursor need distinct keys. Defaults to the chain ID.
+	CursorKey string
+
+	// Logger receives the watcher's logs: fetched ranges at debug level,
+	// catching up at info and reorgs at warn. Nil discards them.
+	Logger *slog.Logger
+}
+
+// startBlock resolves the block to start scanning at when there is no saved
+// progress, given the current safe head.
+func (c PollerConfig) startBlock(safe uint64) uint64 {
+	if c.StartBlock == nil || *c.StartBlock == StartLatest || *c.StartBlock > safe {
+		return safe
+	}
+	return *c.StartBlock
+}
+
+// catchUpSizer returns the range sizer used while catching up, or nil if
+// catch-up uses the regular window.
+func (c PollerConfig) catchUpSizer() *rangeSizer {
+	if c.CatchUpBatchSize == 0 || c.CatchUpBatchSize == c.BatchSize {
+		return nil
+	}
+	maxSize := c.CatchUpBatchSize
+	if c.MaxBatchSize > maxSize {
+		maxSize = c.MaxBatchSize
+	}
+	return newRangeSizer(c.CatchUpBatchSize, c.MinBatchSize, maxSize)
+}
+
+// finality resolves the finality mode for c. The chain's default only
+// applies if neither a mode nor confirmations are configured, so that
+// confirmations are never silently ignored.
+func (c PollerConfig) finality(ch chain.Chain) chain.BlockTag {
+	if c.Finality != "" {
+		return c.Finality
+	}
+	if c.Confirmations > 0 {
+		return chain.TagLatest
+	}
+	if fd, ok := ch.(chain.FinalityDefaulter); ok && fd.DefaultFinality() != "" {
+		return fd.DefaultFinality()
+	}
+	return chain.TagLatest
+}
+
+// cursorKey returns the configured cursor key, or the chain ID if none is set.
+func (c PollerConfig) cursorKey(chainID string) string {
+	if c.CursorKey != "" {
+		return c.CursorKey
+	}
+	return chainID
 }
 
 // DefaultPollerConfig returns sensible defaults for polling.
@@ -30,41 +138,85 @@ func DefaultPollerConfig() PollerConfig {
 		Interval:      2 * time.Second,
 		BatchSize:     1000,
 		Confirmations: 0,
+		ReorgDepth:    64,
 	}
 }
 
 // Poller monitors a chain by periodically fetching logs in block ranges.
+//
+// A poller that is behind the safe head, e.g. after starting from an old
+// block, catches up with back-to-back queries of CatchUpBatchSize blocks and
+// then settles into polling once per interval.
+//
+// When reorg detection is enabled, the poller remembers the hashes of recently
+// processed blocks. If a newly polled block does not build on the last
+// processed one, the logs delivered from orphaned blocks are re-delivered with
+// Removed set, the cursor is rewound to the common ancestor and the canonical
+// chain is scanned again.
 type Poller struct {
-	chain  chain.Chain
-	query  filter.Query
-	cursor cursor.Cursor
-	config PollerConfig
+	pollLoop
 
-	mu      sync.Mutex
-	onEvent func(event.Log)
-	onError func(error)
-	cancel  context.CancelFunc
-	stopped chan struct{}
+	chain   chain.Chain
+	query   filter.Query
+	headers chain.HeaderReader
+	tracker *blockTracker
+	sizer   *rangeSizer
+	catchUp *rangeSizer
+
+	// polling state, owned by the polling goroutine and guarded by the gate
+	backfills []backfill
+
+	// guarded by mu
+	onEvent func(event.Log) error
+	onBatch func(event.Batch) error
 }
 
 // NewPoller creates a polling watcher for the given chain.
 func NewPoller(c chain.Chain, query filter.Query, cur cursor.Cursor, cfg PollerConfig) *Poller {
-	return &Poller{
-		chain:   c,
-		query:   query,
-		cursor:  cur,
-		config:  cfg,
-		stopped: make(chan struct{}),
+	p := &Poller{
+		pollLoop: newPollLoop("poller", "poller started", c, cur, cfg),
+		chain:    withRetry(c, cfg.Retry),
+		query:    query,
+		sizer:    newRangeSizer(cfg.BatchSize, cfg.MinBatchSize, cfg.MaxBatchSize),
+		catchUp:  cfg.catchUpSizer(),
+	}
+	if p.catchUp == nil {
+		p.catchUp = p.sizer
+	}
+	if hr, ok := c.(chain.HeaderReader); ok && cfg.ReorgDepth > 0 {
+		p.headers = withHeaderRetry(hr, cfg.Retry)
+		p.tracker = newBlockTracker(cfg.ReorgDepth)
 	}
+	return p
 }
 
 // OnEvent registers a callback for received events.
 func (p *Poller) OnEvent(fn func(event.Log)) {
+	p.OnEventE(acked(fn))
+}
+
+// OnEventE registers a callback that acknowledges received events. A log the
+// callback fails on is retried under the retry strategy; if it still fails,
+// the cursor is saved at the last block whose logs were all acknowledged and
+// polling resumes from the failed block on the next cycle.
+func (p *Poller) OnEventE(fn func(event.Log) error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.onEvent = fn
 }
 
+// OnBatch registers a callback that receives each polled block range as one
+// batch, instead of passing logs to the OnEvent callback one at a time.
+// Ranges without logs are skipped unless EmptyBatches is set. A batch the
+// callback fails on is retried under the retry strategy; the cursor only
+// moves past a range once its batch is acknowledged. Logs undone by a reorg
+// are delivered as a batch of their own, newest first, with Removed set.
+func (p *Poller) OnBatch(fn func(event.Batch) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onBatch = fn
+}
+
 // OnError registers a callback for errors.
 func (p *Poller) OnError(fn func(error)) {
 	p.mu.Lock()
@@ -72,127 +224,344 @@ func (p *Poller) OnError(fn func(error)) {
 	p.onError = fn
 }
 
+// OnCaughtUp registers a callback invoked with the safe head each time the
+// poller reaches it after being behind, starting with the first time.
+func (p *Poller) OnCaughtUp(fn func(block uint64)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onCaughtUp = fn
+}
+
+// OnCovered registers a callback invoked with each block range the poller
+// has processed, once the cursor is saved past it, and with each completed
+// backfill window scanned with the poller's query.
+func (p *Poller) OnCovered(fn func(from, to uint64)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onCovered = fn
+}
+
 // Watch begins polling. Blocks until Stop is called or an unrecoverable error occurs.
 func (p *Poller) Watch() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	p.mu.Lock()
-	p.cancel = cancel
-	p.mu.Unlock()
+	return p.run(nil, func(ctx context.Context) error { return p.poll(ctx, &p.next) }, nil)
+}
 
-	defer close(p.stopped)
-	defer cancel()
+// UpdateQuery replaces the addresses and topics of the poller's query once
+// the cycle in progress, if any, has completed, and returns the first block
+// the new query applies to. Blocks rescanned after a reorg use the new query,
+// so the removals it delivers only cover logs the new query matches.
+func (p *Poller) UpdateQuery(q filter.Query) uint64 {
+	var boundary uint64
+	p.gate.interrupt(func() {
+		p.query = withFilter(p.query, q)
+		boundary = p.next
+	})
+	return boundary
+}
 
-	// Determine start block
-	lastBlock, err := p.cursor.Load(p.chain.ID())
-	if err != nil {
-		return fmt.Errorf("poller: load cursor: %w", err)
+// UpdateQueryKey is UpdateQuery, also saving progress under key from the
+// returned block on, with the progress saved so far carried over to it.
+func (p *Poller) UpdateQueryKey(q filter.Query, key string) (uint64, error) {
+	var (
+		boundary uint64
+		err      error
+	)
+	p.gate.interrupt(func() {
+		if err = carryProgress(p.cursor, p.key, key); err != nil {
+			err = fmt.Errorf("poller: %w", err)
+			return
+		}
+		p.key = key
+		p.query = withFilter(p.query, q)
+		boundary = p.next
+	})
+	return boundary, err
+}
+
+// Backfill scans blocks from through to with q at the start of the next
+// cycle, before polling continues. Logs are delivered to the same callbacks,
+// in windows of CatchUpBatchSize blocks, without moving the cursor or being
+// tracked for reorgs.
+func (p *Poller) Backfill(q filter.Query, from, to uint64, done func()) {
+	b := backfill{query: q, from: from, to: to, done: done}
+	if from > to {
+		b.complete()
+		return
 	}
+	p.gate.hold()
+	defer p.gate.release()
+	p.backfills = append(p.backfills, b)
+}
 
-	var fromBlock uint64
-	if lastBlock > 0 {
-		fromBlock = lastBlock + 1 // resume after last processed block
-	} else {
-		// No cursor — start from the chain's safe head so we immediately pick up events
-		latest, err := p.chain.LatestBlock(ctx)
+// runBackfills completes the pending backfills, oldest first. A backfill that
+// fails resumes from the failed window or log on the next cycle.
+func (p *Poller) runBackfills(ctx context.Context) error {
+	for len(p.backfills) > 0 {
+		b := &p.backfills[0]
+		p.log.Info("backfilling", "from_block", b.from, "to_block", b.to)
+		whole := b.covers(p.query)
+		err := b.scan(ctx, p.log, p.chain, p.catchUp, func(logs []event.Log, from, to uint64) error {
+			if p.batching() {
+				batch := event.Batch{Logs: logs, FromBlock: from, ToBlock: to}
+				if err := p.emitBatch(ctx, batch); err != nil {
+					return handlerError(from, to, fmt.Errorf("handle backfill batch [%d, %d]: %w", from, to, err))
+				}
+			} else {
+				for _, log := range logs {
+					err := ctx.Err()
+					if err == nil {
+						err = p.emitEvent(ctx, log)
+					}
+					if err != nil {
+						b.from = log.BlockNumber
+						return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("handle backfill log in block %d: %w", log.BlockNumber, err))
+					}
+				}
+			}
+			if whole {
+				p.emitCovered(from, to)
+			}
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("poller: get latest block: %w", err)
+			return err
 		}
-		if latest > p.config.Confirmations {
-			fromBlock = latest - p.config.Confirmations
+		b.complete()
+		p.backfills = p.backfills[1:]
+	}
+	return nil
+}
+
+func (p *Poller) poll(ctx context.Context, fromBlock *uint64) error {
+	if err := p.runBackfills(ctx); err != nil {
+		return err
+	}
+	safeBlock, ok, err := p.safeBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	if *fromBlock > safeBlock {
+		return nil // already caught up
+	}
+
+	if p.tracker != nil {
+		if err := p.checkReorg(ctx, fromBlock); err != nil {
+			return err
 		}
 	}
 
-	ticker := time.NewTicker(p.config.Interval)
-	defer ticker.Stop()
+	sizer := p.sizer
+	if !p.caughtUp {
+		sizer = p.catchUp
+	}
+	logs, toBlock, err := fetchRange(ctx, p.log, p.chain, p.query, sizer, *fromBlock, safeBlock)
+	if err != nil {
+		return err
+	}
 
-	// Run the first poll immediately instead of waiting for the first tick
-	if err := p.poll(ctx, &fromBlock); err != nil {
-		p.emitError(err)
+	var blocks []trackedBlock
+	if p.tracker != nil {
+		blocks, err = p.trackRange(ctx, logs, toBlock)
+		if err != nil {
+			return &RangeError{FromBlock: *fromBlock, ToBlock: toBlock, Err: fmt.Errorf("fetch logs [%d, %d]: %w", *fromBlock, toBlock, err)}
+		}
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			if err := p.poll(ctx, &fromBlock); err != nil {
-				p.emitError(err)
+	if p.batching() {
+		batch := event.Batch{Logs: logs, FromBlock: *fromBlock, ToBlock: toBlock}
+		if err := p.emitBatch(ctx, batch); err != nil {
+			return handlerError(*fromBlock, toBlock, fmt.Errorf("handle batch [%d, %d]: %w", *fromBlock, toBlock, err))
+		}
+	} else {
+		for _, log := range logs {
+			err := ctx.Err()
+			if err == nil {
+				err = p.emitEvent(ctx, log)
+			}
+			if err != nil {
+				// Blocks before this log's block are complete; resume at it.
+				if log.BlockNumber > *fromBlock {
+					if err := p.advanceBefore(ctx, blocks, log, fromBlock); err != nil {
+						return err
+					}
+				}
+				return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("handle log in block %d: %w", log.BlockNumber, err))
 			}
 		}
 	}
+
+	if err := p.advance(blocks, toBlock, fromBlock); err != nil {
+		return err
+	}
+	p.behind = toBlock < safeBlock
+	return nil
 }
 
-// Stop terminates the polling loop.
-func (p *Poller) Stop() error {
-	p.mu.Lock()
-	cancel := p.cancel
-	p.mu.Unlock()
+// advance records every block up to toBlock as processed: it tracks the given
+// blocks for reorg detection, saves the cursor and moves fromBlock past toBlock.
+func (p *Poller) advance(blocks []trackedBlock, toBlock uint64, fromBlock *uint64) error {
+	if p.tracker != nil {
+		p.tracker.add(blocks...)
+	}
+	if err := p.cursor.Save(p.key, toBlock); err != nil {
+		return cursorSaveError(err)
+	}
+	p.emitCovered(*fromBlock, toBlock)
+	*fromBlock = toBlock + 1
 
-	if cancel != nil {
-		cancel()
-		<-p.stopped
+	var at time.Time
+	if n := len(blocks); n > 0 && blocks[n-1].number == toBlock {
+		at = blocks[n-1].time
 	}
+	p.status.progress(toBlock, at)
 	return nil
 }
 
-func (p *Poller) poll(ctx context.Context, fromBlock *uint64) error {
-	latest, err := p.chain.LatestBlock(ctx)
-	if err != nil {
-		return fmt.Errorf("get latest block: %w", err)
+// advanceBefore records the blocks of a partly delivered range before the
+// block of log, whose delivery failed, as processed. With reorg detection,
+// the block right before it is tracked too, as the parent of the log's
+// block, so that the next cycle checks that the log's block still builds on
+// it. If the log's block was replaced meanwhile, nothing is recorded and the
+// range is fetched again.
+func (p *Poller) advanceBefore(ctx context.Context, blocks []trackedBlock, log event.Log, fromBlock *uint64) error {
+	before := blocksBefore(blocks, log.BlockNumber)
+	if n := len(before); p.tracker != nil && (n == 0 || before[n-1].number != log.BlockNumber-1) {
+		hdr, err := p.headers.HeaderByNumber(ctx, log.BlockNumber)
+		if err != nil || hdr.Hash != log.BlockHash {
+			return nil
+		}
+		before = append(before, trackedBlock{number: log.BlockNumber - 1, hash: hdr.ParentHash})
 	}
+	return p.advance(before, log.BlockNumber-1, fromBlock)
+}
 
-	// Apply confirmations
-	if latest <= p.config.Confirmations {
-		return nil
+// trackRange builds the tracked blocks for a fetched range, anchoring the
+// range end with its header. It fails if the logs of the last block disagree
+// with the header, which means the block was replaced while fetching.
+func (p *Poller) trackRange(ctx context.Context, logs []event.Log, toBlock uint64) ([]trackedBlock, error) {
+	tip, err := p.headers.HeaderByNumber(ctx, toBlock)
+	if err != nil {
+		return nil, fmt.Errorf("get header %d: %w", toBlock, err)
 	}
-	safeBlock := latest - p.config.Confirmations
 
-	if *fromBlock > safeBlock {
-		return nil // already caught up
+	blocks := groupByBlock(logs)
+	if n := len(blocks); n > 0 && blocks[n-1].number == toBlock {
+		if blocks[n-1].hash != tip.Hash {
+			return nil, fmt.Errorf("block %d reorganized during fetch", toBlock)
+		}
+		blocks[n-1].time = tip.Timestamp
+		return blocks, nil
 	}
+	return append(blocks, trackedBlock{number: toBlock, hash: tip.Hash, time: tip.Timestamp}), nil
+}
 
-	toBlock := *fromBlock + p.config.BatchSize - 1
-	if toBlock > safeBlock {
-		toBlock = safeBlock
+// checkReorg verifies that the next block to be polled builds on the last
+// processed one. On mismatch it undoes the orphaned blocks and rewinds
+// fromBlock to just after the common ancestor.
+func (p *Poller) checkReorg(ctx context.Context, fromBlock *uint64) error {
+	last, ok := p.tracker.last()
+	if !ok || last.number+1 != *fromBlock {
+		return nil
 	}
 
-	// Build query with block range
-	q := p.query
-	q.FromBlock = fromBlock
-	q.ToBlock = &toBlock
+	next, err := p.headers.HeaderByNumber(ctx, *fromBlock)
+	if err != nil {
+		return fmt.Errorf("get header %d: %w", *fromBlock, err)
+	}
+	if next.ParentHash == last.hash {
+		return nil
+	}
 
-	logs, err := p.chain.FetchLogs(ctx, q)
+	ancestor, found, err := p.tracker.ancestor(ctx, p.headers)
 	if err != nil {
-		return fmt.Errorf("fetch logs [%d, %d]: %w", *fromBlock, toBlock, err)
+		return fmt.Errorf("find reorg ancestor: %w", err)
+	}
+	if !found {
+		oldest := p.tracker.blocks[0].number
+		if oldest > 0 {
+			ancestor = oldest - 1
+		}
 	}
 
-	for _, log := range logs {
-		p.emitEvent(log)
+	p.log.Warn("reorg detected", "block", last.number, "ancestor", ancestor, "found", found)
+
+	// Undo orphaned logs newest first, mirroring the order they were applied
+	// in. The tracker is only rewound once every removal is acknowledged, so
+	// a failed removal is detected and delivered again on the next cycle.
+	var removed []event.Log
+	for _, b := range p.tracker.above(ancestor) {
+		for i := len(b.logs) - 1; i >= 0; i-- {
+			log := b.logs[i]
+			log.Removed = true
+			removed = append(removed, log)
+		}
+	}
+	if p.batching() {
+		batch := event.Batch{Logs: removed, FromBlock: ancestor + 1, ToBlock: last.number}
+		if err := p.emitBatch(ctx, batch); err != nil {
+			return handlerError(batch.FromBlock, batch.ToBlock, fmt.Errorf("handle removed batch [%d, %d]: %w", batch.FromBlock, batch.ToBlock, err))
+		}
+	} else {
+		for _, log := range removed {
+			if err := p.emitEvent(ctx, log); err != nil {
+				return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("handle removed log in block %d: %w", log.BlockNumber, err))
+			}
+		}
 	}
+	p.tracker.rewind(ancestor)
 
-	// Save progress
-	if err := p.cursor.Save(p.chain.ID(), toBlock); err != nil {
-		return fmt.Errorf("save cursor: %w", err)
+	if err := p.cursor.Save(p.key, ancestor); err != nil {
+		return cursorSaveError(err)
 	}
+	*fromBlock = ancestor + 1
+	p.status.progress(ancestor, time.Time{})
 
-	*fromBlock = toBlock + 1
+	if !found {
+		p.emitError(fmt.Errorf("reorg at block %d: %w", last.number, ErrReorgTooDeep))
+	}
 	return nil
 }
 
-func (p *Poller) emitEvent(log event.Log) {
+func (p *Poller) emitEvent(ctx context.Context, log event.Log) error {
 	p.mu.Lock()
 	fn := p.onEvent
 	p.mu.Unlock()
-	if fn != nil {
-		fn(log)
+	if err := handle(ctx, p.config.Retry, fn, log); err != nil {
+		return err
 	}
+	p.status.delivered(1)
+	return nil
+}
+
+// batching reports whether logs are delivered in batches.
+func (p *Poller) batching() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.onBatch != nil
 }
 
-func (p *Poller) emitError(err error) {
+// emitBatch passes batch to the batch callback, retrying under the retry
+// strategy while it fails. Empty batches are skipped unless EmptyBatches is set.
+func (p *Poller) emitBatch(ctx context.Context, batch event.Batch) error {
+	if batch.IsEmpty() && !p.config.EmptyBatches {
+		return nil
+	}
 	p.mu.Lock()
-	fn := p.onError
+	fn := p.onBatch
 	p.mu.Unlock()
-	if fn != nil {
-		fn(err)
+	if fn == nil {
+		return nil
+	}
+	err := retry.Do(ctx, p.config.Retry, func(context.Context) error {
+		return fn(batch)
+	})
+	if err != nil {
+		return err
 	}
+	p.status.delivered(batch.Len())
+	return nil
 }
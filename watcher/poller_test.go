@@ -0,0 +1,258 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// forkChain is a chain of blocks 0 through head with logs in some of them.
+// A reorg replaces blocks from a height on with blocks of another fork.
+type forkChain struct {
+	mu    sync.Mutex
+	forks []byte // fork of each block, by number
+	logs  map[uint64]bool
+}
+
+func newForkChain(head uint64, logBlocks ...uint64) *forkChain {
+	c := &forkChain{forks: make([]byte, head+1), logs: make(map[uint64]bool)}
+	for _, n := range logBlocks {
+		c.logs[n] = true
+	}
+	return c
+}
+
+// reorg replaces the blocks from block from on with blocks of fork, with
+// logs in logBlocks.
+func (c *forkChain) reorg(from uint64, fork byte, logBlocks ...uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n := from; n < uint64(len(c.forks)); n++ {
+		c.forks[n] = fork
+		delete(c.logs, n)
+	}
+	for _, n := range logBlocks {
+		c.logs[n] = true
+	}
+}
+
+// extend adds blocks without logs up to head, on the fork of the current
+// head.
+func (c *forkChain) extend(head uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fork := c.forks[len(c.forks)-1]
+	for uint64(len(c.forks)) <= head {
+		c.forks = append(c.forks, fork)
+	}
+}
+
+func (c *forkChain) header(n uint64) *chain.Header {
+	h := &chain.Header{Number: n, Hash: blockHash(n, c.forks[n])}
+	if n > 0 {
+		h.ParentHash = blockHash(n-1, c.forks[n-1])
+	}
+	return h
+}
+
+func (c *forkChain) ID() string { return "test" }
+
+func (c *forkChain) LatestBlock(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint64(len(c.forks) - 1), nil
+}
+
+func (c *forkChain) FetchLogs(ctx context.Context, q filter.Query) ([]event.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var logs []event.Log
+	for n := *q.FromBlock; n <= *q.ToBlock; n++ {
+		if c.logs[n] {
+			logs = append(logs, event.Log{BlockNumber: n, BlockHash: c.header(n).Hash})
+		}
+	}
+	return logs, nil
+}
+
+func (c *forkChain) Subscribe(ctx context.Context, q filter.Query) (chain.Subscription, error) {
+	return nil, errors.New("test: not supported")
+}
+
+func (c *forkChain) HeaderByNumber(ctx context.Context, n uint64) (*chain.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.header(n), nil
+}
+
+// delivery is a log as delivered to a handler.
+type delivery struct {
+	block   uint64
+	removed bool
+}
+
+// runPoller polls c from block 1 until stop reports true for the
+// deliveries so far, or fails the test after a few seconds.
+func runPoller(t *testing.T, p *Poller, stop func([]delivery) bool) []delivery {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		got  []delivery
+		done = make(chan struct{})
+	)
+	handler := p.onEvent
+	p.OnEventE(func(log event.Log) error {
+		if handler != nil {
+			if err := handler(log); err != nil {
+				return err
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, delivery{block: log.BlockNumber, removed: log.Removed})
+		if stop(got) {
+			select {
+			case <-done:
+			default:
+				close(done)
+			}
+		}
+		return nil
+	})
+	exited := make(chan error, 1)
+	go func() { exited <- p.Watch() }()
+
+	select {
+	case <-done:
+	case err := <-exited:
+		t.Fatalf("Watch returned %v", err)
+	case <-time.After(5 * time.Second):
+		mu.Lock()
+		t.Fatalf("timed out with deliveries %v", got)
+	}
+	p.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Clone(got)
+}
+
+func testPoller(c chain.Chain) *Poller {
+	start := uint64(1)
+	cfg := DefaultPollerConfig()
+	cfg.Interval = time.Millisecond
+	cfg.StartBlock = &start
+	return NewPoller(c, filter.Query{}, cursor.NewMemory(), cfg)
+}
+
+func TestPollerReorg(t *testing.T) {
+	c := newForkChain(10, 3, 8)
+	p := testPoller(c)
+
+	reorged := false
+	p.OnCaughtUp(func(uint64) {
+		if !reorged {
+			reorged = true
+			c.reorg(5, 1, 6, 8)
+			c.extend(11)
+		}
+	})
+	got := runPoller(t, p, func(got []delivery) bool { return len(got) == 5 })
+
+	want := []delivery{{block: 3}, {block: 8}, {block: 8, removed: true}, {block: 6}, {block: 8}}
+	if !slices.Equal(got, want) {
+		t.Errorf("deliveries %v, want %v", got, want)
+	}
+}
+
+func TestPollerReorgAfterPartialAdvance(t *testing.T) {
+	// Blocks 4 through 7 have no logs, so that the last block with logs
+	// before the failed one is not its parent.
+	c := newForkChain(10, 3, 8)
+	p := testPoller(c)
+
+	failed := false
+	p.OnEventE(func(log event.Log) error {
+		if log.BlockNumber == 8 && !failed {
+			failed = true
+			return errors.New("handler down")
+		}
+		return nil
+	})
+	// The reorg happens after the poller recorded blocks up to 7 and before
+	// it polls again; it adds a log to block 6.
+	p.OnError(func(error) { c.reorg(5, 1, 6, 8) })
+
+	got := runPoller(t, p, func(got []delivery) bool { return len(got) == 3 })
+	want := []delivery{{block: 3}, {block: 6}, {block: 8}}
+	if !slices.Equal(got, want) {
+		t.Errorf("deliveries %v, want %v", got, want)
+	}
+}
+
+// failingCursor is a cursor whose saves fail.
+type failingCursor struct {
+	cursor.Cursor
+}
+
+func (c failingCursor) Save(key string, block uint64) error {
+	return errors.New("disk full")
+}
+
+func TestPollerCursorSaveFails(t *testing.T) {
+	start := uint64(1)
+	cfg := DefaultPollerConfig()
+	cfg.Interval = time.Millisecond
+	cfg.StartBlock = &start
+	p := NewPoller(newForkChain(5), filter.Query{}, failingCursor{cursor.NewMemory()}, cfg)
+
+	errs := make(chan error, 10)
+	p.OnError(func(err error) { errs <- err })
+	done := make(chan error, 1)
+	go func() { done <- p.Watch() }()
+	defer func() {
+		p.Stop()
+		<-done
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrCursorSave) {
+			t.Errorf("reported %v, want an error wrapping ErrCursorSave", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cursor save failure not reported")
+	}
+}
+
+func TestPollerUpdateQueryKey(t *testing.T) {
+	cur := cursor.NewMemory()
+	cur.Save("old", 7)
+	cfg := DefaultPollerConfig()
+	cfg.CursorKey = "old"
+	q := filter.Query{Addresses: []event.Address{{1}}}
+
+	p := NewPoller(newForkChain(10), filter.Query{}, cur, cfg)
+	if _, err := p.UpdateQueryKey(q, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cur.Load("new"); got != 7 || p.key != "new" {
+		t.Errorf("progress under the new key = %d, key %s; want 7 under new", got, p.key)
+	}
+
+	// A key the progress cannot be carried over to leaves the poller as it was.
+	f := NewPoller(newForkChain(10), filter.Query{}, failingCursor{cur}, cfg)
+	if _, err := f.UpdateQueryKey(q, "other"); !errors.Is(err, ErrCursorSave) {
+		t.Errorf("UpdateQueryKey = %v, want an error wrapping ErrCursorSave", err)
+	}
+	if f.key != "old" || len(f.query.Addresses) != 0 {
+		t.Errorf("key %s, addresses %v after a failed update; want old and none", f.key, f.query.Addresses)
+	}
+}
@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+)
+
+// ErrReorgTooDeep is reported when a chain reorganization reaches below the
+// oldest block the watcher still remembers. The watcher rewinds as far as it
+// can; logs from forgotten blocks cannot be marked as removed.
+var ErrReorgTooDeep = errors.New("watcher: reorg deeper than tracked history")
+
+// trackedBlock is a processed block together with the logs delivered from it.
+type trackedBlock struct {
+	number uint64
+	hash   event.Hash
+	time   time.Time // zero if unknown
+	logs   []event.Log
+	header *chain.Header // set by BlockWatcher
+}
+
+// blockTracker remembers recently processed blocks so that a reorganization
+// can be detected and the affected logs re-delivered as removed.
+// Blocks are kept in ascending order; only blocks that delivered logs and the
+// last block of each processed range are recorded.
+type blockTracker struct {
+	depth  uint64
+	blocks []trackedBlock
+}
+
+func newBlockTracker(depth uint64) *blockTracker {
+	return &blockTracker{depth: depth}
+}
+
+// add records processed blocks and evicts those that fell out of the window.
+// At least one block at or below the window boundary is retained so that the
+// common ancestor of a reorg at full depth can still be found.
+func (t *blockTracker) add(blocks ...trackedBlock) {
+	t.blocks = append(t.blocks, blocks...)
+	if len(t.blocks) == 0 {
+		return
+	}
+
+	tip := t.blocks[len(t.blocks)-1].number
+	if tip <= t.depth {
+		return
+	}
+	boundary := tip - t.depth
+
+	keep := 0
+	for i, b := range t.blocks {
+		if b.number <= boundary {
+			keep = i
+		}
+	}
+	t.blocks = t.blocks[keep:]
+}
+
+// last returns the most recently processed block.
+func (t *blockTracker) last() (trackedBlock, bool) {
+	if len(t.blocks) == 0 {
+		return trackedBlock{}, false
+	}
+	return t.blocks[len(t.blocks)-1], true
+}
+
+// above returns the blocks above number, newest first.
+func (t *blockTracker) above(number uint64) []trackedBlock {
+	i := t.index(number)
+	blocks := make([]trackedBlock, 0, len(t.blocks)-i)
+	for j := len(t.blocks) - 1; j >= i; j-- {
+		blocks = append(blocks, t.blocks[j])
+	}
+	return blocks
+}
+
+// rewind forgets every block above number.
+func (t *blockTracker) rewind(number uint64) {
+	t.blocks = t.blocks[:t.index(number)]
+}
+
+// index returns the position of the first block above number.
+func (t *blockTracker) index(number uint64) int {
+	i := len(t.blocks)
+	for i > 0 && t.blocks[i-1].number > number {
+		i--
+	}
+	return i
+}
+
+// ancestor finds the newest tracked block that is still canonical.
+// Canonicity is monotonic (every block below a canonical block is canonical),
+// so the search needs only a logarithmic number of header lookups.
+// ok is false when none of the tracked blocks is canonical.
+func (t *blockTracker) ancestor(ctx context.Context, headers chain.HeaderReader) (number uint64, ok bool, err error) {
+	lo, hi := 0, len(t.blocks) // invariant: blocks[:lo] canonical, blocks[hi:] not
+	for lo < hi {
+		mid := (lo + hi) / 2
+		b := t.blocks[mid]
+		h, err := headers.HeaderByNumber(ctx, b.number)
+		if err != nil {
+			return 0, false, fmt.Errorf("get header %d: %w", b.number, err)
+		}
+		if h.Hash == b.hash {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return 0, false, nil
+	}
+	return t.blocks[lo-1].number, true, nil
+}
+
+// blocksBefore returns the leading blocks numbered below number.
+func blocksBefore(blocks []trackedBlock, number uint64) []trackedBlock {
+	i := 0
+	for i < len(blocks) && blocks[i].number < number {
+		i++
+	}
+	return blocks[:i]
+}
+
+// groupByBlock splits logs into tracked blocks, preserving their order.
+func groupByBlock(logs []event.Log) []trackedBlock {
+	var blocks []trackedBlock
+	for _, log := range logs {
+		n := len(blocks)
+		if n > 0 && blocks[n-1].number == log.BlockNumber {
+			blocks[n-1].logs = append(blocks[n-1].logs, log)
+			continue
+		}
+		blocks = append(blocks, trackedBlock{
+			number: log.BlockNumber,
+			hash:   log.BlockHash,
+			time:   log.Timestamp,
+			logs:   []event.Log{log},
+		})
+	}
+	return blocks
+}
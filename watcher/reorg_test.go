@@ -0,0 +1,152 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+)
+
+// headerChain serves canonical headers whose hash is the block number plus
+// fork, where fork is nonzero from block forkAt onwards. It counts lookups.
+type headerChain struct {
+	forkAt  uint64 // 0 for no fork
+	fork    byte
+	err     error
+	lookups int
+}
+
+func (c *headerChain) HeaderByNumber(ctx context.Context, number uint64) (*chain.Header, error) {
+	c.lookups++
+	if c.err != nil {
+		return nil, c.err
+	}
+	var fork byte
+	if c.forkAt != 0 && number >= c.forkAt {
+		fork = c.fork
+	}
+	return &chain.Header{Number: number, Hash: blockHash(number, fork)}, nil
+}
+
+func blockHash(number uint64, fork byte) event.Hash {
+	var h event.Hash
+	h[0] = fork
+	h[31] = byte(number)
+	h[30] = byte(number >> 8)
+	return h
+}
+
+// trackBlocks returns a tracker holding the given blocks of the original
+// chain.
+func trackBlocks(numbers ...uint64) *blockTracker {
+	t := newBlockTracker(1000)
+	for _, n := range numbers {
+		t.add(trackedBlock{number: n, hash: blockHash(n, 0)})
+	}
+	return t
+}
+
+func TestBlockTrackerAncestor(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocks  []uint64
+		forkAt  uint64
+		want    uint64
+		wantOK  bool
+		maxLook int
+	}{
+		{name: "empty", blocks: nil, forkAt: 5, wantOK: false},
+		{name: "no reorg", blocks: []uint64{10, 11, 12, 13}, want: 13, wantOK: true, maxLook: 3},
+		{name: "tip replaced", blocks: []uint64{10, 11, 12, 13}, forkAt: 13, want: 12, wantOK: true},
+		{name: "fork between tracked blocks", blocks: []uint64{10, 14, 20, 25}, forkAt: 17, want: 14, wantOK: true},
+		{name: "fork at tracked block", blocks: []uint64{10, 14, 20, 25}, forkAt: 14, want: 10, wantOK: true},
+		{name: "all replaced", blocks: []uint64{10, 11, 12}, forkAt: 10, wantOK: false},
+		{name: "fork below window", blocks: []uint64{10, 11, 12}, forkAt: 3, wantOK: false},
+		{name: "single canonical block", blocks: []uint64{7}, want: 7, wantOK: true},
+		{
+			name:    "long history",
+			blocks:  []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32},
+			forkAt:  30,
+			want:    29,
+			wantOK:  true,
+			maxLook: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := trackBlocks(tt.blocks...)
+			headers := &headerChain{forkAt: tt.forkAt, fork: 1}
+
+			got, ok, err := tracker.ancestor(context.Background(), headers)
+			if err != nil {
+				t.Fatalf("ancestor: %v", err)
+			}
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ancestor = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+			if tt.maxLook > 0 && headers.lookups > tt.maxLook {
+				t.Errorf("ancestor made %d header lookups, want at most %d", headers.lookups, tt.maxLook)
+			}
+		})
+	}
+}
+
+func TestBlockTrackerAncestorError(t *testing.T) {
+	errDown := errors.New("node down")
+	tracker := trackBlocks(1, 2, 3)
+
+	_, _, err := tracker.ancestor(context.Background(), &headerChain{err: errDown})
+	if !errors.Is(err, errDown) {
+		t.Fatalf("ancestor error = %v, want %v", err, errDown)
+	}
+}
+
+func TestBlockTrackerAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		depth  uint64
+		blocks []uint64
+		want   []uint64
+	}{
+		{name: "within depth", depth: 10, blocks: []uint64{1, 5, 9}, want: []uint64{1, 5, 9}},
+		{name: "evicts old blocks", depth: 3, blocks: []uint64{1, 2, 3, 4, 5, 6}, want: []uint64{3, 4, 5, 6}},
+		{name: "keeps one block at the boundary", depth: 5, blocks: []uint64{2, 4, 20}, want: []uint64{4, 20}},
+		{name: "boundary block tracked", depth: 5, blocks: []uint64{10, 15, 20}, want: []uint64{15, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newBlockTracker(tt.depth)
+			for _, n := range tt.blocks {
+				tracker.add(trackedBlock{number: n})
+			}
+
+			var got []uint64
+			for _, b := range tracker.blocks {
+				got = append(got, b.number)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tracked blocks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockTrackerRewind(t *testing.T) {
+	tracker := trackBlocks(10, 12, 14, 16)
+
+	var above []uint64
+	for _, b := range tracker.above(12) {
+		above = append(above, b.number)
+	}
+	if want := []uint64{16, 14}; !slices.Equal(above, want) {
+		t.Fatalf("above(12) = %v, want %v", above, want)
+	}
+
+	tracker.rewind(13)
+	if last, ok := tracker.last(); !ok || last.number != 12 {
+		t.Errorf("last after rewind(13) = %d, %v; want 12, true", last.number, ok)
+	}
+}
@@ -2,44 +2,99 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/retry"
 )
 
+// ReplayConfig configures a Replay.
+type ReplayConfig struct {
+	// BatchSize is the number of blocks to query per request. Defaults to 2000.
+	// Ranges rejected by the provider as too large are bisected, and the window
+	// grows back after successful queries, within [MinBatchSize, MaxBatchSize].
+	BatchSize uint64
+
+	// MinBatchSize is the smallest window the replay shrinks to. Defaults to 1.
+	MinBatchSize uint64
+
+	// MaxBatchSize is the largest window the replay grows to. Defaults to BatchSize.
+	MaxBatchSize uint64
+
+	// Retry is the strategy applied to every RPC call and to handlers
+	// registered with OnEventE. Nil disables retries.
+	Retry retry.Strategy
+
+	// Interval is the initial wait before re-fetching a range rejected by an
+	// open circuit breaker. Defaults to 2s.
+	Interval time.Duration
+
+	// Logger receives the replay's logs, e.g. each fetched range at debug
+	// level. Nil discards them.
+	Logger *slog.Logger
+}
+
 // Replay fetches historical event logs for a specific block range.
 // Unlike Poller, it runs once and completes—useful for backfilling data.
+// A range that still fails after retries stops the replay with an error
+// instead of being skipped.
 type Replay struct {
-	chain     chain.Chain
-	query     filter.Query
-	batchSize uint64
-
-	mu      sync.Mutex
-	onEvent func(event.Log)
-	onError func(error)
-	cancel  context.CancelFunc
-	stopped chan struct{}
+	chain    chain.Chain
+	query    filter.Query
+	sizer    *rangeSizer
+	retry    retry.Strategy
+	interval time.Duration
+	log      *slog.Logger
+
+	mu        sync.Mutex
+	onEvent   func(event.Log) error
+	onError   func(error)
+	onCovered func(from, to uint64)
+	cancel    context.CancelFunc
+	stopped   chan struct{}
+	halted    bool // Stop was called before Watch
 }
 
 // NewReplay creates a replay watcher that scans a fixed block range.
 // The query must have FromBlock and ToBlock set.
 func NewReplay(c chain.Chain, query filter.Query, batchSize uint64) *Replay {
-	if batchSize == 0 {
-		batchSize = 2000
+	return NewReplayWithConfig(c, query, ReplayConfig{BatchSize: batchSize})
+}
+
+// NewReplayWithConfig creates a replay watcher with the given configuration.
+// The query must have FromBlock and ToBlock set.
+func NewReplayWithConfig(c chain.Chain, query filter.Query, cfg ReplayConfig) *Replay {
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 2000
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = 2 * time.Second
 	}
 	return &Replay{
-		chain:     c,
-		query:     query,
-		batchSize: batchSize,
-		stopped:   make(chan struct{}),
+		chain:    withRetry(c, cfg.Retry),
+		query:    query,
+		sizer:    newRangeSizer(cfg.BatchSize, cfg.MinBatchSize, cfg.MaxBatchSize),
+		retry:    cfg.Retry,
+		interval: cfg.Interval,
+		log:      orDiscard(cfg.Logger),
+		stopped:  make(chan struct{}),
 	}
 }
 
 // OnEvent registers a callback for received events.
 func (r *Replay) OnEvent(fn func(event.Log)) {
+	r.OnEventE(acked(fn))
+}
+
+// OnEventE registers a callback that acknowledges received events. A log the
+// callback still fails on after retries stops the replay with an error.
+func (r *Replay) OnEventE(fn func(event.Log) error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.onEvent = fn
@@ -52,22 +107,42 @@ func (r *Replay) OnError(fn func(error)) {
 	r.onError = fn
 }
 
-// Watch replays historical events. Completes when the entire range is scanned.
+// OnCovered registers a callback invoked with each range the replay has
+// completed, including the blocks before a log the replay failed on.
+func (r *Replay) OnCovered(fn func(from, to uint64)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCovered = fn
+}
+
+// Watch replays historical events. Completes when the entire range is scanned,
+// or returns an error naming the first range that could not be fetched.
 func (r *Replay) Watch() error {
-	ctx, cancel := context.WithCancel(context.Background())
+	return r.WatchContext(context.Background())
+}
+
+// WatchContext is like Watch but also stops when ctx is cancelled.
+func (r *Replay) WatchContext(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
 	r.mu.Lock()
 	r.cancel = cancel
+	halted := r.halted
 	r.mu.Unlock()
 
 	defer close(r.stopped)
 	defer cancel()
 
+	if halted {
+		return nil
+	}
 	if r.query.FromBlock == nil || r.query.ToBlock == nil {
 		return fmt.Errorf("replay: both FromBlock and ToBlock must be set")
 	}
 
 	from := *r.query.FromBlock
 	to := *r.query.ToBlock
+	backoff := expBackoff{base: r.interval}
+	r.log.Info("replay started", "from_block", from, "to_block", to)
 
 	for from <= to {
 		select {
@@ -76,29 +151,44 @@ func (r *Replay) Watch() error {
 		default:
 		}
 
-		batchEnd := from + r.batchSize - 1
-		if batchEnd > to {
-			batchEnd = to
+		logs, batchEnd, err := fetchRange(ctx, r.log, r.chain, r.query, r.sizer, from, to)
+		if errors.Is(err, retry.ErrCircuitOpen) {
+			// Wait for the endpoint to recover instead of abandoning the range.
+			if backoff.streak == 0 {
+				r.emitError(err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff.next()):
+			}
+			continue
 		}
-
-		q := r.query
-		q.FromBlock = &from
-		q.ToBlock = &batchEnd
-
-		logs, err := r.chain.FetchLogs(ctx, q)
 		if err != nil {
-			r.emitError(fmt.Errorf("fetch logs [%d, %d]: %w", from, batchEnd, err))
-			from = batchEnd + 1
-			continue
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("replay: %w", err)
 		}
+		backoff.reset()
 
 		for _, log := range logs {
-			r.emitEvent(log)
+			if err := r.emitEvent(ctx, log); err != nil {
+				if log.BlockNumber > from {
+					r.emitCovered(from, log.BlockNumber-1)
+				}
+				if ctx.Err() != nil {
+					return nil
+				}
+				return handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("replay: handle log in block %d: %w", log.BlockNumber, err))
+			}
 		}
 
+		r.emitCovered(from, batchEnd)
 		from = batchEnd + 1
 	}
 
+	r.log.Info("replay complete", "from_block", *r.query.FromBlock, "to_block", to)
 	return nil
 }
 
@@ -106,6 +196,7 @@ func (r *Replay) Watch() error {
 func (r *Replay) Stop() error {
 	r.mu.Lock()
 	cancel := r.cancel
+	r.halted = cancel == nil
 	r.mu.Unlock()
 
 	if cancel != nil {
@@ -115,12 +206,19 @@ func (r *Replay) Stop() error {
 	return nil
 }
 
-func (r *Replay) emitEvent(log event.Log) {
+func (r *Replay) emitEvent(ctx context.Context, log event.Log) error {
 	r.mu.Lock()
 	fn := r.onEvent
 	r.mu.Unlock()
+	return handle(ctx, r.retry, fn, log)
+}
+
+func (r *Replay) emitCovered(from, to uint64) {
+	r.mu.Lock()
+	fn := r.onCovered
+	r.mu.Unlock()
 	if fn != nil {
-		fn(log)
+		fn(from, to)
 	}
 }
 
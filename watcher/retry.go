@@ -0,0 +1,155 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+	"github.com/hedeqiang/sonar/retry"
+)
+
+// retryChain routes the RPC calls a watcher makes through a retry strategy.
+type retryChain struct {
+	chain.Chain
+	strategy retry.Strategy
+}
+
+// withRetry wraps c so that its calls are retried with strategy.
+// A nil strategy returns c unchanged.
+func withRetry(c chain.Chain, strategy retry.Strategy) chain.Chain {
+	if strategy == nil {
+		return c
+	}
+	return &retryChain{Chain: c, strategy: strategy}
+}
+
+func (r *retryChain) LatestBlock(ctx context.Context) (uint64, error) {
+	var latest uint64
+	err := retry.Do(ctx, r.strategy, func(ctx context.Context) error {
+		var err error
+		latest, err = r.Chain.LatestBlock(ctx)
+		return err
+	})
+	return latest, err
+}
+
+func (r *retryChain) FetchLogs(ctx context.Context, query filter.Query) ([]event.Log, error) {
+	var logs []event.Log
+	err := retry.Do(ctx, r.strategy, func(ctx context.Context) error {
+		var err error
+		logs, err = r.Chain.FetchLogs(ctx, query)
+		if errors.Is(err, chain.ErrRangeTooLarge) {
+			return retry.Permanent(err) // the same range will fail again
+		}
+		return err
+	})
+	return logs, err
+}
+
+// retryHeaders is the chain.HeaderReader counterpart of retryChain.
+type retryHeaders struct {
+	chain.HeaderReader
+	strategy retry.Strategy
+}
+
+func withHeaderRetry(hr chain.HeaderReader, strategy retry.Strategy) chain.HeaderReader {
+	if strategy == nil {
+		return hr
+	}
+	return &retryHeaders{HeaderReader: hr, strategy: strategy}
+}
+
+func (r *retryHeaders) HeaderByNumber(ctx context.Context, number uint64) (*chain.Header, error) {
+	var h *chain.Header
+	err := retry.Do(ctx, r.strategy, func(ctx context.Context) error {
+		var err error
+		h, err = r.HeaderReader.HeaderByNumber(ctx, number)
+		return err
+	})
+	return h, err
+}
+
+// retryHeaderRanges is the chain.HeaderRangeReader counterpart of retryChain.
+type retryHeaderRanges struct {
+	chain.HeaderRangeReader
+	strategy retry.Strategy
+}
+
+func withHeaderRangeRetry(hr chain.HeaderRangeReader, strategy retry.Strategy) chain.HeaderRangeReader {
+	if strategy == nil {
+		return hr
+	}
+	return &retryHeaderRanges{HeaderRangeReader: hr, strategy: strategy}
+}
+
+func (r *retryHeaderRanges) HeadersByRange(ctx context.Context, from, to uint64) ([]*chain.Header, error) {
+	var hs []*chain.Header
+	err := retry.Do(ctx, r.strategy, func(ctx context.Context) error {
+		var err error
+		hs, err = r.HeaderRangeReader.HeadersByRange(ctx, from, to)
+		return err
+	})
+	return hs, err
+}
+
+// retryTags is the chain.TagReader counterpart of retryChain.
+type retryTags struct {
+	chain.TagReader
+	strategy retry.Strategy
+}
+
+func withTagRetry(tr chain.TagReader, strategy retry.Strategy) chain.TagReader {
+	if strategy == nil {
+		return tr
+	}
+	return &retryTags{TagReader: tr, strategy: strategy}
+}
+
+func (r *retryTags) HeaderByTag(ctx context.Context, tag chain.BlockTag) (*chain.Header, error) {
+	var h *chain.Header
+	err := retry.Do(ctx, r.strategy, func(ctx context.Context) error {
+		var err error
+		h, err = r.TagReader.HeaderByTag(ctx, tag)
+		if errors.Is(err, chain.ErrTagUnsupported) {
+			return retry.Permanent(err) // the node will not learn the tag
+		}
+		return err
+	})
+	return h, err
+}
+
+// maxBackoff caps how long a watcher idles between attempts against an
+// unavailable endpoint, unless the base interval is already longer.
+const maxBackoff = time.Minute
+
+// expBackoff spaces out attempts against an unavailable endpoint (an open
+// circuit breaker, a dropped subscription), doubling the wait each time.
+type expBackoff struct {
+	base   time.Duration
+	streak int
+}
+
+// next records a failed attempt and returns how long to wait before the next one.
+func (b *expBackoff) next() time.Duration {
+	b.streak++
+	limit := maxBackoff
+	if b.base > limit {
+		limit = b.base
+	}
+	d := b.base
+	for i := 1; i < b.streak && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// reset clears the failure streak after a successful attempt.
+func (b *expBackoff) reset() {
+	b.streak = 0
+}
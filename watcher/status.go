@@ -0,0 +1,166 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a watcher.
+type State int
+
+const (
+	// StateStarting is the state before the watcher has completed a cycle.
+	StateStarting State = iota
+	// StateCatchingUp means the watcher is behind the safe head.
+	StateCatchingUp
+	// StateLive means the watcher has caught up and follows the chain.
+	StateLive
+	// StateStopped means Watch returned after Stop.
+	StateStopped
+	// StateFailed means Watch returned with an unrecoverable error.
+	StateFailed
+	// StatePaused means the watcher was paused and delivers nothing until
+	// it is resumed.
+	StatePaused
+)
+
+// String returns the lower-case name of the state.
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateCatchingUp:
+		return "catching-up"
+	case StateLive:
+		return "live"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	case StatePaused:
+		return "paused"
+	default:
+		return "unknown"
+	}
+}
+
+// Status is a snapshot of a watcher's progress.
+type Status struct {
+	State State
+
+	// Head is the latest block number last seen on the chain.
+	Head uint64
+
+	// SafeHead is the newest block the watcher may process, given its
+	// finality mode. Streaming watchers report the head.
+	SafeHead uint64
+
+	// Cursor is the last block whose logs have all been delivered. Zero if
+	// none has been, or if the watcher does not track progress.
+	Cursor uint64
+
+	// CursorTime is the timestamp of the cursor block, if known.
+	CursorTime time.Time
+
+	// Delivered is the number of logs the handler acknowledged.
+	Delivered uint64
+
+	// LastError is the most recent error reported by the watcher, and
+	// LastErrorAt the time it was reported.
+	LastError   error
+	LastErrorAt time.Time
+}
+
+// Lag returns the number of blocks between the cursor and the head.
+func (s Status) Lag() uint64 {
+	if s.Cursor >= s.Head {
+		return 0
+	}
+	return s.Head - s.Cursor
+}
+
+// StatusReporter is implemented by watchers that report their progress.
+type StatusReporter interface {
+	Status() Status
+}
+
+// statusTracker records a watcher's Status. It is safe for concurrent use.
+type statusTracker struct {
+	mu sync.Mutex
+	s  Status
+}
+
+func (t *statusTracker) get() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.s
+}
+
+func (t *statusTracker) setState(state State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.State = state
+}
+
+// heads records the latest and safe block numbers.
+func (t *statusTracker) heads(head, safe uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.Head = head
+	t.s.SafeHead = safe
+}
+
+// observed raises the head and safe head to block, for watchers that
+// deliver logs as soon as they are streamed.
+func (t *statusTracker) observed(block uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if block > t.s.Head {
+		t.s.Head = block
+	}
+	if block > t.s.SafeHead {
+		t.s.SafeHead = block
+	}
+}
+
+// progress records the cursor block and its timestamp, if known.
+func (t *statusTracker) progress(block uint64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.Cursor = block
+	t.s.CursorTime = at
+}
+
+// delivered counts n acknowledged logs.
+func (t *statusTracker) delivered(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.Delivered += uint64(n)
+}
+
+// failed records err as the last error.
+func (t *statusTracker) failed(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.s.LastError = err
+	t.s.LastErrorAt = time.Now()
+}
+
+// paused records that the watcher was paused, unless it has exited.
+func (t *statusTracker) paused() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.s.State != StateStopped && t.s.State != StateFailed {
+		t.s.State = StatePaused
+	}
+}
+
+// exited records the outcome of Watch.
+func (t *statusTracker) exited(err error) {
+	if err != nil {
+		t.failed(err)
+		t.setState(StateFailed)
+		return
+	}
+	t.setState(StateStopped)
+}
@@ -3,23 +3,37 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/hedeqiang/sonar/chain"
 	"github.com/hedeqiang/sonar/event"
 	"github.com/hedeqiang/sonar/filter"
 )
 
-// Streamer monitors a chain via WebSocket subscriptions for real-time event delivery.
+// resubscribeInterval is how long a streamer waits before subscribing again
+// after its subscription ended, doubled after every failed attempt.
+const resubscribeInterval = time.Second
+
+// Streamer monitors a chain via WebSocket subscriptions for real-time event
+// delivery. When a subscription ends, e.g. because the connection dropped,
+// the error is reported and the streamer subscribes again with a growing
+// backoff. Logs emitted meanwhile are not delivered.
 type Streamer struct {
-	chain chain.Chain
-	query filter.Query
+	chain   chain.Chain
+	query   filter.Query
+	log     *slog.Logger
+	status  statusTracker
+	gate    gate
+	backoff expBackoff
 
 	mu      sync.Mutex
-	onEvent func(event.Log)
+	onEvent func(event.Log) error
 	onError func(error)
 	cancel  context.CancelFunc
 	stopped chan struct{}
+	halted  bool // Stop was called before Watch
 }
 
 // NewStreamer creates a streaming watcher for the given chain.
@@ -27,12 +41,27 @@ func NewStreamer(c chain.Chain, query filter.Query) *Streamer {
 	return &Streamer{
 		chain:   c,
 		query:   query,
+		log:     orDiscard(nil),
+		backoff: expBackoff{base: resubscribeInterval},
 		stopped: make(chan struct{}),
 	}
 }
 
+// SetLogger sets the logger the streamer reports its subscription to.
+// Must be called before Watch.
+func (s *Streamer) SetLogger(l *slog.Logger) {
+	s.log = orDiscard(l)
+}
+
 // OnEvent registers a callback for received events.
 func (s *Streamer) OnEvent(fn func(event.Log)) {
+	s.OnEventE(acked(fn))
+}
+
+// OnEventE registers a callback that acknowledges received events. The
+// streamer does not track progress, so errors are only reported through
+// OnError.
+func (s *Streamer) OnEventE(fn func(event.Log) error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.onEvent = fn
@@ -45,44 +74,135 @@ func (s *Streamer) OnError(fn func(error)) {
 	s.onError = fn
 }
 
-// Watch starts the streaming subscription. Blocks until Stop is called.
-func (s *Streamer) Watch() error {
+// Status returns a snapshot of the streamer's progress. The head is the
+// newest block a log was received from; the cursor is not tracked.
+func (s *Streamer) Status() Status {
+	return s.status.get()
+}
+
+// Watch starts the streaming subscription. Blocks until Stop is called. It
+// returns an error if the first subscription cannot be made, e.g. because
+// the endpoint does not support subscriptions; later ones are retried.
+func (s *Streamer) Watch() (err error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.mu.Lock()
 	s.cancel = cancel
+	halted := s.halted
 	s.mu.Unlock()
 
 	defer close(s.stopped)
+	defer func() { s.status.exited(err) }()
 	defer cancel()
 
+	if halted {
+		return nil
+	}
+	subscribed := false
+	for {
+		pausing, ok := s.gate.enter()
+		if !ok {
+			s.status.paused()
+			if !s.gate.wait(ctx, nil, nil) {
+				return nil
+			}
+			continue
+		}
+		sctx, cancelSession := cancelOnPause(ctx, pausing)
+		ok, err := s.session(sctx)
+		subscribed = subscribed || ok
+		interrupted := sctx.Err() != nil
+		cancelSession()
+		s.gate.leave()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if interrupted {
+			continue // paused or interrupted
+		}
+		if !subscribed {
+			return err
+		}
+		s.status.setState(StateStarting)
+		s.emitError(err)
+		wait := s.backoff.next()
+		s.log.Warn("subscription ended, resubscribing", "error", err, "retry_in", wait)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// session subscribes and delivers logs until the subscription ends or ctx
+// is done. It reports whether it subscribed, and returns an error unless
+// ctx is done.
+func (s *Streamer) session(ctx context.Context) (bool, error) {
 	sub, err := s.chain.Subscribe(ctx, s.query)
 	if err != nil {
-		return fmt.Errorf("streamer: subscribe: %w", err)
+		return false, fmt.Errorf("streamer: subscribe: %w", err)
 	}
 	defer sub.Unsubscribe()
+	s.backoff.reset()
+	s.status.setState(StateLive)
+	s.log.Info("subscribed")
 
+	errs := sub.Err()
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return true, nil
 		case log, ok := <-sub.Logs():
 			if !ok {
-				return nil
+				return true, fmt.Errorf("streamer: subscription closed")
 			}
 			s.emitEvent(log)
-		case err, ok := <-sub.Err():
+		case err, ok := <-errs:
 			if !ok {
-				return nil
+				errs = nil
+				continue
 			}
 			s.emitError(err)
 		}
 	}
 }
 
+// Pause ends the subscription after the log being delivered, if any, and
+// halts delivery until Resume subscribes again. The streamer does not track
+// progress, so logs emitted while paused are not delivered. Pause must not
+// be called from the streamer's callbacks.
+func (s *Streamer) Pause() {
+	s.gate.pause()
+	s.status.paused()
+}
+
+// Resume subscribes again after Pause.
+func (s *Streamer) Resume() {
+	s.gate.resume()
+}
+
+// Paused reports whether the streamer is paused.
+func (s *Streamer) Paused() bool {
+	return s.gate.isPaused()
+}
+
+// UpdateQuery ends the subscription after the log being delivered, if any,
+// and subscribes again with the new addresses and topics. The streamer does
+// not track progress, so the boundary is unknown and logs emitted while it
+// resubscribes may be missed.
+func (s *Streamer) UpdateQuery(q filter.Query) uint64 {
+	s.gate.interrupt(func() {
+		s.query = withFilter(s.query, q)
+	})
+	return 0
+}
+
 // Stop terminates the streaming subscription.
 func (s *Streamer) Stop() error {
 	s.mu.Lock()
 	cancel := s.cancel
+	s.halted = cancel == nil
 	s.mu.Unlock()
 
 	if cancel != nil {
@@ -96,12 +216,19 @@ func (s *Streamer) emitEvent(log event.Log) {
 	s.mu.Lock()
 	fn := s.onEvent
 	s.mu.Unlock()
-	if fn != nil {
-		fn(log)
+	s.status.observed(log.BlockNumber)
+	if fn == nil {
+		return
+	}
+	if err := fn(log); err != nil {
+		s.emitError(handlerError(log.BlockNumber, log.BlockNumber, fmt.Errorf("streamer: handle log in block %d: %w", log.BlockNumber, err)))
+		return
 	}
+	s.status.delivered(1)
 }
 
 func (s *Streamer) emitError(err error) {
+	s.status.failed(err)
 	s.mu.Lock()
 	fn := s.onError
 	s.mu.Unlock()
@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// testSubscription is a subscription the test feeds and ends.
+type testSubscription struct {
+	logs chan event.Log
+	errs chan error
+	once sync.Once
+}
+
+func newTestSubscription() *testSubscription {
+	return &testSubscription{logs: make(chan event.Log), errs: make(chan error)}
+}
+
+func (s *testSubscription) Logs() <-chan event.Log { return s.logs }
+
+func (s *testSubscription) Err() <-chan error { return s.errs }
+
+func (s *testSubscription) Unsubscribe() { s.end() }
+
+// end closes the channels, as a dropped connection does.
+func (s *testSubscription) end() {
+	s.once.Do(func() {
+		close(s.logs)
+		close(s.errs)
+	})
+}
+
+// streamedLog returns a log in block n, with a block hash of its own.
+func streamedLog(n uint64) event.Log {
+	return event.Log{BlockNumber: n, BlockHash: blockHash(n, 0)}
+}
+
+// subChain hands out the subscriptions sent on subs, failing Subscribe
+// while subs is nil.
+type subChain struct {
+	subs chan *testSubscription
+}
+
+func (c *subChain) ID() string { return "test" }
+
+func (c *subChain) LatestBlock(ctx context.Context) (uint64, error) { return 0, nil }
+
+func (c *subChain) FetchLogs(ctx context.Context, q filter.Query) ([]event.Log, error) {
+	return nil, nil
+}
+
+func (c *subChain) Subscribe(ctx context.Context, q filter.Query) (chain.Subscription, error) {
+	if c.subs == nil {
+		return nil, errors.New("test: subscriptions not supported")
+	}
+	select {
+	case sub := <-c.subs:
+		return sub, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestStreamerResubscribes(t *testing.T) {
+	c := &subChain{subs: make(chan *testSubscription)}
+	s := NewStreamer(c, filter.Query{})
+	s.backoff.base = time.Millisecond
+
+	logs := make(chan uint64)
+	errs := make(chan error, 10)
+	s.OnEvent(func(log event.Log) { logs <- log.BlockNumber })
+	s.OnError(func(err error) { errs <- err })
+	done := make(chan error, 1)
+	go func() { done <- s.Watch() }()
+
+	for _, block := range []uint64{1, 2} {
+		sub := newTestSubscription()
+		c.subs <- sub
+		sub.logs <- streamedLog(block)
+		if got := <-logs; got != block {
+			t.Fatalf("delivered block %d, want %d", got, block)
+		}
+		sub.end()
+
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Fatal("reported a nil error for the closed subscription")
+			}
+		case err := <-done:
+			t.Fatalf("Watch returned %v after the subscription closed, want a resubscription", err)
+		case <-time.After(time.Second):
+			t.Fatal("closed subscription not reported")
+		}
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+}
+
+func TestStreamerFirstSubscribeFails(t *testing.T) {
+	s := NewStreamer(&subChain{}, filter.Query{})
+
+	done := make(chan error, 1)
+	go func() { done <- s.Watch() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Watch returned nil, want the subscribe error")
+		}
+	case <-time.After(time.Second):
+		s.Stop()
+		t.Fatal("Watch kept retrying a chain that never subscribed")
+	}
+	if got := s.Status().State; got != StateFailed {
+		t.Errorf("state = %v, want %v", got, StateFailed)
+	}
+}
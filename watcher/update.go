@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/hedeqiang/sonar/chain"
+	"github.com/hedeqiang/sonar/cursor"
+	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/filter"
+)
+
+// QueryUpdater is implemented by watchers whose query can change while they
+// run.
+type QueryUpdater interface {
+	// UpdateQuery replaces the addresses and topics of the watcher's query;
+	// block bounds are ignored. It waits for the range or log being
+	// delivered, if any, and returns the boundary block: blocks before it
+	// were scanned with the old query, blocks from it on are scanned with
+	// the new one. Zero means the boundary is not known. UpdateQuery must
+	// not be called from the watcher's callbacks.
+	UpdateQuery(q filter.Query) uint64
+}
+
+// CursorKeyUpdater is implemented by watchers whose cursor key can change
+// together with their query.
+type CursorKeyUpdater interface {
+	// UpdateQueryKey is UpdateQuery, also moving the watcher's progress to
+	// key: the progress saved under the previous key is saved under key,
+	// which the watcher saves under from then on. If that fails, neither the
+	// query nor the key changes.
+	UpdateQueryKey(q filter.Query, key string) (uint64, error)
+}
+
+// Backfiller is implemented by watchers that can scan a past block range
+// while they run.
+type Backfiller interface {
+	// Backfill scans blocks from through to with q before the watcher
+	// continues, delivering the logs like any others but without moving its
+	// progress. done, if not nil, is called once every block is delivered,
+	// at once for an empty range. Pending backfills are not saved, so they
+	// are lost if the process stops before they complete; callers that
+	// must resume them record their completion in done.
+	Backfill(q filter.Query, from, to uint64, done func())
+}
+
+// backfill is a pending scan of a past block range.
+type backfill struct {
+	query    filter.Query
+	from, to uint64
+	done     func() // may be nil
+}
+
+// complete calls the done function of b, if any.
+func (b *backfill) complete() {
+	if b.done != nil {
+		b.done()
+	}
+}
+
+// scan fetches the logs of the remaining blocks of b in windows of sizer and
+// passes each window to deliver, moving b past it once delivered.
+func (b *backfill) scan(ctx context.Context, logger *slog.Logger, c chain.Chain, sizer *rangeSizer, deliver func(logs []event.Log, from, to uint64) error) error {
+	for b.from <= b.to {
+		logs, end, err := fetchRange(ctx, logger, c, b.query, sizer, b.from, b.to)
+		if err != nil {
+			return err
+		}
+		if err := deliver(logs, b.from, end); err != nil {
+			return err
+		}
+		b.from = end + 1
+	}
+	return nil
+}
+
+// covers reports whether b scans with the addresses and topics of q, so
+// that the blocks it completes count as processed by a watcher with q.
+func (b *backfill) covers(q filter.Query) bool {
+	return b.query.Fingerprint() == q.Fingerprint()
+}
+
+// carryProgress saves the progress saved under from under to as well.
+func carryProgress(c cursor.Cursor, from, to string) error {
+	if from == to {
+		return nil
+	}
+	block, err := c.Load(from)
+	if err != nil {
+		return fmt.Errorf("load cursor: %w", err)
+	}
+	if block == 0 {
+		return nil
+	}
+	if err := c.Save(to, block); err != nil {
+		return cursorSaveError(err)
+	}
+	return nil
+}
+
+// withFilter returns q with the addresses and topics of update.
+func withFilter(q, update filter.Query) filter.Query {
+	q.Addresses = update.Addresses
+	q.Topics = update.Topics
+	return q
+}
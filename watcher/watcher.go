@@ -2,7 +2,10 @@
 package watcher
 
 import (
+	"context"
+
 	"github.com/hedeqiang/sonar/event"
+	"github.com/hedeqiang/sonar/retry"
 )
 
 // Watcher monitors a blockchain for event logs.
@@ -11,12 +14,42 @@ type Watcher interface {
 	// or Stop is called. Returns nil on graceful stop.
 	Watch() error
 
-	// Stop gracefully shuts down the watcher.
+	// Stop gracefully shuts down the watcher and waits for Watch to return.
+	// Called before Watch, it returns at once and makes Watch return nil
+	// without starting.
 	Stop() error
 
 	// OnEvent registers a callback invoked for each received event log.
 	OnEvent(fn func(event.Log))
 
+	// OnEventE registers a callback that acknowledges each event log. A
+	// non-nil error means the log was not processed: watchers that track
+	// progress retry it and never save progress past its block. It replaces
+	// a callback registered with OnEvent.
+	OnEventE(fn func(event.Log) error)
+
 	// OnError registers a callback invoked when an error occurs.
 	OnError(fn func(error))
 }
+
+// acked adapts a callback without an acknowledgement to OnEventE.
+func acked(fn func(event.Log)) func(event.Log) error {
+	if fn == nil {
+		return nil
+	}
+	return func(log event.Log) error {
+		fn(log)
+		return nil
+	}
+}
+
+// handle passes log to fn, retrying under strategy while fn fails. Handlers
+// can return retry.Permanent to give up without further attempts.
+func handle(ctx context.Context, strategy retry.Strategy, fn func(event.Log) error, log event.Log) error {
+	if fn == nil {
+		return nil
+	}
+	return retry.Do(ctx, strategy, func(context.Context) error {
+		return fn(log)
+	})
+}